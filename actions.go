@@ -0,0 +1,313 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+)
+
+// machineAction is an entry in the action menu
+type machineAction struct {
+	// Action's keys run the entry straight from the menu
+	Action KeyAction
+	Label  string
+	// Disabled says why the action can't run on this machine, if it can't
+	Disabled string
+	// External actions reach outside the display, to the event source, a
+	// shell or the clipboard, and are refused for replayed key presses
+	External bool
+	run      func(m *DisplayModel, machine *models.Machine) tea.Cmd
+}
+
+// actionMenu is the open action menu for one machine. Its actions are
+// worked out afresh each time, so they follow the machine's state.
+type actionMenu struct {
+	Machine string
+	Cursor  int
+}
+
+// actionResultMsg reports how an action went, for the log pane
+type actionResultMsg struct {
+	Machine string
+	Text    string
+	Err     error
+}
+
+// machineActions lists the actions for machine, disabling the ones that
+// don't apply to its current state
+func (m *DisplayModel) machineActions(machine *models.Machine) []machineAction {
+	finished := machine.Complete() || machine.Failed()
+	commandDisabled := func(enabled bool, reason string) string {
+		switch {
+		case m.Commander == nil:
+			return "not supported by this event source"
+		case !enabled:
+			return reason
+		}
+		return ""
+	}
+	noIP := func(ip string) string {
+		if ip == "" {
+			return "no address yet"
+		}
+		return ""
+	}
+
+	return []machineAction{
+		{
+			Action:   ActionRetry,
+			Label:    "Retry failed step",
+			External: true,
+			Disabled: commandDisabled(machine.Failed(), "nothing has failed"),
+			run:      commandAction(events.ActionRetry),
+		},
+		{
+			Action:   ActionCancel,
+			Label:    "Cancel machine",
+			External: true,
+			Disabled: commandDisabled(!finished, "already finished"),
+			run:      commandAction(events.ActionCancel),
+		},
+		{
+			Action:   ActionSSH,
+			Label:    "SSH to " + orDash(machine.PublicIP),
+			External: true,
+			Disabled: noIP(machine.PublicIP),
+			run: func(m *DisplayModel, machine *models.Machine) tea.Cmd {
+				return m.sshCmd(machine)
+			},
+		},
+		{
+			Action:   ActionCopyPublicIP,
+			Label:    "Copy public IP",
+			External: true,
+			Disabled: noIP(machine.PublicIP),
+			run: func(_ *DisplayModel, machine *models.Machine) tea.Cmd {
+				return copyCmd(machine.Name, "public IP", machine.PublicIP)
+			},
+		},
+		{
+			Action:   ActionCopyPrivateIP,
+			Label:    "Copy private IP",
+			External: true,
+			Disabled: noIP(machine.PrivateIP),
+			run: func(_ *DisplayModel, machine *models.Machine) tea.Cmd {
+				return copyCmd(machine.Name, "private IP", machine.PrivateIP)
+			},
+		},
+	}
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// openActionMenu opens the menu for the selected machine
+func (m *DisplayModel) openActionMenu() {
+	machine, ok := m.selectedMachine()
+	if !ok {
+		return
+	}
+	m.menu = &actionMenu{Machine: machine.Name}
+}
+
+// menuMachine is the machine the open menu acts on
+func (m *DisplayModel) menuMachine() (*models.Machine, bool) {
+	index, err := models.GetMachineIndexByName(m.menu.Machine, m.Deployment.Machines)
+	if err != nil {
+		return nil, false
+	}
+	return &m.Deployment.Machines[index], true
+}
+
+// handleMenuKey moves through or runs the open action menu. The menu
+// closes when an action runs or on the close key.
+func (m *DisplayModel) handleMenuKey(msg tea.KeyMsg) tea.Cmd {
+	menu := m.menu
+	machine, ok := m.menuMachine()
+	if !ok {
+		m.menu = nil
+		return nil
+	}
+	actions := m.machineActions(machine)
+	key, ok := m.Keys.Resolve(msg.String(), true)
+	if !ok {
+		return nil
+	}
+	switch key {
+	case ActionClose:
+		m.menu = nil
+		return nil
+	case ActionMenuUp:
+		menu.Cursor = max(menu.Cursor-1, 0)
+		return nil
+	case ActionMenuDown:
+		menu.Cursor = min(menu.Cursor+1, len(actions)-1)
+		return nil
+	case ActionMenuRun:
+		return m.runAction(machine, actions[menu.Cursor])
+	}
+	for i, action := range actions {
+		if action.Action == key {
+			menu.Cursor = i
+			return m.runAction(machine, action)
+		}
+	}
+	return nil
+}
+
+// runAction runs action on machine and closes the menu, unless the action
+// is disabled or is external and the key press was replayed
+func (m *DisplayModel) runAction(machine *models.Machine, action machineAction) tea.Cmd {
+	if action.External && m.replaying {
+		m.Logs.Append(LogEntry{
+			Level:   models.LogLevelInfo,
+			Machine: machine.Name,
+			Text:    fmt.Sprintf("%s: not run during a replay", action.Label),
+		})
+		return nil
+	}
+	if action.Disabled != "" {
+		m.Logs.Append(LogEntry{
+			Level:   models.LogLevelWarn,
+			Machine: machine.Name,
+			Text:    fmt.Sprintf("%s: %s", action.Label, action.Disabled),
+		})
+		return nil
+	}
+	m.menu = nil
+	return action.run(m, machine)
+}
+
+// commandAction sends action to the event source, which reports the
+// outcome through its status updates
+func commandAction(action events.Action) func(m *DisplayModel, machine *models.Machine) tea.Cmd {
+	return func(m *DisplayModel, machine *models.Machine) tea.Cmd {
+		commander, name := m.Commander, machine.Name
+		return func() tea.Msg {
+			err := commander.Execute(events.Command{Action: action, Machine: name})
+			return actionResultMsg{Machine: name, Text: fmt.Sprintf("%s requested", action), Err: err}
+		}
+	}
+}
+
+// sshCmd suspends the display for an interactive ssh session to the
+// machine's public IP, using the deployment's key and port if it has them
+func (m *DisplayModel) sshCmd(machine *models.Machine) tea.Cmd {
+	var args []string
+	if m.Deployment.SSHPrivateKeyPath != "" {
+		args = append(args, "-i", m.Deployment.SSHPrivateKeyPath)
+	}
+	if m.Deployment.SSHPort != 0 {
+		args = append(args, "-p", strconv.Itoa(m.Deployment.SSHPort))
+	}
+	args = append(args, machine.PublicIP)
+
+	name := machine.Name
+	return tea.ExecProcess(exec.Command("ssh", args...), func(err error) tea.Msg { //nolint:gosec
+		return actionResultMsg{Machine: name, Text: "ssh session ended", Err: err}
+	})
+}
+
+// copyCmd puts value on the clipboard with an OSC 52 escape sequence, which
+// works over ssh as long as the terminal allows it
+func copyCmd(machine, what, value string) tea.Cmd {
+	return func() tea.Msg {
+		text := fmt.Sprintf("copied %s %s", what, value)
+		tty, err := openTerminal()
+		if err != nil {
+			return actionResultMsg{Machine: machine, Text: text, Err: err}
+		}
+		defer tty.Close()
+
+		seq := osc52.New(value)
+		switch {
+		case os.Getenv("TMUX") != "":
+			seq = seq.Tmux()
+		case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+			seq = seq.Screen()
+		}
+		_, err = seq.WriteTo(tty)
+		return actionResultMsg{Machine: machine, Text: text, Err: err}
+	}
+}
+
+// openTerminal opens the controlling terminal, or stderr if that is one, so
+// escape sequences don't end up in a redirected file
+func openTerminal() (io.WriteCloser, error) {
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		return tty, nil
+	}
+	if isatty.IsTerminal(os.Stderr.Fd()) {
+		return nopCloser{os.Stderr}, nil
+	}
+	return nil, errors.New("no terminal to copy through")
+}
+
+// nopCloser keeps stderr open when the copy is done
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// logActionResult shows the outcome of an action in the log pane
+func (m *DisplayModel) logActionResult(msg actionResultMsg) {
+	entry := LogEntry{Level: models.LogLevelInfo, Machine: msg.Machine, Text: msg.Text}
+	if msg.Err != nil {
+		entry.Level = models.LogLevelError
+		entry.Text = fmt.Sprintf("%s: %v", msg.Text, msg.Err)
+		displayLog.Error("action failed", logger.MachineKey, msg.Machine, "action", msg.Text, "err", msg.Err)
+	} else {
+		displayLog.Info("action done", logger.MachineKey, msg.Machine, "action", msg.Text)
+	}
+	m.Logs.Append(entry)
+}
+
+// renderActionMenu is the open action menu, with the cursor on one entry
+// and the disabled entries greyed out with the reason
+func (m *DisplayModel) renderActionMenu() string {
+	if m.menu == nil {
+		return ""
+	}
+	machine, ok := m.menuMachine()
+	if !ok {
+		return ""
+	}
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(ActiveTheme.Header)
+	paneStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ActiveTheme.Accent).
+		Padding(0, 1)
+	mutedStyle := lipgloss.NewStyle().Foreground(ActiveTheme.Muted)
+
+	lines := []string{titleStyle.Render("Actions for " + m.menu.Machine)}
+	for i, action := range m.machineActions(machine) {
+		line := fmt.Sprintf("%-5s %s", m.Keys.Hint(action.Action), action.Label)
+		style := lipgloss.NewStyle()
+		if action.Disabled != "" {
+			line += " (" + action.Disabled + ")"
+			style = mutedStyle
+		}
+		if i == m.menu.Cursor {
+			style = ActiveTheme.selectedStyle(style)
+		}
+		lines = append(lines, style.Render(line))
+	}
+	lines = append(lines, mutedStyle.Render(fmt.Sprintf("%s/%s move, %s or key run, %s close",
+		m.Keys.Hint(ActionMenuUp), m.Keys.Hint(ActionMenuDown), m.Keys.Hint(ActionMenuRun), m.Keys.Hint(ActionClose))))
+	return paneStyle.Render(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/journal"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func key(s string) tea.KeyMsg {
+	return journal.ParseKey(s, false)
+}
+
+func replayed(s string) journal.ReplayedKeyMsg {
+	return journal.ReplayedKeyMsg{KeyMsg: key(s)}
+}
+
+// actionModel has one selected machine with both addresses
+func actionModel() *DisplayModel {
+	m := InitialModel()
+	m.Deployment.Machines = []models.Machine{{
+		Name:      "abc01-vm",
+		Type:      models.AzureResourceTypeVM,
+		Provider:  models.ProviderAzure,
+		Location:  "eastus",
+		PublicIP:  "1.2.3.4",
+		PrivateIP: "10.0.0.4",
+	}}
+	m.SelectedRow = 0
+	return m
+}
+
+func lastLog(m *DisplayModel) string {
+	entries := m.Logs.filtered()
+	if len(entries) == 0 {
+		return ""
+	}
+	return entries[len(entries)-1].Text
+}
+
+func TestReplayedKeysDontActOutsideTheDisplay(t *testing.T) {
+	for _, press := range []string{"s", "p", "i"} {
+		t.Run(press, func(t *testing.T) {
+			m := actionModel()
+			m.Update(replayed("a"))
+			if m.menu == nil {
+				t.Fatal("a replayed key didn't open the menu")
+			}
+			if _, cmd := m.Update(replayed(press)); cmd != nil {
+				t.Errorf("replayed %q returned a command", press)
+			}
+			if !strings.Contains(lastLog(m), "not run during a replay") {
+				t.Errorf("log = %q, want the refusal", lastLog(m))
+			}
+			if m.replaying {
+				t.Error("still replaying after the key was handled")
+			}
+
+			// The same key pressed live runs
+			if _, cmd := m.Update(key(press)); cmd == nil {
+				t.Errorf("live %q didn't run", press)
+			}
+		})
+	}
+}
+
+func TestReplayedQuitIsIgnored(t *testing.T) {
+	keys, err := NewKeymap(append([]KeyBinding{{Action: ActionQuit, Keys: []string{"Q"}, Context: ContextTable}},
+		DefaultKeyBindings[1:]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, press := range []string{"Q", "ctrl+c"} {
+		m := actionModel()
+		m.Keys = keys
+		if _, cmd := m.Update(replayed(press)); cmd != nil || m.Quitting {
+			t.Errorf("replayed %q quit the display", press)
+		}
+		if _, cmd := m.Update(key(press)); cmd == nil || !m.Quitting {
+			t.Errorf("live %q didn't quit", press)
+		}
+	}
+
+	// A replayed q still closes the menu it is bound to close
+	m := actionModel()
+	m.Update(replayed("a"))
+	m.Update(replayed("q"))
+	if m.menu != nil || m.Quitting {
+		t.Errorf("replayed q: menu %v, quitting %v; want the menu closed", m.menu, m.Quitting)
+	}
+}
+
+func TestReplayedKeysMoveTheView(t *testing.T) {
+	m := actionModel()
+	m.Update(replayed("enter"))
+	if !m.DetailExpanded {
+		t.Error("a replayed enter didn't open the details")
+	}
+	m.Update(replayed("?"))
+	if !m.showHelp {
+		t.Error("a replayed ? didn't open the help")
+	}
+}
+
+// fakeCommander records the commands it is given
+type fakeCommander struct {
+	commands []events.Command
+}
+
+func (c *fakeCommander) Execute(cmd events.Command) error {
+	c.commands = append(c.commands, cmd)
+	return nil
+}
+
+// disabled maps each action to why it is disabled, or "" if it can run
+func disabled(m *DisplayModel) map[KeyAction]string {
+	reasons := map[KeyAction]string{}
+	for _, action := range m.machineActions(&m.Deployment.Machines[0]) {
+		reasons[action.Action] = action.Disabled
+	}
+	return reasons
+}
+
+func TestMachineActionsFollowTheMachine(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(m *DisplayModel)
+		want  map[KeyAction]string
+	}{
+		{
+			name:  "source without commands",
+			setup: func(m *DisplayModel) { m.Commander = nil },
+			want: map[KeyAction]string{
+				ActionRetry:  "not supported by this event source",
+				ActionCancel: "not supported by this event source",
+			},
+		},
+		{
+			name:  "running",
+			setup: func(*DisplayModel) {},
+			want:  map[KeyAction]string{ActionRetry: "nothing has failed"},
+		},
+		{
+			name:  "failed",
+			setup: func(m *DisplayModel) { m.Deployment.Machines[0].Docker = models.ServiceStateFailed },
+			want:  map[KeyAction]string{ActionCancel: "already finished"},
+		},
+		{
+			name: "no addresses",
+			setup: func(m *DisplayModel) {
+				m.Deployment.Machines[0].PublicIP = ""
+				m.Deployment.Machines[0].PrivateIP = ""
+			},
+			want: map[KeyAction]string{
+				ActionRetry:         "nothing has failed",
+				ActionSSH:           "no address yet",
+				ActionCopyPublicIP:  "no address yet",
+				ActionCopyPrivateIP: "no address yet",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := actionModel()
+			m.Commander = &fakeCommander{}
+			tt.setup(m)
+			got := disabled(m)
+			for _, action := range []KeyAction{ActionRetry, ActionCancel, ActionSSH, ActionCopyPublicIP, ActionCopyPrivateIP} {
+				if got[action] != tt.want[action] {
+					t.Errorf("%s disabled %q, want %q", action, got[action], tt.want[action])
+				}
+			}
+		})
+	}
+}
+
+func TestMenuKeys(t *testing.T) {
+	commander := &fakeCommander{}
+	m := actionModel()
+	m.Commander = commander
+	m.Update(key("a"))
+	if m.menu == nil {
+		t.Fatal("a didn't open the menu")
+	}
+
+	// The cursor stops at both ends
+	for _, step := range []struct {
+		press string
+		want  int
+	}{{"up", 0}, {"down", 1}, {"j", 2}, {"k", 1}, {"down", 2}, {"down", 3}, {"down", 4}, {"down", 4}} {
+		m.Update(key(step.press))
+		if m.menu.Cursor != step.want {
+			t.Fatalf("%s moved the cursor to %d, want %d", step.press, m.menu.Cursor, step.want)
+		}
+	}
+
+	// A disabled entry's key moves the cursor to it, leaves the menu open
+	// and says why
+	m.Update(key("r"))
+	if m.menu == nil || m.menu.Cursor != 0 {
+		t.Fatalf("running a disabled entry: menu %+v, want it open on retry", m.menu)
+	}
+	if !strings.Contains(lastLog(m), "nothing has failed") {
+		t.Errorf("log = %q, want the reason", lastLog(m))
+	}
+
+	// Enter runs the entry under the cursor and closes the menu
+	m.Update(key("down"))
+	_, cmd := m.Update(key("enter"))
+	if m.menu != nil || cmd == nil {
+		t.Fatalf("enter on cancel: menu %+v, command %v", m.menu, cmd)
+	}
+	cmd()
+	if len(commander.commands) != 1 || commander.commands[0] != (events.Command{Action: events.ActionCancel, Machine: "abc01-vm"}) {
+		t.Errorf("commands = %+v, want abc01-vm cancelled", commander.commands)
+	}
+
+	// An entry's own key runs it wherever the cursor is
+	m.Update(key("a"))
+	if _, cmd := m.Update(key("x")); m.menu != nil || cmd == nil {
+		t.Errorf("x: menu %+v, command %v", m.menu, cmd)
+	}
+
+	// Keys the menu doesn't bind are swallowed
+	m.Update(key("a"))
+	m.Update(key("g"))
+	if m.menu == nil || m.Grouping != GroupNone {
+		t.Errorf("g reached the table with the menu open")
+	}
+	m.Update(key("esc"))
+	if m.menu != nil {
+		t.Error("esc didn't close the menu")
+	}
+
+	// The menu closes if its machine goes away
+	m.Update(key("a"))
+	m.Deployment.Machines = nil
+	m.Update(key("down"))
+	if m.menu != nil {
+		t.Error("the menu stayed open without its machine")
+	}
+}
@@ -3,80 +3,148 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/aronchick/bubble-tea-experiment/pkg/api"
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/journal"
 	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/metrics"
 	"github.com/aronchick/bubble-tea-experiment/pkg/models"
 	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
+// displayLog is the diagnostic log of the display
+var displayLog = logger.Component("display")
+
 // Constants
 const (
-	LogLines           = 10
 	AzureTotalSteps    = 7
-	StatusLength       = 30
-	TickerInterval     = 250 * time.Millisecond
+	StateSaveInterval  = 5 * time.Second
 	ProgressBarPadding = 2
 )
 
+// Display settings, replaced by the config's display section at startup
+var (
+	LogLines       = 10
+	TickerInterval = 250 * time.Millisecond
+)
+
 // DisplayColumn represents a column in the display table
 type DisplayColumn struct {
-	TextTitle   string
-	EmojiTitle  string
-	Width       int
-	Height      int
-	EmojiColumn bool
+	TextTitle string
+	Width     int
+	Height    int
+	// SymbolColumn columns show a glyph per row and use TitleGlyph as their
+	// title
+	SymbolColumn bool
+	TitleGlyph   models.Glyph
+
+	// MinWidth and MaxWidth bound a flexible column when the table is
+	// resized; columns without them keep their Width
+	MinWidth int
+	MaxWidth int
+	// Priority decides which columns are hidden first on narrow terminals:
+	// the highest number goes first and 0 is never hidden
+	Priority int
+	// Hidden is set by LayoutColumns when the column does not fit
+	Hidden bool
 }
 
 // DisplayColumns defines the structure of the display table
 //
 //nolint:gomnd
 var DisplayColumns = []DisplayColumn{
-	{TextTitle: "Name", Width: 10},
-	{TextTitle: "Type", Width: 6},
-	{TextTitle: "Location", Width: 16},
-	{TextTitle: "Status", Width: StatusLength},
-	{TextTitle: "Progress", Width: 20},
-	{TextTitle: "Time", Width: 8},
-	{TextTitle: "Pub IP", Width: 19},
-	{TextTitle: "Priv IP", Width: 19},
-	{TextTitle: models.DisplayTextOrchestrator, EmojiTitle: models.DisplayEmojiOrchestrator, Width: 2, EmojiColumn: true},
-	{TextTitle: models.DisplayTextSSH, EmojiTitle: models.DisplayEmojiSSH, Width: 2, EmojiColumn: true},
-	{TextTitle: models.DisplayTextDocker, EmojiTitle: models.DisplayEmojiDocker, Width: 2, EmojiColumn: true},
-	{TextTitle: models.DisplayTextBacalhau, EmojiTitle: models.DisplayEmojiBacalhau, Width: 2, EmojiColumn: true},
+	{TextTitle: "Name", Width: 10, MinWidth: 8, MaxWidth: 16},
+	{TextTitle: "Cloud", Width: 5, Priority: 5},
+	{TextTitle: "Type", Width: 6, Priority: 5},
+	{TextTitle: "Location", Width: 16, MinWidth: 10, MaxWidth: 16, Priority: 4},
+	{TextTitle: "Status", Width: models.StatusLength, MinWidth: 12, MaxWidth: 60, Priority: 1},
+	{TextTitle: "Progress", Width: 20, MinWidth: 10, MaxWidth: 20, Priority: 2},
+	{TextTitle: "Time", Width: 8, Priority: 3},
+	{TextTitle: "Pub IP", Width: 19, MinWidth: 17, MaxWidth: 19, Priority: 6},
+	{TextTitle: "Priv IP", Width: 19, MinWidth: 17, MaxWidth: 19, Priority: 7},
+	{TextTitle: "Orchestrator", TitleGlyph: models.GlyphOrchestrator, Width: 2, SymbolColumn: true, Priority: 2},
+	{TextTitle: "SSH", TitleGlyph: models.GlyphSSH, Width: 2, SymbolColumn: true, Priority: 2},
+	{TextTitle: "Docker", TitleGlyph: models.GlyphDocker, Width: 2, SymbolColumn: true, Priority: 2},
+	{TextTitle: "Bacalhau", TitleGlyph: models.GlyphBacalhau, Width: 2, SymbolColumn: true, Priority: 2},
 	{TextTitle: "", Width: 1},
 }
 
-var Quitting = false
-
-func AggregateColumnWidths() int {
-	width := 0
-	for _, column := range DisplayColumns {
-		width += column.Width
-	}
-	return width
+// AggregateColumnWidths returns the total width of the visible columns
+func (m *DisplayModel) AggregateColumnWidths() int {
+	return visibleWidth(m.columns)
 }
 
 // DisplayModel represents the main display model
 type DisplayModel struct {
 	Deployment *models.Deployment
-	TextBox    []string
+	Logs       *LogView
 	Quitting   bool
 	LastUpdate time.Time
 	DebugMode  bool
 	Cancel     context.CancelFunc
+
+	// SelectedRow is the index of the selected machine, or noSelection
+	SelectedRow int
+	// SelectedGroup is the name of the selected group header, if a header
+	// rather than a machine is selected
+	SelectedGroup string
+	// Grouping groups the table's rows under collapsible headers
+	Grouping GroupMode
+	// collapsed holds the names of the collapsed groups
+	collapsed map[string]bool
+	// DetailExpanded shows the resource drill-down for the selected machine
+	DetailExpanded bool
+
+	// PersistState saves the deployment to StateFile every
+	// StateSaveInterval while it is changing
+	PersistState bool
+	StateFile    string
+	stateDirty   bool
+	lastSaved    time.Time
+
+	// logSeq is the number of testutils log buffer lines already shown
+	logSeq int
+
+	// Journal, if set, records every message the model receives
+	Journal *journal.Writer
+	// Stepper advances a step-by-step replay when "n" is pressed
+	Stepper events.Stepper
+	// replaying is set while a recorded key press is handled
+	replaying bool
+	// API, if set, is sent every change the model applies
+	API *api.Server
+	// Metrics, if set, observes every change the model applies
+	Metrics *metrics.Collector
+	// Commander, if set, takes the retry and cancel actions
+	Commander events.Commander
+	// menu is the open action menu, if any
+	menu *actionMenu
+	// Keys maps key presses to actions
+	Keys *Keymap
+	// showHelp replaces the display with the key help
+	showHelp bool
+
+	// width and height are the terminal size, or 0 until the first resize
+	// event
+	width  int
+	height int
+	// columns is DisplayColumns laid out for the current width
+	columns []DisplayColumn
 }
 
 // DisplayMachine represents a single machine in the deployment
 type DisplayMachine struct {
 	Name          string
-	Type          models.AzureResourceTypes
+	Type          models.ResourceType
 	Location      string
 	StatusMessage string
 	StartTime     time.Time
@@ -112,10 +180,13 @@ func SetGlobalModel(m *DisplayModel) {
 // InitialModel creates and returns a new DisplayModel
 func InitialModel() *DisplayModel {
 	return &DisplayModel{
-		Deployment: models.NewDeployment(),
-		TextBox:    []string{"Resource Status Monitor"},
-		LastUpdate: time.Now(),
-		DebugMode:  os.Getenv("DEBUG_DISPLAY") == "1",
+		Deployment:  models.NewDeployment(),
+		Logs:        NewLogView(LogLines - 1), // leave room for the title line
+		LastUpdate:  time.Now(),
+		SelectedRow: noSelection,
+		collapsed:   map[string]bool{},
+		Keys:        DefaultKeymap(),
+		columns:     LayoutColumns(DisplayColumns, 0),
 	}
 }
 
@@ -127,15 +198,8 @@ func (m *DisplayModel) Init() tea.Cmd {
 func CancelFunc() tea.Cmd {
 	m := GetGlobalModel()
 	return func() tea.Msg {
-		if os.Getenv("DEBUG_CHANNELS") == "1" {
-			fmt.Fprintf(LogFile, "CancelFunc called\n")
-			LogFile.Sync()
-		}
 		if m.Cancel != nil {
-			if os.Getenv("DEBUG_CHANNELS") == "1" {
-				fmt.Fprintf(LogFile, "Calling cancel function\n")
-				LogFile.Sync()
-			}
+			displayLog.Debug("cancelling the event source")
 			m.Cancel()
 		}
 		return nil
@@ -146,173 +210,448 @@ type quitMsg struct{}
 
 // Update handles updates to the DisplayModel
 func (m *DisplayModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	logger.Debug("Update function called with message type: %T", msg)
+	if logger.Enabled(slog.LevelDebug) {
+		displayLog.Debug("message received", "type", fmt.Sprintf("%T", msg))
+	}
+	m.record(msg)
 
+	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "q", "ctrl+c":
-			logger.Debug("Quit command detected")
-			m.Quitting = true
-			return m, tea.Sequence(
-				CancelFunc(),
-				tea.ClearScreen,
-				tea.Quit,
-			)
+		if msg.String() == "ctrl+c" {
+			return m, m.quit()
 		}
+		switch {
+		case m.showHelp:
+			m.handleHelpKey(msg)
+		case m.menu != nil:
+			cmd = m.handleMenuKey(msg)
+		case m.Logs.Editing():
+			m.Logs.HandleFilterKey(msg)
+		default:
+			action, ok := m.Keys.Resolve(msg.String(), false)
+			if !ok {
+				break
+			}
+			if action == ActionQuit {
+				return m, m.quit()
+			}
+			m.handleAction(action)
+		}
+	case journal.ReplayedKeyMsg:
+		// A recorded press is handled like a live one, flagged so that it
+		// can't act outside the display. The inner Update journals the key.
+		m.replaying = true
+		defer func() { m.replaying = false }()
+		return m.Update(msg.KeyMsg)
+	case actionResultMsg:
+		m.logActionResult(msg)
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.columns = LayoutColumns(DisplayColumns, msg.Width)
+	case tickMsg:
+		cmd = tea.Batch(tickCmd(), m.updateLogCmd())
 	case quitMsg:
-		logger.Debug("quitMsg received, quitting program")
 		return m, tea.Quit
 	case models.StatusUpdateMsg:
-		logger.Debug("StatusUpdateMsg received")
 		if !m.Quitting {
-			m.UpdateStatus(msg.Status)
+			cmd = m.UpdateStatus(msg.Status)
+			m.stateDirty = true
 		}
-	case models.TimeUpdateMsg:
-		if os.Getenv("DEBUG_CHANNELS") == "1" {
-			fmt.Fprintf(LogFile, "TimeUpdateMsg received\n")
-			LogFile.Sync()
+	case setupStepMsg:
+		if !m.Quitting {
+			cmd = m.handleSetupStep(msg)
+			m.stateDirty = true
 		}
+	case models.TimeUpdateMsg:
 		if !m.Quitting {
 			m.LastUpdate = time.Now()
 		}
 	case logLinesMsg:
-		if os.Getenv("DEBUG_CHANNELS") == "1" {
-			fmt.Fprintf(LogFile, "logLinesMsg received\n")
-			LogFile.Sync()
+		if !m.Quitting {
+			m.appendBufferedLogLines(msg)
 		}
+	case models.LogLineMsg:
 		if !m.Quitting {
-			m.TextBox = append(m.TextBox, string(msg))
-			if len(m.TextBox) > LogLines {
-				m.TextBox = m.TextBox[len(m.TextBox)-LogLines:]
-			}
+			m.Logs.Append(LogEntry{
+				Time:    msg.Time,
+				Level:   msg.Level,
+				Machine: msg.Machine,
+				Text:    msg.Text,
+			})
 		}
 	}
 
 	if m.Quitting {
-		if os.Getenv("DEBUG_CHANNELS") == "1" {
-			fmt.Fprintf(LogFile, "Model is quitting, returning tea.Quit\n")
-			LogFile.Sync()
-		}
 		return m, tea.Quit
 	}
-	if os.Getenv("DEBUG_CHANNELS") == "1" {
-		fmt.Fprintf(LogFile, "Returning batch commands: tickCmd and updateLogCmd\n")
-		LogFile.Sync()
+	m.saveStateIfDue()
+	return m, cmd
+}
+
+// quit stops the event source and ends the program. A replayed quit is
+// ignored so the replay doesn't end itself.
+func (m *DisplayModel) quit() tea.Cmd {
+	if m.replaying {
+		return nil
+	}
+	displayLog.Info("quitting")
+	m.Quitting = true
+	return tea.Sequence(
+		CancelFunc(),
+		tea.ClearScreen,
+		tea.Quit,
+	)
+}
+
+// handleAction runs a main view action
+func (m *DisplayModel) handleAction(action KeyAction) {
+	switch action {
+	case ActionHelp:
+		m.showHelp = true
+	case ActionUp:
+		m.moveSelection(-1)
+	case ActionDown:
+		m.moveSelection(1)
+	case ActionSelect:
+		if m.SelectedGroup != "" {
+			m.toggleGroup()
+		} else if _, ok := m.selectedMachine(); ok {
+			m.DetailExpanded = !m.DetailExpanded
+		}
+	case ActionMenu:
+		m.openActionMenu()
+	case ActionGroup:
+		m.cycleGrouping()
+	case ActionCollapseAll:
+		m.toggleAllGroups()
+	case ActionCloseDetail:
+		m.DetailExpanded = false
+	case ActionScrollUp:
+		m.Logs.ScrollUp(m.Logs.Height)
+	case ActionScrollDown:
+		m.Logs.ScrollDown(m.Logs.Height)
+	case ActionFollow:
+		m.Logs.ToggleFollow()
+	case ActionFilter:
+		m.Logs.StartFilter()
+	case ActionMachineLogs:
+		if machine, ok := m.selectedMachine(); ok {
+			m.Logs.ToggleMachine(machine.Name)
+		}
+	case ActionNextEvent:
+		if m.Stepper != nil {
+			m.Stepper.Step()
+		}
+	}
+}
+
+// handleHelpKey closes the help overlay on its own key or the close key
+func (m *DisplayModel) handleHelpKey(msg tea.KeyMsg) {
+	action, _ := m.Keys.Resolve(msg.String(), true)
+	help, _ := m.Keys.Resolve(msg.String(), false)
+	if action == ActionClose || help == ActionHelp {
+		m.showHelp = false
 	}
-	return m, tea.Batch(tickCmd(), m.updateLogCmd())
 }
 
 // View renders the DisplayModel
 func (m *DisplayModel) View() string {
+	if m.showHelp {
+		return m.renderHelp()
+	}
 	tableStyle := lipgloss.NewStyle().
 		BorderStyle(lipgloss.NormalBorder()).
-		BorderForeground(lipgloss.Color("240"))
+		BorderForeground(ActiveTheme.Border)
 	headerStyle := lipgloss.NewStyle().
 		Bold(true).
-		Foreground(lipgloss.Color("39")).
+		Foreground(ActiveTheme.Header).
 		Padding(0, 1)
 	cellStyle := lipgloss.NewStyle().
 		Padding(0, 1).
 		AlignVertical(lipgloss.Center)
 	textBoxStyle := lipgloss.NewStyle().
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(lipgloss.Color("63")).
-		Padding(1).
-		Height(LogLines + 2). // Add 2 to account for the border
-		Width(130)
+		BorderForeground(ActiveTheme.Accent).
+		Padding(0, 1).
+		Height(LogLines).
+		Width(m.logPaneWidth())
 	infoStyle := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("241")).
+		Foreground(ActiveTheme.Muted).
 		Italic(true)
 
 	tableStr := m.renderTable(headerStyle, cellStyle)
-	logContent := strings.Join(m.TextBox, "\n")
-	infoText := fmt.Sprintf(
-		"Press 'q' or Ctrl+C to quit (Last Updated: %s)",
-		m.LastUpdate.Format("15:04:05"),
-	)
+	logContent := m.Logs.Render(m.logPaneWidth() - textBoxStyle.GetHorizontalPadding())
+	infoText := fmt.Sprintf("%s (Last Updated: %s)", m.keyHints(), m.LastUpdate.Format("15:04:05"))
 
-	renderedContent := lipgloss.JoinVertical(
-		lipgloss.Left,
-		tableStyle.Render(tableStr),
-		"",
+	sections := []string{m.renderSummary(), tableStyle.Render(tableStr), ""}
+	if menu := m.renderActionMenu(); menu != "" {
+		sections = append(sections, menu)
+	}
+	if m.DetailExpanded {
+		if detail := m.renderDetailPane(); detail != "" {
+			sections = append(sections, detail)
+		}
+	}
+	sections = append(sections,
 		textBoxStyle.Render(logContent),
 		infoStyle.Render(infoText),
 	)
 
+	renderedContent := lipgloss.JoinVertical(lipgloss.Left, sections...)
+
 	return lipgloss.NewStyle().Render(renderedContent)
 }
 
+// keyHint is an action named in the footer
+type keyHint struct {
+	action KeyAction
+	text   string
+}
+
+// keyHints is the footer's summary of the most used keys, as bound in the
+// keymap. The step key is only shown during a step-by-step replay.
+func (m *DisplayModel) keyHints() string {
+	hints := []keyHint{
+		{ActionQuit, "quit"},
+		{ActionHelp, "help"},
+		{ActionSelect, "details"},
+		{ActionMenu, "actions"},
+		{ActionGroup, "group by " + m.Grouping.next().String()},
+		{ActionCollapseAll, "collapse all"},
+		{ActionFilter, "filter"},
+	}
+	if m.Stepper != nil {
+		hints = append(hints, keyHint{ActionNextEvent, "next event"})
+	}
+
+	var parts []string
+	for i, hint := range hints {
+		if key := m.Keys.Hint(hint.action); key != "" {
+			parts = append(parts, key+" "+hint.text)
+		}
+		// Selection goes after quit and help
+		if i == 1 {
+			if up, down := m.Keys.Hint(ActionUp), m.Keys.Hint(ActionDown); up != "" && down != "" {
+				parts = append(parts, up+"/"+down+" select")
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// logPaneWidth is the width of the log pane inside its border
+func (m *DisplayModel) logPaneWidth() int {
+	if m.width <= 0 {
+		return 130 //nolint:gomnd
+	}
+	return max(m.width-tableBorderWidth, 20) //nolint:gomnd
+}
+
 // RenderFinalTable renders the final table
 func (m *DisplayModel) RenderFinalTable() string {
 	return m.View()
 }
 
-// UpdateStatus updates the status of a machine
-func (m *DisplayModel) UpdateStatus(status *models.DisplayStatus) {
-	if status == nil || status.Name == "" {
+// SaveState writes the deployment to the state file
+func (m *DisplayModel) SaveState() error {
+	if err := m.Deployment.SaveStateFile(m.StateFile); err != nil {
+		return fmt.Errorf("failed to save deployment state: %w", err)
+	}
+	m.stateDirty = false
+	m.lastSaved = time.Now()
+	return nil
+}
+
+// record appends msg to the journal. A journal that fails to write is
+// reported once and then dropped rather than failing every update.
+func (m *DisplayModel) record(msg tea.Msg) {
+	if m.Journal == nil {
 		return
 	}
+	if err := m.Journal.Record(msg); err != nil {
+		displayLog.Error("journal stopped", "err", err)
+		m.Journal = nil
+		m.Logs.Append(LogEntry{Level: models.LogLevelError, Text: err.Error()})
+	}
+}
 
-	machine, found := m.findOrCreateMachine(status)
-	if found || (status.Name != "" && status.Type == models.AzureResourceTypeVM) {
+// countStatus counts a received status for the metrics, if they are being
+// collected
+func (m *DisplayModel) countStatus(applied bool) {
+	if m.Metrics == nil {
+		return
+	}
+	m.Metrics.StatusReceived()
+	if !applied {
+		m.Metrics.StatusDropped()
+	}
+}
+
+// publish sends an applied change to the metrics and to the API server, if
+// they are running
+func (m *DisplayModel) publish(status *models.DisplayStatus, machines ...*models.Machine) {
+	if m.Metrics != nil {
+		m.Metrics.Observe(m.Deployment, time.Now())
+	}
+	if m.API != nil {
+		m.API.Publish(m.Deployment, status, machines...)
+	}
+}
+
+// markFinished records the end times of machines, and of the deployment,
+// that have just finished
+func (m *DisplayModel) markFinished() {
+	m.Deployment.MarkFinished(time.Now())
+}
+
+func (m *DisplayModel) saveStateIfDue() {
+	if !m.PersistState || !m.stateDirty || time.Since(m.lastSaved) < StateSaveInterval {
+		return
+	}
+	if err := m.SaveState(); err != nil {
+		// Don't retry until the next interval
+		displayLog.Error("saving state failed", "err", err)
+		m.lastSaved = time.Now()
+		m.Logs.Append(LogEntry{Level: models.LogLevelError, Text: err.Error()})
+	}
+}
+
+// UpdateStatus updates the status of a machine. Typed resource updates are
+// recorded on the machine that owns the resource, and location-scoped
+// resources (<location>-vnet, <location>-nsg) on every machine in that
+// location. The returned command runs any setup steps the update started.
+func (m *DisplayModel) UpdateStatus(status *models.DisplayStatus) tea.Cmd {
+	if status == nil || status.Name == "" {
+		m.countStatus(false)
+		return nil
+	}
+
+	if m.Deployment.StartTime.IsZero() {
+		m.Deployment.StartTime = time.Now()
+	}
+
+	machines := m.machinesForStatus(status)
+	m.countStatus(len(machines) > 0)
+	if len(machines) == 0 {
+		displayLog.Debug("status matched no machine", logger.MachineKey, status.Name,
+			"type", status.Type.ShortResourceName)
+		return nil
+	}
+	displayLog.Debug("status applied", logger.MachineKey, status.Name,
+		"type", status.Type.ShortResourceName, "state", status.ResourceState, "machines", len(machines))
+
+	var cmds []tea.Cmd
+	for _, machine := range machines {
 		m.updateMachineStatus(machine, status)
+		recordResourceState(machine, status)
+		if status.SSH == models.ServiceStateSucceeded {
+			cmds = append(cmds, startSetup(machine))
+		}
+	}
+	m.markFinished()
+	m.publish(status, machines...)
+	return tea.Batch(cmds...)
+}
+
+// machinesForStatus returns the machines a status applies to, creating a
+// new machine for a machine-type status with an unknown name
+func (m *DisplayModel) machinesForStatus(status *models.DisplayStatus) []*models.Machine {
+	if machine, _ := m.findOrCreateMachine(status); machine != nil {
+		return []*models.Machine{machine}
+	}
+
+	if name := models.GetMachineNameFromResourceName(status.Name); name != "" {
+		if index, err := models.GetMachineIndexByName(name, m.Deployment.Machines); err == nil {
+			return []*models.Machine{&m.Deployment.Machines[index]}
+		}
+		return nil
 	}
+
+	var machines []*models.Machine
+	if location := models.GetLocationFromResourceName(status.Name); location != "" {
+		for i := range m.Deployment.Machines {
+			machine := &m.Deployment.Machines[i]
+			if machine.Location != location {
+				continue
+			}
+			if status.Type.Provider != "" && status.Type.Provider != machine.GetProvider() {
+				continue
+			}
+			machines = append(machines, machine)
+		}
+	}
+	return machines
+}
+
+// recordResourceState stores the state of the status's resource on machine,
+// so ResourcesComplete and the progress column follow it. Resources of
+// another provider's type are ignored.
+func recordResourceState(machine *models.Machine, status *models.DisplayStatus) {
+	if status.Type.ResourceString == "" || status.ResourceState == models.AzureResourceStateUnknown {
+		return
+	}
+	if status.Type.Provider != "" && status.Type.Provider != machine.GetProvider() {
+		return
+	}
+	machine.SetResource(status.Type.ResourceString, status.ResourceState, status.ResourceValue)
 }
 
 // Helper functions
 
 func (m *DisplayModel) renderTable(headerStyle, cellStyle lipgloss.Style) string {
 	var tableStr string
-	tableStr += m.renderRow(DisplayColumns, headerStyle, true)
+	tableStr += m.renderRow(m.columns, headerStyle, true)
 	if m.DebugMode {
-		tableStr += strings.Repeat("-", AggregateColumnWidths()) + "\n"
+		tableStr += strings.Repeat("-", m.AggregateColumnWidths()) + "\n"
 	}
-	for _, machine := range m.Deployment.Machines {
-		if machine.Name != "" {
-			tableStr += m.renderRow(m.getMachineRowData(machine), cellStyle, false)
+	for _, row := range m.tableRows() {
+		style := cellStyle
+		if m.selected(row) {
+			style = ActiveTheme.selectedStyle(style)
+		}
+		if row.group != nil {
+			tableStr += m.renderRow(m.getGroupRowData(row.group), groupStyle(style), false)
+			continue
 		}
+		tableStr += m.renderRow(m.getMachineRowData(m.Deployment.Machines[row.machine]), style, false)
 	}
 	return tableStr
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
 func (m *DisplayModel) renderRow(data interface{}, baseStyle lipgloss.Style, isHeader bool) string {
 	var rowStr string
 	var cellData []string
 
 	if isHeader {
 		for _, col := range data.([]DisplayColumn) {
-			if EmojisEnabled && col.EmojiColumn {
-				cellData = append(cellData, col.EmojiTitle)
-			} else {
-				cellData = append(cellData, col.TextTitle)
-			}
+			cellData = append(cellData, col.title())
 		}
 	} else {
 		cellData = data.([]string)
 	}
 
 	for i, cell := range cellData {
-		cellWidth := DisplayColumns[i].Width
+		if m.columns[i].Hidden {
+			continue
+		}
+		cellWidth := m.columns[i].Width
 		style := baseStyle.Width(cellWidth)
 
-		if DisplayColumns[i].EmojiColumn {
+		if m.columns[i].SymbolColumn {
 			if isHeader {
 				style = style.Align(lipgloss.Center)
 			} else {
 				style = renderStyleByColumn(cell, style)
 			}
-		} else if isHeader {
-			style = style.Align(lipgloss.Left)
 		} else {
-			style = style.Align(lipgloss.Left).MaxWidth(cellWidth)
+			// Truncate rather than let lipgloss wrap the cell onto a second line
+			cell = ansi.Truncate(cell, cellWidth-style.GetHorizontalPadding(), "…")
+			style = style.Align(lipgloss.Left)
+			if !isHeader {
+				style = style.MaxWidth(cellWidth)
+			}
 		}
 
 		renderedCell := style.Render(cell)
@@ -326,16 +665,17 @@ func (m *DisplayModel) renderRow(data interface{}, baseStyle lipgloss.Style, isH
 }
 
 func (m *DisplayModel) getMachineRowData(machine models.Machine) []string {
-	elapsedTime := time.Since(machine.StartTime).Truncate(TickerInterval)
+	elapsedTime := machineElapsed(&machine)
 	progress, total := machine.ResourcesComplete()
 	progressBar := renderProgressBar(
 		progress,
 		total,
-		DisplayColumns[4].Width-ProgressBarPadding,
+		m.columns[columnIndex(m.columns, "Progress")].Width-ProgressBarPadding,
 	)
 
 	return []string{
 		machine.Name,
+		string(machine.GetProvider().Abbreviation()),
 		machine.Type.ShortResourceName,
 		machine.Location,
 		machine.StatusMessage,
@@ -343,10 +683,10 @@ func (m *DisplayModel) getMachineRowData(machine models.Machine) []string {
 		formatElapsedTime(elapsedTime),
 		machine.PublicIP,
 		machine.PrivateIP,
-		ConvertToEmoji(machine.Orchestrator),
-		ConvertToEmoji(machine.SSH),
-		ConvertToEmoji(machine.Docker),
-		ConvertToEmoji(machine.Bacalhau),
+		symbol(models.NodeGlyph(machine.Orchestrator)),
+		symbol(models.ServiceStateGlyph(machine.SSH)),
+		symbol(models.ServiceStateGlyph(machine.Docker)),
+		symbol(models.ServiceStateGlyph(machine.Bacalhau)),
 		"",
 	}
 }
@@ -358,10 +698,11 @@ func (m *DisplayModel) findOrCreateMachine(status *models.DisplayStatus) (*model
 		}
 	}
 
-	if status.Name != "" && status.Type == models.AzureResourceTypeVM {
+	if status.Name != "" && status.Type.IsMachine() {
 		newMachine := models.Machine{
 			Name:          status.Name,
 			Type:          status.Type,
+			Provider:      status.Type.Provider,
 			Location:      status.Location,
 			StatusMessage: status.StatusMessage,
 			StartTime:     time.Now(),
@@ -374,13 +715,13 @@ func (m *DisplayModel) findOrCreateMachine(status *models.DisplayStatus) (*model
 }
 
 func (m *DisplayModel) updateMachineStatus(machine *models.Machine, status *models.DisplayStatus) {
+	if machine.StartTime.IsZero() {
+		machine.StartTime = time.Now()
+	}
+
 	if status.StatusMessage != "" {
-		trimmedStatus := strings.TrimSpace(status.StatusMessage)
-		if len(trimmedStatus) > StatusLength-3 {
-			machine.StatusMessage = trimmedStatus[:StatusLength-3] + "…"
-		} else {
-			machine.StatusMessage = fmt.Sprintf("%-*s", StatusLength, trimmedStatus)
-		}
+		// The status is truncated to the Status column's width when rendered
+		machine.StatusMessage = strings.TrimSpace(status.StatusMessage)
 	}
 
 	if status.Location != "" {
@@ -400,9 +741,6 @@ func (m *DisplayModel) updateMachineStatus(machine *models.Machine, status *mode
 	}
 	if status.SSH != models.ServiceStateUnknown {
 		machine.SSH = status.SSH
-		if status.SSH == models.ServiceStateSucceeded {
-			go m.installDockerAndCorePackages(machine)
-		}
 	}
 	if status.Docker != models.ServiceStateUnknown {
 		machine.Docker = status.Docker
@@ -415,25 +753,17 @@ func (m *DisplayModel) updateMachineStatus(machine *models.Machine, status *mode
 	}
 }
 
-func (m *DisplayModel) installDockerAndCorePackages(machine *models.Machine) {
-	// Install Docker
-	machine.Docker = models.ServiceStateUpdating
-	machine.Docker = models.ServiceStateSucceeded
-	machine.CorePackages = models.ServiceStateUpdating
-	machine.CorePackages = models.ServiceStateSucceeded
-}
-
 func renderStyleByColumn(status string, style lipgloss.Style) lipgloss.Style {
 	style = style.Bold(true).Align(lipgloss.Center)
 	switch status {
-	case models.DisplayTextSuccess:
-		style = style.Foreground(lipgloss.Color("#00c413"))
-	case models.DisplayTextWaiting:
-		style = style.Foreground(lipgloss.Color("#69acdb"))
-	case models.DisplayTextNotStarted:
-		style = style.Foreground(lipgloss.Color("#2e2d2d"))
-	case models.DisplayTextFailed:
-		style = style.Foreground(lipgloss.Color("#ff0000"))
+	case symbol(models.GlyphSucceeded):
+		style = style.Foreground(ActiveTheme.Success)
+	case symbol(models.GlyphWaiting):
+		style = style.Foreground(ActiveTheme.Pending)
+	case symbol(models.GlyphNotStarted):
+		style = style.Foreground(ActiveTheme.NotStarted)
+	case symbol(models.GlyphFailed):
+		style = style.Foreground(ActiveTheme.Failure)
 	}
 	return style
 }
@@ -449,11 +779,11 @@ func renderProgressBar(progress, total, width int) string {
 	}
 
 	filled := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("42")).
-		Render(strings.Repeat("█", filledWidth))
+		Foreground(ActiveTheme.ProgressFilled).
+		Render(strings.Repeat(symbol(models.GlyphProgressFilled), filledWidth))
 	empty := lipgloss.NewStyle().
-		Foreground(lipgloss.Color("237")).
-		Render(strings.Repeat("█", emptyWidth))
+		Foreground(ActiveTheme.ProgressEmpty).
+		Render(strings.Repeat(symbol(models.GlyphProgressEmpty), emptyWidth))
 
 	return filled + empty
 }
@@ -469,18 +799,41 @@ func formatElapsedTime(d time.Duration) string {
 	return fmt.Sprintf("%2d.%ds", seconds, tenths)
 }
 
+// appendBufferedLogLines adds the lines from the testutils log buffer that
+// have not been shown yet. Several updateLogCmd calls can be in flight at
+// once, so lines are de-duplicated by their position in the buffer.
+func (m *DisplayModel) appendBufferedLogLines(msg logLinesMsg) {
+	newLines := msg.total - m.logSeq
+	if newLines <= 0 {
+		return
+	}
+	if newLines < len(msg.lines) {
+		msg.lines = msg.lines[len(msg.lines)-newLines:]
+	}
+	for _, line := range msg.lines {
+		m.Logs.Append(LogEntry{Level: models.LogLevelInfo, Text: line})
+		m.record(models.LogLineMsg{Level: models.LogLevelInfo, Text: line, Time: time.Now()})
+	}
+	m.logSeq = msg.total
+}
+
 func (m *DisplayModel) updateLogCmd() tea.Cmd {
+	seen := m.logSeq
 	return func() tea.Msg {
-		logLines := testutils.GetLastLogLines()
+		logLines, total := testutils.GetLogLinesSince(seen)
 		if len(logLines) > 0 {
-			return logLinesMsg(logLines[len(logLines)-1])
+			return logLinesMsg{lines: logLines, total: total}
 		}
 		return nil
 	}
 }
 
 type tickMsg time.Time
-type logLinesMsg string
+
+type logLinesMsg struct {
+	lines []string
+	total int
+}
 
 func tickCmd() tea.Cmd {
 	return tea.Tick(TickerInterval, func(t time.Time) tea.Msg {
@@ -488,45 +841,15 @@ func tickCmd() tea.Cmd {
 	})
 }
 
-func ConvertToEmoji(value interface{}) string {
-	switch v := value.(type) {
-	case bool:
-		if v {
-			return models.DisplayTextOrchestratorNode
-		}
-		return models.DisplayTextWorkerNode
-	case models.ServiceState:
-		switch v {
-		case models.ServiceStateNotStarted:
-			if EmojisEnabled {
-				return models.DisplayEmojiNotStarted
-			}
-			return models.DisplayTextNotStarted
-		case models.ServiceStateSucceeded:
-			if EmojisEnabled {
-				return models.DisplayEmojiSuccess
-			}
-			return models.DisplayTextSuccess
-		case models.ServiceStateUpdating:
-			if EmojisEnabled {
-				return models.DisplayEmojiWaiting
-			}
-			return models.DisplayTextWaiting
-		case models.ServiceStateCreated:
-			if EmojisEnabled {
-				return models.DisplayEmojiCreating
-			}
-			return models.DisplayTextCreating
-		case models.ServiceStateFailed:
-			if EmojisEnabled {
-				return models.DisplayEmojiFailed
-			}
-			return models.DisplayTextFailed
-		}
-	}
+// symbol renders a glyph with the active glyph set
+func symbol(g models.Glyph) string {
+	return models.Glyphs().Symbol(g)
+}
 
-	if EmojisEnabled {
-		return models.DisplayEmojiWaiting
+// title is the column's header text
+func (c DisplayColumn) title() string {
+	if c.SymbolColumn {
+		return symbol(c.TitleGlyph)
 	}
-	return models.DisplayTextWaiting
+	return c.TextTitle
 }
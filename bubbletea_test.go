@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// regionalMachines has two Azure machines in eastus, one in westus and an
+// AWS machine in eastus
+func regionalMachines() *DisplayModel {
+	m := InitialModel()
+	for _, machine := range []struct {
+		name, location string
+		resourceType   models.ResourceType
+	}{
+		{"abc01-vm", "eastus", models.AzureResourceTypeVM},
+		{"abc02-vm", "eastus", models.AzureResourceTypeVM},
+		{"abc03-vm", "westus", models.AzureResourceTypeVM},
+		{"i-0aws", "eastus", models.AWSResourceTypeEC2},
+	} {
+		status := models.NewDisplayStatus(machine.name, machine.name, machine.resourceType, models.AzureResourceStatePending)
+		status.Location = machine.location
+		m.UpdateStatus(status)
+	}
+	return m
+}
+
+// resourceStates is the state of resourceType on each machine, by name
+func resourceStates(m *DisplayModel, resourceType models.ResourceType) map[string]models.AzureResourceState {
+	states := map[string]models.AzureResourceState{}
+	for i := range m.Deployment.Machines {
+		machine := &m.Deployment.Machines[i]
+		states[machine.Name] = machine.GetResource(resourceType.ResourceString).ResourceState
+	}
+	return states
+}
+
+func TestUpdateStatusRecordsResources(t *testing.T) {
+	// A resource never recorded reads as Unknown
+	unset := models.AzureResourceStateUnknown
+	tests := []struct {
+		name         string
+		earlier      *models.DisplayStatus
+		status       *models.DisplayStatus
+		resourceType models.ResourceType
+		want         map[string]models.AzureResourceState
+	}{
+		{
+			name:         "machine resource",
+			status:       models.NewDisplayStatus("abc01-vm-nic", "abc01-vm-nic", models.AzureResourceTypeNIC, models.AzureResourceStateSucceeded),
+			resourceType: models.AzureResourceTypeNIC,
+			want: map[string]models.AzureResourceState{
+				"abc01-vm": models.AzureResourceStateSucceeded, "abc02-vm": unset, "abc03-vm": unset, "i-0aws": unset,
+			},
+		},
+		{
+			name:         "location resource",
+			status:       models.NewDisplayStatus("eastus-vnet", "eastus-vnet", models.AzureResourceTypeVNET, models.AzureResourceStateSucceeded),
+			resourceType: models.AzureResourceTypeVNET,
+			// Not the westus machine, nor the AWS machine in eastus
+			want: map[string]models.AzureResourceState{
+				"abc01-vm": models.AzureResourceStateSucceeded, "abc02-vm": models.AzureResourceStateSucceeded, "abc03-vm": unset, "i-0aws": unset,
+			},
+		},
+		{
+			name:         "unknown state",
+			earlier:      models.NewDisplayStatus("westus-nsg", "westus-nsg", models.AzureResourceTypeNSG, models.AzureResourceStateSucceeded),
+			status:       models.NewDisplayStatus("westus-nsg", "westus-nsg", models.AzureResourceTypeNSG, models.AzureResourceStateUnknown),
+			resourceType: models.AzureResourceTypeNSG,
+			// A state that wasn't reported leaves the last one
+			want: map[string]models.AzureResourceState{
+				"abc01-vm": unset, "abc02-vm": unset, "abc03-vm": models.AzureResourceStateSucceeded, "i-0aws": unset,
+			},
+		},
+		{
+			name:         "resource of an unknown machine",
+			status:       models.NewDisplayStatus("abc09-vm-nic", "abc09-vm-nic", models.AzureResourceTypeNIC, models.AzureResourceStateSucceeded),
+			resourceType: models.AzureResourceTypeNIC,
+			want: map[string]models.AzureResourceState{
+				"abc01-vm": unset, "abc02-vm": unset, "abc03-vm": unset, "i-0aws": unset,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := regionalMachines()
+			if tt.earlier != nil {
+				m.UpdateStatus(tt.earlier)
+			}
+			m.UpdateStatus(tt.status)
+			got := resourceStates(m, tt.resourceType)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d machines, want %d: no machine is made for a resource", len(got), len(tt.want))
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s %s is %s, want %s", name, tt.resourceType.ShortResourceName, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLocationResourcesCountTowardsProgress(t *testing.T) {
+	m := regionalMachines()
+	m.UpdateStatus(models.NewDisplayStatus("eastus-vnet", "eastus-vnet", models.AzureResourceTypeVNET, models.AzureResourceStateSucceeded))
+	m.UpdateStatus(models.NewDisplayStatus("eastus-nsg", "eastus-nsg", models.AzureResourceTypeNSG, models.AzureResourceStateSucceeded))
+	m.UpdateStatus(models.NewDisplayStatus("abc01-vm-nic", "abc01-vm-nic", models.AzureResourceTypeNIC, models.AzureResourceStateSucceeded))
+
+	for name, want := range map[string]int{"abc01-vm": 3, "abc02-vm": 2, "abc03-vm": 0} {
+		index, err := models.GetMachineIndexByName(name, m.Deployment.Machines)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if done, _ := m.Deployment.Machines[index].ResourcesComplete(); done != want {
+			t.Errorf("%s has %d resources complete, want %d", name, done, want)
+		}
+	}
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/report"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables that set config keys. The
+// variable for a key is the key in upper case with dots as underscores, so
+// BTE_LOG_LEVEL sets log.level.
+const EnvPrefix = "BTE"
+
+// DefaultConfigPath is the config file read when -config is not given
+const DefaultConfigPath = "bubble-tea-experiment.yaml"
+
+// DefaultStatePath is the file deployment state is saved to when --state is
+// not given
+const DefaultStatePath = "bubble-tea-experiment-state.yaml"
+
+// LogFilePath is the default diagnostic log file
+const LogFilePath = "bubble-tea-experiment.log"
+
+// Config is the effective configuration of a run. Each setting comes from,
+// in order of precedence, its flag, its BTE_ environment variable, a legacy
+// environment variable, the config file or its default.
+type Config struct {
+	// ConfigFile holds the settings
+	ConfigFile string
+	// StateFile holds the saved deployment state, apart from the settings
+	StateFile string
+
+	Source string
+	Input  string
+	Follow bool
+	Plan   string
+	Resume bool
+	Azure  AzureConfig
+
+	Speed      float64
+	Seed       uint64
+	ReplayStep bool
+
+	Headless        bool
+	SummaryInterval time.Duration
+	Record          string
+	Report          []string
+	API             string
+	Metrics         string
+
+	Theme   string
+	Glyphs  string
+	Log     LogConfig
+	Display DisplayConfig
+}
+
+// AzureConfig is the azure source's settings
+type AzureConfig struct {
+	SubscriptionID string
+	ResourceGroup  string
+	PollInterval   time.Duration
+	ARMEndpoint    string
+}
+
+// LogConfig is the diagnostic log's settings
+type LogConfig struct {
+	Level      string
+	Format     string
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// DisplayConfig is the TUI's settings
+type DisplayConfig struct {
+	TickInterval time.Duration
+	LogLines     int
+	StatusWidth  int
+	Debug        bool
+	// ColumnWidths overrides the widths of DisplayColumns by column name,
+	// e.g. location or pub_ip
+	ColumnWidths map[string]int
+}
+
+// setting is a config key with its flag, if it has one, and its default.
+// The default's type is the flag's type.
+type setting struct {
+	Key     string
+	Flag    string
+	Default any
+	Usage   string
+}
+
+// settings are every config key, in the order config show lists them
+var settings = []setting{
+	{"source", "source", "demo", "event source to drive the display (" + strings.Join(events.Names(), ", ") + ")"},
+	{"input", "input", "-", "file to read for the jsonl source (\"-\" for stdin), the journal for the replay source or the scenario for the sim source"},
+	{"follow", "follow", false, "keep reading the input file as it grows"},
+	{"plan", "plan", "", "deployment plan file listing the machines to show up front"},
+	{"resume", "resume", false, "reopen the saved deployment for --resource-group"},
+	{"state_file", "state", DefaultStatePath, "file the azure source's deployment state is saved to and --resume reads"},
+
+	{"azure.subscription_id", "subscription", "", "Azure subscription ID for the azure source"},
+	{"azure.resource_group", "resource-group", "", "Azure resource group for the azure source to poll"},
+	{"azure.poll_interval", "poll-interval", 10 * time.Second, "time between polls for the azure source"}, //nolint:gomnd
+	{"azure.arm_endpoint", "arm-endpoint", "", "override the Azure Resource Manager endpoint"},
+
+	{"speed", "speed", 1.0, "speed multiplier for the replay and sim sources; 0 plays events as fast as possible"},
+	{"seed", "seed", uint64(0), "seed for the sim source (0: the scenario's seed)"},
+	{"replay_step", "replay-step", false, "advance the replay source one event at a time with 'n'"},
+
+	{"headless", "headless", false, "print plain-text state transitions instead of the TUI (default when stdout is not a terminal and a source is chosen)"},
+	{"summary_interval", "summary-interval", 30 * time.Second, "time between summaries in headless mode"}, //nolint:gomnd
+	{"record", "record", "", "journal file to record every message the display receives to"},
+	{"report", "report", "", "comma-separated files to write the final report to; the format comes from the extension (.json, .csv, .md)"},
+	{"api", "api", "", "serve the deployment over HTTP on a localhost host:port or unix:<socket path>"},
+	{"metrics", "metrics", "", "serve Prometheus metrics at /metrics on a localhost host:port or unix:<socket path>"},
+
+	{"theme.name", "theme", "", "colour theme: " + strings.Join(ThemeNames(), ", ") + " (empty: " + DefaultThemeName + "); NO_COLOR disables colour"},
+	{"glyphs", "glyphs", "", "symbols for states: " + strings.Join(models.GlyphSetNames(), ", ") + " (empty: detected from the locale and terminal)"},
+
+	{"log.level", "log-level", "info", "diagnostic log level: debug, info, warn or error"},
+	{"log.format", "log-format", logger.FormatText, "diagnostic log format: text or json"},
+	{"log.file", "log-file", LogFilePath, "diagnostic log file"},
+	{"log.max_size_mb", "log-max-size", 10, "size in MB the diagnostic log is rotated at; 0 never rotates"}, //nolint:gomnd
+	{"log.max_backups", "log-max-backups", 3, "number of rotated diagnostic logs kept"},                     //nolint:gomnd
+	{"display.tick_interval", "tick-interval", TickerInterval, "time between redraws of the display"},
+	{"display.log_lines", "log-lines", LogLines, "height of the log pane in lines, including its title"},
+	{"display.status_width", "status-width", models.StatusLength, "width of the status column, which status messages are cut to"},
+	{"display.debug", "debug-display", false, "show layout debugging information in the display"},
+	{"display.column_widths", "", map[string]any{}, "widths of table columns by name, e.g. location: 12 (config file only)"},
+}
+
+// legacyEnv are the environment variables from before the BTE_ prefix, and
+// the values they give their keys when set as they used to be. They are
+// still honoured, below the BTE_ variables but above the config file.
+var legacyEnv = []struct {
+	Name  string
+	Key   string
+	Value func(string) (any, bool)
+}{
+	{"EMOJIS_ENABLED", "glyphs", func(v string) (any, bool) { return models.GlyphSetEmoji, v == "true" }},
+	{"DEBUG_CHANNELS", "log.level", func(v string) (any, bool) { return "debug", v == "1" }},
+	{"DEBUG_DISPLAY", "display.debug", func(v string) (any, bool) { return true, v == "1" }},
+	{"AZURE_SUBSCRIPTION_ID", "azure.subscription_id", func(v string) (any, bool) { return v, v != "" }},
+}
+
+// configFlags is the command line, with a flag for each setting
+func configFlags() *pflag.FlagSet {
+	fs := pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	fs.SortFlags = false
+	fs.String("config", DefaultConfigPath, "config file holding settings (env: "+EnvPrefix+"_CONFIG)")
+	for _, s := range settings {
+		if s.Flag == "" {
+			continue
+		}
+		usage := s.Usage + " (env: " + envName(s.Key) + ")"
+		switch def := s.Default.(type) {
+		case string:
+			fs.String(s.Flag, def, usage)
+		case bool:
+			fs.Bool(s.Flag, def, usage)
+		case int:
+			fs.Int(s.Flag, def, usage)
+		case uint64:
+			fs.Uint64(s.Flag, def, usage)
+		case float64:
+			fs.Float64(s.Flag, def, usage)
+		case time.Duration:
+			fs.Duration(s.Flag, def, usage)
+		}
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n       %s [flags] config show\n\nFlags:\n", os.Args[0], os.Args[0])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// settingFlag is the flag that sets key, or "" if it has none
+func settingFlag(key string) string {
+	for _, s := range settings {
+		if s.Key == key {
+			return s.Flag
+		}
+	}
+	return ""
+}
+
+// envName is the environment variable that sets key
+func envName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configLoader reads the settings. They are never written back; deployment
+// state goes to the state file, through a viper instance of its own.
+type configLoader struct {
+	v      *viper.Viper
+	flags  *pflag.FlagSet
+	legacy map[string]string
+}
+
+// loadConfig parses args and reads the settings. The config file is read if
+// it exists. It returns the remaining positional arguments.
+func loadConfig(args []string) (*Config, *configLoader, []string, error) {
+	fs := configFlags()
+	if err := fs.Parse(longFlagArgs(args)); err != nil {
+		return nil, nil, nil, err
+	}
+
+	l := &configLoader{v: viper.New(), flags: fs, legacy: map[string]string{}}
+	l.v.SetEnvPrefix(EnvPrefix)
+	l.v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if err := l.v.BindPFlag("config", fs.Lookup("config")); err != nil {
+		return nil, nil, nil, err
+	}
+	_ = l.v.BindEnv("config")
+	for _, s := range settings {
+		l.v.SetDefault(s.Key, s.Default)
+		_ = l.v.BindEnv(s.Key)
+		if s.Flag != "" {
+			if err := l.v.BindPFlag(s.Key, fs.Lookup(s.Flag)); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	for _, env := range legacyEnv {
+		value, ok := env.Value(os.Getenv(env.Name))
+		if !ok {
+			continue
+		}
+		l.legacy[env.Key] = env.Name
+		// viper can't bind a variable whose value needs converting, and Set
+		// ranks above everything, so it is only used when the flag and the
+		// BTE_ variable are unset
+		if _, set := os.LookupEnv(envName(env.Key)); !set && !l.flags.Changed(settingFlag(env.Key)) {
+			l.v.Set(env.Key, value)
+		}
+	}
+
+	path := l.v.GetString("config")
+	l.v.SetConfigFile(path)
+	if _, err := os.Stat(path); err == nil {
+		if err := l.v.ReadInConfig(); err != nil {
+			return nil, nil, nil, fmt.Errorf("reading config file: %w", err)
+		}
+	}
+
+	cfg, err := l.config()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, l, fs.Args(), nil
+}
+
+// longFlagArgs rewrites single-dash flags such as -source demo, which the
+// standard flag package used to accept, as --source demo
+func longFlagArgs(args []string) []string {
+	rewritten := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			copy(rewritten[i:], args[i:])
+			break
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && len(name) > 1 && unicode.IsLetter(rune(name[0])) {
+			arg = "-" + arg
+		}
+		rewritten[i] = arg
+	}
+	return rewritten
+}
+
+// config is the typed configuration, validated
+func (l *configLoader) config() (*Config, error) {
+	v := l.v
+	cfg := &Config{
+		ConfigFile: v.GetString("config"),
+		Source:     v.GetString("source"),
+		Input:      v.GetString("input"),
+		Follow:     v.GetBool("follow"),
+		Plan:       v.GetString("plan"),
+		Resume:     v.GetBool("resume"),
+		StateFile:  v.GetString("state_file"),
+		Azure: AzureConfig{
+			SubscriptionID: v.GetString("azure.subscription_id"),
+			ResourceGroup:  v.GetString("azure.resource_group"),
+			PollInterval:   v.GetDuration("azure.poll_interval"),
+			ARMEndpoint:    v.GetString("azure.arm_endpoint"),
+		},
+		Speed:           v.GetFloat64("speed"),
+		Seed:            v.GetUint64("seed"),
+		ReplayStep:      v.GetBool("replay_step"),
+		Headless:        v.GetBool("headless"),
+		SummaryInterval: v.GetDuration("summary_interval"),
+		Record:          v.GetString("record"),
+		API:             v.GetString("api"),
+		Metrics:         v.GetString("metrics"),
+		Theme:           v.GetString("theme.name"),
+		Glyphs:          v.GetString("glyphs"),
+		Log: LogConfig{
+			Level:      v.GetString("log.level"),
+			Format:     v.GetString("log.format"),
+			File:       v.GetString("log.file"),
+			MaxSizeMB:  v.GetInt("log.max_size_mb"),
+			MaxBackups: v.GetInt("log.max_backups"),
+		},
+		Display: DisplayConfig{
+			TickInterval: v.GetDuration("display.tick_interval"),
+			LogLines:     v.GetInt("display.log_lines"),
+			StatusWidth:  v.GetInt("display.status_width"),
+			Debug:        v.GetBool("display.debug"),
+		},
+	}
+	for _, path := range strings.Split(v.GetString("report"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			cfg.Report = append(cfg.Report, path)
+		}
+	}
+	// theme may also be just the theme's name
+	if name, ok := v.Get("theme").(string); ok && cfg.Theme == "" {
+		cfg.Theme = name
+	}
+	if err := v.UnmarshalKey("display.column_widths", &cfg.Display.ColumnWidths); err != nil {
+		return nil, fmt.Errorf("display.column_widths: %w", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validate reports every invalid setting at once
+func (c *Config) validate() error {
+	var errs []error
+	invalid := func(key string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+
+	if !contains(events.Names(), c.Source) {
+		invalid("source", "unknown event source %q (available: %s)", c.Source, strings.Join(events.Names(), ", "))
+	}
+	if c.Resume && c.Azure.ResourceGroup == "" {
+		invalid("resume", "needs azure.resource_group (--resource-group)")
+	}
+	if c.StateFile == "" {
+		invalid("state_file", "must not be empty")
+	}
+	if c.Azure.PollInterval <= 0 {
+		invalid("azure.poll_interval", "must be positive, got %s", c.Azure.PollInterval)
+	}
+	if c.Speed < 0 {
+		invalid("speed", "must not be negative, got %g", c.Speed)
+	}
+	if c.SummaryInterval <= 0 {
+		invalid("summary_interval", "must be positive, got %s", c.SummaryInterval)
+	}
+	for _, path := range c.Report {
+		if err := report.CheckPath(path); err != nil {
+			invalid("report", "%v", err)
+		}
+	}
+	if c.Theme != "" && !contains(ThemeNames(), strings.ToLower(c.Theme)) {
+		invalid("theme.name", "unknown theme %q (available: %s)", c.Theme, strings.Join(ThemeNames(), ", "))
+	}
+	if c.Glyphs != "" {
+		if _, err := models.LookupGlyphSet(c.Glyphs); err != nil {
+			invalid("glyphs", "%v", err)
+		}
+	}
+
+	if _, err := logger.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+	if c.Log.Format != logger.FormatText && c.Log.Format != logger.FormatJSON {
+		invalid("log.format", "unknown log format %q (available: %s, %s)", c.Log.Format, logger.FormatText, logger.FormatJSON)
+	}
+	if c.Log.File == "" {
+		invalid("log.file", "must not be empty")
+	}
+	if c.Log.MaxSizeMB < 0 {
+		invalid("log.max_size_mb", "must not be negative, got %d", c.Log.MaxSizeMB)
+	}
+	if c.Log.MaxBackups < 0 {
+		invalid("log.max_backups", "must not be negative, got %d", c.Log.MaxBackups)
+	}
+
+	if c.Display.TickInterval <= 0 {
+		invalid("display.tick_interval", "must be positive, got %s", c.Display.TickInterval)
+	}
+	if c.Display.LogLines < 2 { //nolint:gomnd
+		invalid("display.log_lines", "must be at least 2 to fit the title and a line, got %d", c.Display.LogLines)
+	}
+	if c.Display.StatusWidth < 4 { //nolint:gomnd
+		invalid("display.status_width", "must be at least 4, got %d", c.Display.StatusWidth)
+	}
+	names := make([]string, 0, len(c.Display.ColumnWidths))
+	for name := range c.Display.ColumnWidths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := "display.column_widths." + name
+		if displayColumnIndex(name) < 0 {
+			invalid(key, "unknown column (available: %s)", strings.Join(displayColumnNames(), ", "))
+		} else if width := c.Display.ColumnWidths[name]; width <= 0 {
+			invalid(key, "must be positive, got %d", width)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// columnName is a column's name in display.column_widths: its title in
+// lower case with spaces as underscores
+func columnName(column DisplayColumn) string {
+	return strings.ToLower(strings.ReplaceAll(column.TextTitle, " ", "_"))
+}
+
+// displayColumnNames are the names of the titled display columns
+func displayColumnNames() []string {
+	var names []string
+	for _, column := range DisplayColumns {
+		if column.TextTitle != "" {
+			names = append(names, columnName(column))
+		}
+	}
+	return names
+}
+
+func displayColumnIndex(name string) int {
+	for i, column := range DisplayColumns {
+		if column.TextTitle != "" && columnName(column) == strings.ToLower(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyDisplay sets the display's package settings from the config. It must
+// run before the model is created.
+func (c *Config) applyDisplay() {
+	TickerInterval = c.Display.TickInterval
+	LogLines = c.Display.LogLines
+	models.StatusLength = c.Display.StatusWidth
+	DisplayColumns[displayColumnIndex("status")].Width = c.Display.StatusWidth
+	for name, width := range c.Display.ColumnWidths {
+		column := &DisplayColumns[displayColumnIndex(name)]
+		column.Width = width
+		if column.flexible() {
+			column.MinWidth = min(column.MinWidth, width)
+			column.MaxWidth = max(column.MaxWidth, width)
+		}
+	}
+}
+
+// loggerOptions converts the log settings for logger.Init
+func (c *Config) loggerOptions() (logger.Options, error) {
+	level, err := logger.ParseLevel(c.Log.Level)
+	if err != nil {
+		return logger.Options{}, err
+	}
+	return logger.Options{
+		Path:       c.Log.File,
+		Level:      level,
+		Format:     c.Log.Format,
+		MaxSize:    int64(c.Log.MaxSizeMB) << 20, //nolint:gomnd
+		MaxBackups: c.Log.MaxBackups,
+	}, nil
+}
+
+// source says where the effective value of key came from
+func (l *configLoader) source(key, flag string) string {
+	if flag != "" && l.flags.Changed(flag) {
+		return "flag --" + flag
+	}
+	if _, ok := os.LookupEnv(envName(key)); ok {
+		return "env " + envName(key)
+	}
+	if name, ok := l.legacy[key]; ok {
+		return "env " + name + " (deprecated)"
+	}
+	if l.v.InConfig(key) {
+		return "file " + l.v.ConfigFileUsed()
+	}
+	return "default"
+}
+
+// showConfig prints every setting with its effective value and where it
+// came from, followed by the theme colours and keys set in the config file
+func (l *configLoader) showConfig(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:gomnd
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	fmt.Fprintf(tw, "config\t%s\t%s\n", l.v.GetString("config"), l.source("config", "config"))
+	for _, s := range settings {
+		value, source := l.v.Get(s.Key), l.source(s.Key, s.Flag)
+		// theme may also be just the theme's name
+		if name, ok := l.v.Get("theme").(string); ok && s.Key == "theme.name" && source == "default" {
+			value, source = name, l.source("theme", "")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, formatSetting(value), source)
+	}
+	for _, section := range []string{"theme.colors", "keys"} {
+		names := make([]string, 0)
+		for name := range l.v.GetStringMap(section) {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := section + "." + name
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", key, formatSetting(l.v.Get(key)), l.source(key, ""))
+		}
+	}
+	return tw.Flush()
+}
+
+// formatSetting prints a value the way it would be written in the config
+// file
+func formatSetting(value any) string {
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return `""`
+		}
+		return value
+	case []any:
+		parts := make([]string, len(value))
+		for i, part := range value {
+			parts[i] = formatSetting(part)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case map[string]any:
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = name + ": " + formatSetting(value[name])
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
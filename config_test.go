@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// configFile writes a config file and returns the --config arguments that
+// read it
+func configFile(t *testing.T, contents string) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return []string{"--config", path}
+}
+
+// unsetEnv unsets names for the rest of the test
+func unsetEnv(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		flag       string
+		env        string
+		legacy     bool
+		want       string
+		wantSource string
+	}{
+		{name: "default", want: "info", wantSource: "default"},
+		{name: "file", file: "warn", want: "warn", wantSource: "file"},
+		{name: "legacy env over file", file: "warn", legacy: true, want: "debug", wantSource: "env DEBUG_CHANNELS (deprecated)"},
+		{name: "env over legacy env", file: "warn", legacy: true, env: "error", want: "error", wantSource: "env BTE_LOG_LEVEL"},
+		{name: "flag over env", file: "warn", legacy: true, env: "error", flag: "info", want: "info", wantSource: "flag --log-level"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "BTE_LOG_LEVEL", "DEBUG_CHANNELS")
+			if tt.env != "" {
+				t.Setenv("BTE_LOG_LEVEL", tt.env)
+			}
+			if tt.legacy {
+				t.Setenv("DEBUG_CHANNELS", "1")
+			}
+			contents := ""
+			if tt.file != "" {
+				contents = "log:\n  level: " + tt.file + "\n"
+			}
+			args := configFile(t, contents)
+			if tt.flag != "" {
+				args = append(args, "--log-level", tt.flag)
+			}
+
+			cfg, loaded, _, err := loadConfig(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Log.Level != tt.want {
+				t.Errorf("log level %q, want %q", cfg.Log.Level, tt.want)
+			}
+			if source := loaded.source("log.level", "log-level"); !strings.HasPrefix(source, tt.wantSource) {
+				t.Errorf("source %q, want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		file     string
+		wantErrs []string
+	}{
+		{name: "valid", args: []string{"--source", "sim", "--speed", "0"}},
+		{name: "unknown source", args: []string{"--source", "carrier-pigeon"}, wantErrs: []string{`source: unknown event source "carrier-pigeon"`}},
+		{name: "resume without a resource group", args: []string{"--resume"}, wantErrs: []string{"resume: needs azure.resource_group"}},
+		{
+			name:     "every error at once",
+			args:     []string{"--speed", "-1", "--log-level", "loud", "--log-lines", "1"},
+			wantErrs: []string{"speed: must not be negative", "log.level:", "display.log_lines: must be at least 2"},
+		},
+		{
+			name:     "column widths",
+			file:     "display:\n  column_widths:\n    nope: 3\n    location: 0\n",
+			wantErrs: []string{"display.column_widths.location: must be positive", "display.column_widths.nope: unknown column"},
+		},
+		{name: "unknown theme", file: "theme: sepia\n", wantErrs: []string{`theme.name: unknown theme "sepia"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := loadConfig(append(configFile(t, tt.file), tt.args...))
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestShowConfig(t *testing.T) {
+	unsetEnv(t, "BTE_SPEED", "BTE_SOURCE", "BTE_THEME_NAME", "AZURE_SUBSCRIPTION_ID")
+	t.Setenv("BTE_SEED", "7")
+	args := append(configFile(t, "speed: 2\ntheme: light\nkeys:\n  group: G\n"), "--source", "sim")
+	_, loaded, _, err := loadConfig(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := loaded.showConfig(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n")[1:] {
+		fields := strings.Fields(line)
+		rows[fields[0]] = fields[1:]
+	}
+	file := "file " + args[1]
+	for key, want := range map[string]string{
+		"source":                "sim flag --source",
+		"seed":                  "7 env BTE_SEED",
+		"speed":                 "2 " + file,
+		"theme.name":            "light " + file,
+		"keys.group":            "G " + file,
+		"azure.subscription_id": `"" default`,
+	} {
+		if got := strings.Join(rows[key], " "); got != want {
+			t.Errorf("%s shows %q, want %q", key, got, want)
+		}
+	}
+}
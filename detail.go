@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// noSelection means no table row is selected
+const noSelection = -1
+
+// moveSelection moves the selection by delta rows, clamped to the table.
+// Group headers are selectable; the members of collapsed groups are skipped.
+func (m *DisplayModel) moveSelection(delta int) {
+	rows := m.tableRows()
+	if len(rows) == 0 {
+		m.SelectedRow = noSelection
+		m.SelectedGroup = ""
+		return
+	}
+
+	position := noSelection
+	for i, row := range rows {
+		if m.selected(row) {
+			position = i
+			break
+		}
+	}
+	if position == noSelection {
+		position = 0
+	} else {
+		position = min(max(position+delta, 0), len(rows)-1)
+	}
+
+	if row := rows[position]; row.group != nil {
+		m.SelectedGroup = row.group.Name
+		m.SelectedRow = noSelection
+	} else {
+		m.SelectedGroup = ""
+		m.SelectedRow = row.machine
+	}
+}
+
+// selectedMachine returns the machine on the selected row, if any
+func (m *DisplayModel) selectedMachine() (*models.Machine, bool) {
+	if m.SelectedRow < 0 || m.SelectedRow >= len(m.Deployment.Machines) {
+		return nil, false
+	}
+	return &m.Deployment.Machines[m.SelectedRow], true
+}
+
+// renderDetailPane lists every required resource of the selected machine
+// with its state, value and the time the state last changed
+func (m *DisplayModel) renderDetailPane() string {
+	machine, ok := m.selectedMachine()
+	if !ok {
+		return ""
+	}
+
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(ActiveTheme.Header)
+	paneStyle := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ActiveTheme.Accent).
+		Padding(0, 1)
+
+	progress, total := machine.ResourcesComplete()
+	lines := []string{
+		titleStyle.Render(fmt.Sprintf("%s (%s) - %d/%d resources complete",
+			machine.Name, machine.Location, progress, total)),
+		fmt.Sprintf("%-6s %-12s %-24s %s", "Type", "State", "Value", "Changed"),
+	}
+	for _, resourceType := range machine.RequiredResources() {
+		resource := machine.GetResource(resourceType.ResourceString)
+		state := resource.ResourceState
+		if state == models.AzureResourceStateUnknown {
+			state = models.AzureResourceStateNotStarted
+		}
+		changed := "-"
+		if !resource.UpdatedAt.IsZero() {
+			changed = resource.UpdatedAt.Format("15:04:05")
+		}
+		value := resource.ResourceValue
+		if value == "" {
+			value = "-"
+		}
+		line := fmt.Sprintf("%-6s %-12s %-24s %s",
+			resourceType.ShortResourceName, state, value, changed)
+		lines = append(lines, resourceStateStyle(state).Render(line))
+	}
+
+	return paneStyle.Render(strings.Join(lines, "\n"))
+}
+
+func resourceStateStyle(state models.AzureResourceState) lipgloss.Style {
+	style := lipgloss.NewStyle()
+	switch state {
+	case models.AzureResourceStateSucceeded:
+		return style.Foreground(ActiveTheme.Success)
+	case models.AzureResourceStateFailed:
+		return style.Foreground(ActiveTheme.Failure).Bold(true)
+	case models.AzureResourceStatePending, models.AzureResourceStateRunning:
+		return style.Foreground(ActiveTheme.Pending)
+	}
+	return style
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// threeMachines has abc01-vm to abc03-vm and nothing selected
+func threeMachines() *DisplayModel {
+	m := InitialModel()
+	for _, name := range []string{"abc01-vm", "abc02-vm", "abc03-vm"} {
+		m.UpdateStatus(models.NewDisplayVMStatus(name, models.AzureResourceStatePending))
+	}
+	return m
+}
+
+func TestMoveSelection(t *testing.T) {
+	m := threeMachines()
+	if _, ok := m.selectedMachine(); ok {
+		t.Fatal("a machine is selected before any key press")
+	}
+
+	// The first move selects the first row, whichever way it goes
+	for _, step := range []struct {
+		delta int
+		want  int
+	}{{-1, 0}, {1, 1}, {1, 2}, {1, 2}, {-5, 0}} {
+		m.moveSelection(step.delta)
+		if m.SelectedRow != step.want {
+			t.Fatalf("moved %d to row %d, want %d", step.delta, m.SelectedRow, step.want)
+		}
+	}
+	if machine, ok := m.selectedMachine(); !ok || machine.Name != "abc01-vm" {
+		t.Errorf("selected %v, want abc01-vm", machine)
+	}
+
+	empty := InitialModel()
+	empty.moveSelection(1)
+	if empty.SelectedRow != noSelection {
+		t.Errorf("selected row %d in an empty table", empty.SelectedRow)
+	}
+}
+
+func TestSelectionKeys(t *testing.T) {
+	m := threeMachines()
+	for _, press := range []string{"down", "j", "j"} {
+		m.Update(key(press))
+	}
+	if m.SelectedRow != 2 {
+		t.Fatalf("selected row %d, want 2", m.SelectedRow)
+	}
+	m.Update(key("enter"))
+	if !m.DetailExpanded {
+		t.Fatal("enter didn't show the details")
+	}
+	m.Update(key("esc"))
+	if m.DetailExpanded {
+		t.Error("esc didn't hide the details")
+	}
+}
+
+func detailLine(t *testing.T, pane, resource string) string {
+	t.Helper()
+	for _, line := range strings.Split(pane, "\n") {
+		if fields := strings.Fields(strings.Trim(line, "│ ")); len(fields) > 0 && fields[0] == resource {
+			return strings.Join(fields, " ")
+		}
+	}
+	t.Fatalf("no %s line in\n%s", resource, pane)
+	return ""
+}
+
+func TestDetailPane(t *testing.T) {
+	m := threeMachines()
+	if pane := m.renderDetailPane(); pane != "" {
+		t.Errorf("detail pane without a selection:\n%s", pane)
+	}
+
+	nic := models.NewDisplayStatus("abc01-vm", "abc01-vm-nic", models.AzureResourceTypeNIC, models.AzureResourceStateSucceeded)
+	nic.ResourceValue = "10.0.0.4"
+	m.UpdateStatus(nic)
+	m.moveSelection(1)
+
+	pane := m.renderDetailPane()
+	if !strings.Contains(pane, "abc01-vm") || !strings.Contains(pane, "1/") {
+		t.Errorf("title missing the machine or its progress:\n%s", pane)
+	}
+	if got := detailLine(t, pane, "NIC"); !strings.HasPrefix(got, "NIC Succeeded 10.0.0.4 ") {
+		t.Errorf("NIC line = %q, want its state and address", got)
+	}
+	if got := detailLine(t, pane, "VM"); got != "VM Pending - "+detailChanged(m, "VM") {
+		t.Errorf("VM line = %q, want no value", got)
+	}
+	if got := detailLine(t, pane, "DISK"); got != "DISK NotStarted - -" {
+		t.Errorf("DISK line = %q, want an untouched resource", got)
+	}
+}
+
+// detailChanged is when the machine's resource last changed, as the detail
+// pane shows it
+func detailChanged(m *DisplayModel, resource string) string {
+	machine, _ := m.selectedMachine()
+	for _, r := range machine.Resources() {
+		if r.ResourceType.ShortResourceName == resource {
+			return r.UpdatedAt.Format("15:04:05")
+		}
+	}
+	return "-"
+}
+
+func TestResourceValueSurvivesUpdatesWithoutOne(t *testing.T) {
+	m := threeMachines()
+	machine := &m.Deployment.Machines[0]
+	// As restored by --resume
+	machine.PutResource(models.MachineResource{
+		ResourceName:  models.AzureResourceTypeIP.ResourceString,
+		ResourceType:  models.AzureResourceTypeIP,
+		ResourceState: models.AzureResourceStateRunning,
+		ResourceValue: "1.2.3.4",
+	})
+
+	m.UpdateStatus(models.NewDisplayStatus("abc01-vm", "abc01-vm-ip", models.AzureResourceTypeIP,
+		models.AzureResourceStateSucceeded))
+	ip := machine.GetResource(models.AzureResourceTypeIP.ResourceString)
+	if ip.ResourceState != models.AzureResourceStateSucceeded || ip.ResourceValue != "1.2.3.4" {
+		t.Errorf("IP = %+v, want it succeeded with the restored address", ip)
+	}
+
+	changed := models.NewDisplayStatus("abc01-vm", "abc01-vm-ip", models.AzureResourceTypeIP,
+		models.AzureResourceStateSucceeded)
+	changed.ResourceValue = "5.6.7.8"
+	m.UpdateStatus(changed)
+	if ip := machine.GetResource(models.AzureResourceTypeIP.ResourceString); ip.ResourceValue != "5.6.7.8" {
+		t.Errorf("IP value = %q, want the new address", ip.ResourceValue)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// GroupMode selects how the table's rows are grouped
+type GroupMode int
+
+const (
+	GroupNone GroupMode = iota
+	GroupByLocation
+	GroupByRole
+	GroupByPhase
+)
+
+func (g GroupMode) String() string {
+	switch g {
+	case GroupByLocation:
+		return "location"
+	case GroupByRole:
+		return "role"
+	case GroupByPhase:
+		return "phase"
+	}
+	return "none"
+}
+
+// next returns the mode the group key switches to
+func (g GroupMode) next() GroupMode {
+	return (g + 1) % (GroupByPhase + 1)
+}
+
+// Machine phases, in the order their groups are shown
+const (
+	phaseProvisioning = "Provisioning"
+	phaseSSH          = "SSH"
+	phaseDocker       = "Docker"
+	phaseCorePackages = "Core packages"
+	phaseBacalhau     = "Bacalhau"
+	phaseComplete     = "Complete"
+	phaseFailed       = "Failed"
+)
+
+var phaseOrder = []string{
+	phaseProvisioning, phaseSSH, phaseDocker, phaseCorePackages, phaseBacalhau, phaseComplete, phaseFailed,
+}
+
+// machinePhase is the step a machine is currently waiting on
+func machinePhase(machine *models.Machine) string {
+	switch {
+	case machine.Failed():
+		return phaseFailed
+	case machine.Complete():
+		return phaseComplete
+	}
+	if progress, total := machine.ResourcesComplete(); progress < total {
+		return phaseProvisioning
+	}
+	services := []struct {
+		phase string
+		state models.ServiceState
+	}{
+		{phaseSSH, machine.SSH},
+		{phaseDocker, machine.Docker},
+		{phaseCorePackages, machine.CorePackages},
+		{phaseBacalhau, machine.Bacalhau},
+	}
+	for _, service := range services {
+		if service.state != models.ServiceStateSucceeded {
+			return service.phase
+		}
+	}
+	return phaseComplete
+}
+
+// machineGroup is a set of machines shown under one header row
+type machineGroup struct {
+	Name string
+	// Machines are indexes into Deployment.Machines, in deployment order
+	Machines []int
+}
+
+// machineGroups splits the deployment's machines into groups for the
+// current mode. Locations are in the order they first appear.
+func (m *DisplayModel) machineGroups() []machineGroup {
+	if m.Grouping == GroupNone {
+		return nil
+	}
+
+	var order []string
+	switch m.Grouping {
+	case GroupByRole:
+		order = []string{"Orchestrator", "Worker"}
+	case GroupByPhase:
+		order = phaseOrder
+	}
+	members := map[string][]int{}
+	for i := range m.Deployment.Machines {
+		machine := &m.Deployment.Machines[i]
+		if machine.Name == "" {
+			continue
+		}
+		var name string
+		switch m.Grouping {
+		case GroupByLocation:
+			name = machine.Location
+			if name == "" {
+				name = "(no location)"
+			}
+			if _, seen := members[name]; !seen {
+				order = append(order, name)
+			}
+		case GroupByRole:
+			name = "Worker"
+			if machine.Orchestrator {
+				name = "Orchestrator"
+			}
+		case GroupByPhase:
+			name = machinePhase(machine)
+		}
+		members[name] = append(members[name], i)
+	}
+
+	groups := make([]machineGroup, 0, len(order))
+	for _, name := range order {
+		if len(members[name]) > 0 {
+			groups = append(groups, machineGroup{Name: name, Machines: members[name]})
+		}
+	}
+	return groups
+}
+
+// tableRow is one row of the table body: a group header or a machine
+type tableRow struct {
+	group   *machineGroup
+	machine int
+}
+
+// tableRows lists the rows the table shows, leaving out the members of
+// collapsed groups
+func (m *DisplayModel) tableRows() []tableRow {
+	groups := m.machineGroups()
+	if groups == nil {
+		rows := make([]tableRow, 0, len(m.Deployment.Machines))
+		for i, machine := range m.Deployment.Machines {
+			if machine.Name != "" {
+				rows = append(rows, tableRow{machine: i})
+			}
+		}
+		return rows
+	}
+
+	var rows []tableRow
+	for i := range groups {
+		group := &groups[i]
+		rows = append(rows, tableRow{group: group})
+		if m.collapsed[group.Name] {
+			continue
+		}
+		for _, machine := range group.Machines {
+			rows = append(rows, tableRow{machine: machine})
+		}
+	}
+	return rows
+}
+
+// selected reports whether row is the selected row
+func (m *DisplayModel) selected(row tableRow) bool {
+	if row.group != nil {
+		return row.group.Name == m.SelectedGroup
+	}
+	return m.SelectedGroup == "" && row.machine == m.SelectedRow
+}
+
+// cycleGrouping switches to the next group mode. Groups start expanded.
+func (m *DisplayModel) cycleGrouping() {
+	m.Grouping = m.Grouping.next()
+	m.collapsed = map[string]bool{}
+	if m.SelectedGroup != "" {
+		m.SelectedGroup = ""
+		m.SelectedRow = noSelection
+	}
+}
+
+// toggleGroup collapses or expands the selected group
+func (m *DisplayModel) toggleGroup() {
+	if m.SelectedGroup == "" {
+		return
+	}
+	m.collapsed[m.SelectedGroup] = !m.collapsed[m.SelectedGroup]
+}
+
+// toggleAllGroups collapses every group, or expands them all if they are
+// already collapsed. A selected machine that is hidden hands the selection
+// to its group's header.
+func (m *DisplayModel) toggleAllGroups() {
+	groups := m.machineGroups()
+	allCollapsed := true
+	for _, group := range groups {
+		if !m.collapsed[group.Name] {
+			allCollapsed = false
+		}
+	}
+	for _, group := range groups {
+		m.collapsed[group.Name] = !allCollapsed
+		if allCollapsed || m.SelectedGroup != "" {
+			continue
+		}
+		for _, machine := range group.Machines {
+			if machine == m.SelectedRow {
+				m.SelectedGroup = group.Name
+				m.SelectedRow = noSelection
+			}
+		}
+	}
+}
+
+// machineElapsed is the time from the machine's first event until it
+// finished, or until now. Planned machines have no start time until their
+// first event arrives.
+func machineElapsed(machine *models.Machine) time.Duration {
+	if machine.StartTime.IsZero() {
+		return 0
+	}
+	end := machine.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(machine.StartTime).Truncate(TickerInterval)
+}
+
+// serviceSummary rolls a machine's services up into one state: failed if
+// any failed, succeeded once all have, not started if none has begun and
+// updating otherwise
+func serviceSummary(machine *models.Machine) models.ServiceState {
+	states := []models.ServiceState{machine.SSH, machine.Docker, machine.CorePackages, machine.Bacalhau}
+	succeeded, started := 0, 0
+	for _, state := range states {
+		switch state {
+		case models.ServiceStateFailed:
+			return models.ServiceStateFailed
+		case models.ServiceStateSucceeded:
+			succeeded++
+			started++
+		case models.ServiceStateCreated, models.ServiceStateUpdating:
+			started++
+		}
+	}
+	switch {
+	case succeeded == len(states):
+		return models.ServiceStateSucceeded
+	case started == 0:
+		return models.ServiceStateNotStarted
+	}
+	return models.ServiceStateUpdating
+}
+
+// groupSummaryStates is the order service state counts appear in a group
+// header
+var groupSummaryStates = []models.ServiceState{
+	models.ServiceStateSucceeded,
+	models.ServiceStateUpdating,
+	models.ServiceStateNotStarted,
+	models.ServiceStateFailed,
+}
+
+// getGroupRowData is the header row of a group: its member count and
+// machines per service state, the combined resource progress and the
+// slowest member's elapsed time
+func (m *DisplayModel) getGroupRowData(group *machineGroup) []string {
+	counts := map[models.ServiceState]int{}
+	progress, total := 0, 0
+	var slowest time.Duration
+	for _, index := range group.Machines {
+		machine := &m.Deployment.Machines[index]
+		counts[serviceSummary(machine)]++
+		done, required := machine.ResourcesComplete()
+		progress += done
+		total += required
+		slowest = max(slowest, machineElapsed(machine))
+	}
+
+	summary := []string{fmt.Sprintf("%d:", len(group.Machines))}
+	for _, state := range groupSummaryStates {
+		if counts[state] > 0 {
+			summary = append(summary, fmt.Sprintf("%s%d", symbol(models.ServiceStateGlyph(state)), counts[state]))
+		}
+	}
+
+	marker := models.GlyphGroupExpanded
+	if m.collapsed[group.Name] {
+		marker = models.GlyphGroupCollapsed
+	}
+
+	row := make([]string, len(m.columns))
+	row[columnIndex(m.columns, "Name")] = symbol(marker) + " " + group.Name
+	row[columnIndex(m.columns, "Status")] = strings.Join(summary, " ")
+	row[columnIndex(m.columns, "Progress")] = renderProgressBar(
+		progress,
+		total,
+		m.columns[columnIndex(m.columns, "Progress")].Width-ProgressBarPadding,
+	)
+	row[columnIndex(m.columns, "Time")] = formatElapsedTime(slowest)
+	return row
+}
+
+// groupStyle is the style of a group header row
+func groupStyle(style lipgloss.Style) lipgloss.Style {
+	return style.Bold(true).Foreground(ActiveTheme.Header)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// provisioned marks every resource the machine needs as created
+func provisioned(machine *models.Machine) {
+	for _, resource := range machine.RequiredResources() {
+		machine.SetResource(resource.ResourceString, models.AzureResourceStateSucceeded, "")
+	}
+}
+
+// groupedMachines has an orchestrator in eastus on Docker, a worker in westus
+// still provisioning, a finished worker in eastus and a failed worker with no
+// location
+func groupedMachines() *DisplayModel {
+	m := InitialModel()
+	m.Deployment.Machines = []models.Machine{
+		{Name: "abc01-vm", Location: "eastus", Orchestrator: true, SSH: models.ServiceStateSucceeded, Docker: models.ServiceStateUpdating},
+		{Name: "abc02-vm", Location: "westus"},
+		{
+			Name: "abc03-vm", Location: "eastus",
+			SSH: models.ServiceStateSucceeded, Docker: models.ServiceStateSucceeded,
+			CorePackages: models.ServiceStateSucceeded, Bacalhau: models.ServiceStateSucceeded,
+		},
+		{Name: "abc04-vm", SSH: models.ServiceStateFailed},
+	}
+	provisioned(&m.Deployment.Machines[0])
+	provisioned(&m.Deployment.Machines[2])
+	return m
+}
+
+func TestMachineGroups(t *testing.T) {
+	tests := []struct {
+		mode GroupMode
+		want []machineGroup
+	}{
+		{GroupNone, nil},
+		{GroupByLocation, []machineGroup{{"eastus", []int{0, 2}}, {"westus", []int{1}}, {"(no location)", []int{3}}}},
+		{GroupByRole, []machineGroup{{"Orchestrator", []int{0}}, {"Worker", []int{1, 2, 3}}}},
+		{GroupByPhase, []machineGroup{{"Provisioning", []int{1}}, {"Docker", []int{0}}, {"Complete", []int{2}}, {"Failed", []int{3}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode.String(), func(t *testing.T) {
+			m := groupedMachines()
+			m.Grouping = tt.mode
+			if got := m.machineGroups(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// rowNames names the table's rows, groups in brackets
+func rowNames(m *DisplayModel) []string {
+	var names []string
+	for _, row := range m.tableRows() {
+		if row.group != nil {
+			names = append(names, "["+row.group.Name+"]")
+		} else {
+			names = append(names, m.Deployment.Machines[row.machine].Name)
+		}
+	}
+	return names
+}
+
+func TestCollapsingGroups(t *testing.T) {
+	m := groupedMachines()
+	m.Grouping = GroupByRole
+	m.SelectedRow = 2
+
+	m.SelectedGroup = "Orchestrator"
+	m.toggleGroup()
+	if want := []string{"[Orchestrator]", "[Worker]", "abc02-vm", "abc03-vm", "abc04-vm"}; !reflect.DeepEqual(rowNames(m), want) {
+		t.Errorf("rows %v, want %v", rowNames(m), want)
+	}
+
+	// Collapsing the rest hands the selected machine's row to its header
+	m.SelectedGroup = ""
+	m.toggleAllGroups()
+	if want := []string{"[Orchestrator]", "[Worker]"}; !reflect.DeepEqual(rowNames(m), want) {
+		t.Errorf("rows %v, want %v", rowNames(m), want)
+	}
+	if m.SelectedGroup != "Worker" || m.SelectedRow != noSelection {
+		t.Errorf("selected group %q and row %d, want the Worker header", m.SelectedGroup, m.SelectedRow)
+	}
+
+	m.toggleAllGroups()
+	if len(rowNames(m)) != 6 {
+		t.Errorf("rows %v, want every group expanded", rowNames(m))
+	}
+}
+
+func TestCycleGrouping(t *testing.T) {
+	m := groupedMachines()
+	var modes []GroupMode
+	for range 4 {
+		m.cycleGrouping()
+		modes = append(modes, m.Grouping)
+	}
+	if want := []GroupMode{GroupByLocation, GroupByRole, GroupByPhase, GroupNone}; !reflect.DeepEqual(modes, want) {
+		t.Errorf("modes %v, want %v", modes, want)
+	}
+
+	// A new mode starts expanded, without the old mode's header selected
+	m.cycleGrouping()
+	m.SelectedGroup = "eastus"
+	m.toggleGroup()
+	m.cycleGrouping()
+	if len(m.collapsed) != 0 || m.SelectedGroup != "" {
+		t.Errorf("collapsed %v, selected group %q after switching mode", m.collapsed, m.SelectedGroup)
+	}
+}
+
+func TestServiceSummary(t *testing.T) {
+	m := groupedMachines()
+	want := []models.ServiceState{
+		models.ServiceStateUpdating, models.ServiceStateNotStarted, models.ServiceStateSucceeded, models.ServiceStateFailed,
+	}
+	for i, state := range want {
+		if got := serviceSummary(&m.Deployment.Machines[i]); got != state {
+			t.Errorf("%s rolls up to %s, want %s", m.Deployment.Machines[i].Name, got, state)
+		}
+	}
+}
+
+func TestGroupRowCounts(t *testing.T) {
+	m := groupedMachines()
+	m.Grouping = GroupByRole
+	groups := m.machineGroups()
+	status := columnIndex(m.columns, "Status")
+	want := map[string]string{
+		"Orchestrator": fmt.Sprintf("1: %s1", symbol(models.GlyphWaiting)),
+		"Worker": fmt.Sprintf("3: %s1 %s1 %s1",
+			symbol(models.GlyphSucceeded), symbol(models.GlyphNotStarted), symbol(models.GlyphFailed)),
+	}
+	for i := range groups {
+		if got := m.getGroupRowData(&groups[i])[status]; got != want[groups[i].Name] {
+			t.Errorf("%s header status %q, want %q", groups[i].Name, got, want[groups[i].Name])
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// chanSender delivers event source messages over a channel, standing in for
+// *tea.Program when there is no terminal
+type chanSender struct {
+	ctx  context.Context
+	msgs chan tea.Msg
+	// pending counts commands whose result has not been received yet. It is
+	// only touched by the runHeadless loop.
+	pending int
+}
+
+// cmdResultMsg wraps the result of a command started by chanSender.run
+type cmdResultMsg struct {
+	msg tea.Msg
+}
+
+func (s *chanSender) Send(msg tea.Msg) {
+	select {
+	case s.msgs <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// run executes cmd off the main loop and delivers its result back to it,
+// the way tea.Program does
+func (s *chanSender) run(cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+	s.pending++
+	go func() {
+		s.Send(cmdResultMsg{msg: cmd()})
+	}()
+}
+
+// machineSnapshot is the part of a machine's state whose changes are printed
+// in headless mode
+type machineSnapshot struct {
+	exists    bool
+	services  []models.ServiceState
+	resources map[string]models.AzureResourceState
+	// required is the short names of the machine's required resources, in
+	// display order
+	required []string
+}
+
+var headlessServiceNames = []string{"SSH", "Docker", "CorePackages", "Bacalhau"}
+
+// snapshotMachines records the state of every machine, keyed by name. One
+// status can change several machines, e.g. a location's VNET.
+func snapshotMachines(m *DisplayModel) map[string]machineSnapshot {
+	snapshots := make(map[string]machineSnapshot, len(m.Deployment.Machines))
+	for i := range m.Deployment.Machines {
+		machine := &m.Deployment.Machines[i]
+		snapshot := machineSnapshot{
+			exists:    true,
+			services:  []models.ServiceState{machine.SSH, machine.Docker, machine.CorePackages, machine.Bacalhau},
+			resources: make(map[string]models.AzureResourceState),
+		}
+		for _, resource := range machine.Resources() {
+			snapshot.resources[resource.ResourceType.ShortResourceName] = resource.ResourceState
+		}
+		for _, resourceType := range machine.RequiredResources() {
+			snapshot.required = append(snapshot.required, resourceType.ShortResourceName)
+		}
+		snapshots[machine.Name] = snapshot
+	}
+	return snapshots
+}
+
+// printTransitions writes one line per state that differs between before
+// and after, e.g. "testVM3 Docker: Updating -> Succeeded"
+func printTransitions(out io.Writer, name string, before, after machineSnapshot, location string) {
+	if !after.exists {
+		return
+	}
+	if !before.exists {
+		if location != "" {
+			fmt.Fprintf(out, "%s added (%s)\n", name, location)
+		} else {
+			fmt.Fprintf(out, "%s added\n", name)
+		}
+		before.services = make([]models.ServiceState, len(after.services))
+		for i := range before.services {
+			before.services[i] = models.ServiceStateNotStarted
+		}
+	}
+	for i, state := range after.services {
+		if state != before.services[i] {
+			fmt.Fprintf(out, "%s %s: %s -> %s\n", name, headlessServiceNames[i], before.services[i], state)
+		}
+	}
+	for _, short := range after.required {
+		state, ok := after.resources[short]
+		if !ok {
+			continue
+		}
+		previous, seen := before.resources[short]
+		if !seen {
+			previous = models.AzureResourceStateNotStarted
+		}
+		if state != previous {
+			fmt.Fprintf(out, "%s %s: %s -> %s\n", name, short, previous, state)
+		}
+	}
+}
+
+// printChanges prints the transitions of every machine since before
+func printChanges(out io.Writer, m *DisplayModel, before map[string]machineSnapshot) {
+	after := snapshotMachines(m)
+	for _, machine := range m.Deployment.Machines {
+		printTransitions(out, machine.Name, before[machine.Name], after[machine.Name], machine.Location)
+	}
+}
+
+// printSummary writes a one-line count of machines by outcome
+func printSummary(out io.Writer, m *DisplayModel) {
+	complete, failed, inProgress := 0, 0, 0
+	for i := range m.Deployment.Machines {
+		machine := &m.Deployment.Machines[i]
+		switch {
+		case machine.Failed():
+			failed++
+		case machine.Complete():
+			complete++
+		default:
+			inProgress++
+		}
+	}
+	fmt.Fprintf(out, "summary: %d machines, %d complete, %d in progress, %d failed\n",
+		len(m.Deployment.Machines), complete, inProgress, failed)
+}
+
+// allMachinesFinished reports whether every machine is complete or failed
+func allMachinesFinished(m *DisplayModel) bool {
+	if len(m.Deployment.Machines) == 0 {
+		return false
+	}
+	for i := range m.Deployment.Machines {
+		machine := &m.Deployment.Machines[i]
+		if !machine.Complete() && !machine.Failed() {
+			return false
+		}
+	}
+	return true
+}
+
+// anyMachineFailed reports whether any machine has failed
+func anyMachineFailed(m *DisplayModel) bool {
+	for i := range m.Deployment.Machines {
+		if m.Deployment.Machines[i].Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAutoHeadless refuses to fall back to headless mode, because stdout
+// is not a terminal, with a source nobody chose: the default demo never
+// ends, so a piped or CI run would never exit. Naming the source, or asking
+// for --headless, shows the run is meant to be this way.
+func checkAutoHeadless(cfg *Config, terminal, sourceChosen bool) error {
+	if terminal || cfg.Headless || sourceChosen {
+		return nil
+	}
+	return fmt.Errorf("stdout is not a terminal and the default %s source never ends: "+
+		"choose a source with --source, or pass --headless to run it anyway", cfg.Source)
+}
+
+// runHeadless consumes the same messages as the TUI without a terminal,
+// printing one line per state transition and a summary every
+// summaryInterval. It returns when ctx is cancelled or the source runs out
+// of events and every command it started has reported back. When the fleet
+// is known up front (from a plan or a resumed deployment) it also returns
+// once every machine has finished.
+func runHeadless(
+	ctx context.Context,
+	m *DisplayModel,
+	source events.EventSource,
+	out io.Writer,
+	summaryInterval time.Duration,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	sender := &chanSender{ctx: ctx, msgs: make(chan tea.Msg)}
+	if err := source.Start(ctx, sender); err != nil {
+		cancel()
+		return fmt.Errorf("Error starting event source: %v", err)
+	}
+	defer source.Stop() //nolint:errcheck
+	// Unblock any pending Send before waiting for the source to stop
+	defer cancel()
+
+	exitWhenFinished := len(m.Deployment.Machines) > 0
+	summaryTicker := time.NewTicker(summaryInterval)
+	defer summaryTicker.Stop()
+
+	sourceDone := source.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sourceDone:
+			// Stop selecting on the closed channel and drain the commands
+			// that are still running
+			sourceDone = nil
+		case <-summaryTicker.C:
+			printSummary(out, m)
+		case msg := <-sender.msgs:
+			if result, ok := msg.(cmdResultMsg); ok {
+				sender.pending--
+				msg = result.msg
+			}
+			handleHeadlessMsg(out, m, sender, msg)
+			if exitWhenFinished && allMachinesFinished(m) {
+				return nil
+			}
+		}
+		if sourceDone == nil && sender.pending == 0 {
+			return nil
+		}
+	}
+}
+
+// handleHeadlessMsg applies one message to the model and prints what changed
+func handleHeadlessMsg(out io.Writer, m *DisplayModel, sender *chanSender, msg tea.Msg) {
+	m.record(msg)
+	switch msg := msg.(type) {
+	case tea.BatchMsg:
+		for _, cmd := range msg {
+			sender.run(cmd)
+		}
+	case models.StatusUpdateMsg:
+		if msg.Status == nil {
+			return
+		}
+		before := snapshotMachines(m)
+		sender.run(m.UpdateStatus(msg.Status))
+		m.stateDirty = true
+		printChanges(out, m, before)
+		m.saveStateIfDue()
+	case setupStepMsg:
+		before := snapshotMachines(m)
+		sender.run(m.handleSetupStep(msg))
+		m.stateDirty = true
+		printChanges(out, m, before)
+		m.saveStateIfDue()
+	case models.LogLineMsg:
+		m.Logs.Append(LogEntry{
+			Time:    msg.Time,
+			Level:   msg.Level,
+			Machine: msg.Machine,
+			Text:    msg.Text,
+		})
+		line := fmt.Sprintf("%-5s ", msg.Level)
+		if msg.Machine != "" {
+			line += fmt.Sprintf("[%s] ", msg.Machine)
+		}
+		fmt.Fprintln(out, line+msg.Text)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCheckAutoHeadless(t *testing.T) {
+	tests := []struct {
+		name                       string
+		headless, terminal, chosen bool
+		wantErr                    bool
+	}{
+		{"terminal", false, true, false, false},
+		{"no terminal, default source", false, false, false, true},
+		{"no terminal, chosen source", false, false, true, false},
+		{"asked for headless", true, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAutoHeadless(&Config{Source: "demo", Headless: tt.headless}, tt.terminal, tt.chosen)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAutoHeadless = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrintTransitions(t *testing.T) {
+	notStarted := []models.ServiceState{
+		models.ServiceStateNotStarted, models.ServiceStateNotStarted,
+		models.ServiceStateNotStarted, models.ServiceStateNotStarted,
+	}
+	dockerUp := append([]models.ServiceState(nil), notStarted...)
+	dockerUp[1] = models.ServiceStateUpdating
+	snapshot := func(services []models.ServiceState, resources map[string]models.AzureResourceState) machineSnapshot {
+		return machineSnapshot{exists: true, services: services, resources: resources, required: []string{"VNET", "VM"}}
+	}
+	noResources := map[string]models.AzureResourceState{}
+
+	tests := []struct {
+		name          string
+		before, after machineSnapshot
+		location      string
+		want          []string
+	}{
+		{
+			name:     "added",
+			after:    snapshot(notStarted, map[string]models.AzureResourceState{"VM": models.AzureResourceStatePending}),
+			location: "eastus",
+			want:     []string{"abc01-vm added (eastus)", "abc01-vm VM: NotStarted -> Pending"},
+		},
+		{
+			name:  "added without a location",
+			after: snapshot(notStarted, noResources),
+			want:  []string{"abc01-vm added"},
+		},
+		{
+			name:   "service",
+			before: snapshot(notStarted, noResources),
+			after:  snapshot(dockerUp, noResources),
+			want:   []string{"abc01-vm Docker: NotStarted -> Updating"},
+		},
+		{
+			name: "resources in display order",
+			before: snapshot(notStarted, map[string]models.AzureResourceState{
+				"VM": models.AzureResourceStatePending,
+			}),
+			after: snapshot(notStarted, map[string]models.AzureResourceState{
+				"VM":   models.AzureResourceStateFailed,
+				"VNET": models.AzureResourceStateSucceeded,
+			}),
+			want: []string{"abc01-vm VNET: NotStarted -> Succeeded", "abc01-vm VM: Pending -> Failed"},
+		},
+		{
+			name:   "unchanged",
+			before: snapshot(dockerUp, noResources),
+			after:  snapshot(dockerUp, noResources),
+		},
+		{
+			name:   "gone",
+			before: snapshot(dockerUp, noResources),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			printTransitions(&out, "abc01-vm", tt.before, tt.after, tt.location)
+			want := ""
+			if len(tt.want) > 0 {
+				want = strings.Join(tt.want, "\n") + "\n"
+			}
+			if out.String() != want {
+				t.Errorf("printed\n%s\nwant\n%s", out.String(), want)
+			}
+		})
+	}
+}
+
+// scriptedSource sends msgs and stops
+type scriptedSource struct {
+	msgs []tea.Msg
+	done chan struct{}
+}
+
+func newScriptedSource(statuses ...*models.DisplayStatus) *scriptedSource {
+	s := &scriptedSource{done: make(chan struct{})}
+	for _, status := range statuses {
+		s.msgs = append(s.msgs, models.StatusUpdateMsg{Status: status})
+	}
+	return s
+}
+
+func (s *scriptedSource) Start(_ context.Context, sender events.Sender) error {
+	go func() {
+		defer close(s.done)
+		for _, msg := range s.msgs {
+			sender.Send(msg)
+		}
+	}()
+	return nil
+}
+
+func (s *scriptedSource) Stop() error {
+	<-s.done
+	return nil
+}
+
+func (s *scriptedSource) Done() <-chan struct{} {
+	return s.done
+}
+
+func TestHeadlessReportsFailure(t *testing.T) {
+	ssh := models.NewDisplayVMStatus("abc02-vm", models.AzureResourceStateSucceeded)
+	ssh.SSH = models.ServiceStateSucceeded
+	tests := []struct {
+		name       string
+		statuses   []*models.DisplayStatus
+		wantFailed bool
+		wantLines  []string
+	}{
+		{
+			name: "failed",
+			statuses: []*models.DisplayStatus{
+				models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStatePending),
+				models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateFailed),
+			},
+			wantFailed: true,
+			wantLines: []string{
+				"abc01-vm added",
+				"abc01-vm VM: Pending -> Failed",
+				"summary: 1 machines, 0 complete, 0 in progress, 1 failed",
+			},
+		},
+		{
+			name:     "running",
+			statuses: []*models.DisplayStatus{ssh},
+			wantLines: []string{
+				"abc02-vm SSH: NotStarted -> Succeeded",
+				// The setup commands the status started are waited for
+				"abc02-vm CorePackages: Updating -> Succeeded",
+				"summary: 1 machines, 0 complete, 1 in progress, 0 failed",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			cfg := &Config{SummaryInterval: time.Hour}
+			failed, err := runHeadlessDisplay(context.Background(), cfg, InitialModel(), newScriptedSource(tt.statuses...), &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if failed != tt.wantFailed {
+				t.Errorf("failed = %v, want %v", failed, tt.wantFailed)
+			}
+			for _, line := range tt.wantLines {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("missing %q in\n%s", line, out.String())
+				}
+			}
+		})
+	}
+}
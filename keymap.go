@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/viper"
+)
+
+// KeyContext is the part of the display a key binding applies to. The
+// table, log pane and detail view are on screen together and share one set
+// of keys; modals take every key press while they are open.
+type KeyContext int
+
+const (
+	ContextTable KeyContext = iota
+	ContextLogPane
+	ContextDetail
+	ContextModal
+)
+
+func (c KeyContext) String() string {
+	switch c {
+	case ContextTable:
+		return "Table"
+	case ContextLogPane:
+		return "Log pane"
+	case ContextDetail:
+		return "Detail view"
+	case ContextModal:
+		return "Menus and help"
+	}
+	return "Unknown"
+}
+
+// modal reports whether the context's keys only apply while a modal is open
+func (c KeyContext) modal() bool {
+	return c == ContextModal
+}
+
+// KeyAction names something a key does. The names are the keys of the
+// config file's keys section.
+type KeyAction string
+
+const (
+	ActionQuit          KeyAction = "quit"
+	ActionHelp          KeyAction = "help"
+	ActionUp            KeyAction = "up"
+	ActionDown          KeyAction = "down"
+	ActionSelect        KeyAction = "select"
+	ActionGroup         KeyAction = "group"
+	ActionCollapseAll   KeyAction = "collapse_all"
+	ActionMenu          KeyAction = "actions"
+	ActionNextEvent     KeyAction = "next_event"
+	ActionScrollUp      KeyAction = "scroll_up"
+	ActionScrollDown    KeyAction = "scroll_down"
+	ActionFollow        KeyAction = "follow"
+	ActionFilter        KeyAction = "filter"
+	ActionMachineLogs   KeyAction = "machine_logs"
+	ActionCloseDetail   KeyAction = "close_detail"
+	ActionMenuUp        KeyAction = "menu_up"
+	ActionMenuDown      KeyAction = "menu_down"
+	ActionMenuRun       KeyAction = "menu_run"
+	ActionClose         KeyAction = "close"
+	ActionRetry         KeyAction = "retry"
+	ActionCancel        KeyAction = "cancel"
+	ActionSSH           KeyAction = "ssh"
+	ActionCopyPublicIP  KeyAction = "copy_public_ip"
+	ActionCopyPrivateIP KeyAction = "copy_private_ip"
+)
+
+// KeyBinding is the keys that trigger an action, as tea.KeyMsg strings
+type KeyBinding struct {
+	Action  KeyAction
+	Keys    []string
+	Help    string
+	Context KeyContext
+}
+
+// DefaultKeyBindings are the bindings before the config file's changes, in
+// the order the help overlay lists them. Ctrl+C always quits as well.
+var DefaultKeyBindings = []KeyBinding{
+	{ActionQuit, []string{"q", "ctrl+c"}, "quit", ContextTable},
+	{ActionHelp, []string{"?"}, "show or hide this help", ContextTable},
+	{ActionUp, []string{"up", "k"}, "select the previous row", ContextTable},
+	{ActionDown, []string{"down", "j"}, "select the next row", ContextTable},
+	{ActionSelect, []string{"enter"}, "expand a group or show a machine's details", ContextTable},
+	{ActionGroup, []string{"g"}, "change how rows are grouped", ContextTable},
+	{ActionCollapseAll, []string{"c"}, "collapse or expand all groups", ContextTable},
+	{ActionMenu, []string{"a"}, "open the actions for the selected machine", ContextTable},
+	{ActionNextEvent, []string{"n"}, "send the next event of a step-by-step replay", ContextTable},
+	{ActionScrollUp, []string{"pgup"}, "scroll the logs back", ContextLogPane},
+	{ActionScrollDown, []string{"pgdown"}, "scroll the logs forward", ContextLogPane},
+	{ActionFollow, []string{"f"}, "follow new log lines", ContextLogPane},
+	{ActionFilter, []string{"/"}, "filter the logs", ContextLogPane},
+	{ActionMachineLogs, []string{"m"}, "show only the selected machine's logs", ContextLogPane},
+	{ActionCloseDetail, []string{"esc"}, "hide the details", ContextDetail},
+	{ActionMenuUp, []string{"up", "k"}, "previous entry", ContextModal},
+	{ActionMenuDown, []string{"down", "j"}, "next entry", ContextModal},
+	{ActionMenuRun, []string{"enter"}, "run the entry", ContextModal},
+	{ActionClose, []string{"esc", "q"}, "close", ContextModal},
+	{ActionRetry, []string{"r"}, "retry the failed step", ContextModal},
+	{ActionCancel, []string{"x"}, "cancel the machine", ContextModal},
+	{ActionSSH, []string{"s"}, "ssh to the public IP", ContextModal},
+	{ActionCopyPublicIP, []string{"p"}, "copy the public IP", ContextModal},
+	{ActionCopyPrivateIP, []string{"i"}, "copy the private IP", ContextModal},
+}
+
+// keyNames are the config spellings of keys that are awkward to write
+var keyNames = map[string]string{
+	"space": " ",
+}
+
+// Keymap resolves key presses to actions
+type Keymap struct {
+	bindings []KeyBinding
+	// main and modal map keys to actions for the main view and modals
+	main  map[string]KeyAction
+	modal map[string]KeyAction
+}
+
+// NewKeymap builds a keymap, failing if a key is bound to two actions that
+// can be active at once
+func NewKeymap(bindings []KeyBinding) (*Keymap, error) {
+	k := &Keymap{
+		bindings: bindings,
+		main:     map[string]KeyAction{},
+		modal:    map[string]KeyAction{},
+	}
+	for _, binding := range bindings {
+		actions := k.main
+		if binding.Context.modal() {
+			actions = k.modal
+		}
+		for _, key := range binding.Keys {
+			if other, ok := actions[key]; ok && other != binding.Action {
+				return nil, fmt.Errorf("key %q is bound to both %s and %s", key, other, binding.Action)
+			}
+			actions[key] = binding.Action
+		}
+	}
+	return k, nil
+}
+
+// DefaultKeymap returns the keymap with the default bindings
+func DefaultKeymap() *Keymap {
+	k, err := NewKeymap(DefaultKeyBindings)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// LoadKeymap applies the config's keys section to the default bindings.
+// Each entry replaces an action's keys, e.g.
+//
+//	keys:
+//	  group: G
+//	  machine_logs: [m, M]
+//
+// An empty list unbinds the action.
+func LoadKeymap(v *viper.Viper) (*Keymap, error) {
+	bindings := make([]KeyBinding, len(DefaultKeyBindings))
+	copy(bindings, DefaultKeyBindings)
+	index := map[KeyAction]int{}
+	for i, binding := range bindings {
+		index[binding.Action] = i
+	}
+
+	overrides := v.GetStringMap("keys")
+	actions := make([]string, 0, len(overrides))
+	for action := range overrides {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		i, ok := index[KeyAction(action)]
+		if !ok {
+			return nil, fmt.Errorf("unknown key action %q", action)
+		}
+		keys := v.GetStringSlice("keys." + action)
+		for j, key := range keys {
+			if name, ok := keyNames[strings.ToLower(key)]; ok {
+				keys[j] = name
+			}
+		}
+		bindings[i].Keys = keys
+	}
+	return NewKeymap(bindings)
+}
+
+// Resolve returns the action key triggers in the main view, or in a modal
+// if modal is set
+func (k *Keymap) Resolve(key string, modal bool) (KeyAction, bool) {
+	actions := k.main
+	if modal {
+		actions = k.modal
+	}
+	action, ok := actions[key]
+	return action, ok
+}
+
+// Keys returns the keys bound to action
+func (k *Keymap) Keys(action KeyAction) []string {
+	for _, binding := range k.bindings {
+		if binding.Action == action {
+			return binding.Keys
+		}
+	}
+	return nil
+}
+
+// Hint is the label of the first key bound to action, or "" if it is
+// unbound
+func (k *Keymap) Hint(action KeyAction) string {
+	keys := k.Keys(action)
+	if len(keys) == 0 {
+		return ""
+	}
+	return keyLabel(keys[0])
+}
+
+// keyLabels are the display names of keys whose tea.KeyMsg string is terse
+var keyLabels = map[string]string{
+	"up":     "↑",
+	"down":   "↓",
+	"left":   "←",
+	"right":  "→",
+	"enter":  "Enter",
+	"esc":    "Esc",
+	"pgup":   "PgUp",
+	"pgdown": "PgDn",
+	"tab":    "Tab",
+	" ":      "Space",
+}
+
+func keyLabel(key string) string {
+	if label, ok := keyLabels[key]; ok {
+		return label
+	}
+	if rest, ok := strings.CutPrefix(key, "ctrl+"); ok {
+		return "Ctrl+" + strings.ToUpper(rest)
+	}
+	return key
+}
+
+// renderHelp is the full-screen help overlay, listing every binding by
+// context
+func (m *DisplayModel) renderHelp() string {
+	titleStyle := lipgloss.NewStyle().Bold(true).Foreground(ActiveTheme.Header)
+	keyStyle := lipgloss.NewStyle().Foreground(ActiveTheme.Accent)
+	mutedStyle := lipgloss.NewStyle().Foreground(ActiveTheme.Muted).Italic(true)
+
+	lines := []string{titleStyle.Render("Keys"), ""}
+	for context := ContextTable; context <= ContextModal; context++ {
+		lines = append(lines, titleStyle.Render(context.String()))
+		for _, binding := range m.Keys.bindings {
+			if binding.Context != context {
+				continue
+			}
+			labels := make([]string, len(binding.Keys))
+			for i, key := range binding.Keys {
+				labels[i] = keyLabel(key)
+			}
+			keys := strings.Join(labels, "/")
+			if keys == "" {
+				keys = "(unbound)"
+			}
+			lines = append(lines, fmt.Sprintf("  %s %s", keyStyle.Render(fmt.Sprintf("%-14s", keys)), binding.Help))
+		}
+		lines = append(lines, "")
+	}
+	lines = append(lines, mutedStyle.Render(fmt.Sprintf(
+		"Ctrl+C always quits. Keys are remapped in the config file's keys section. %s or %s closes this help.",
+		m.Keys.Hint(ActionHelp), m.Keys.Hint(ActionClose))))
+
+	help := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(ActiveTheme.Accent).
+		Padding(0, 1).
+		Render(strings.Join(lines, "\n"))
+	if m.width <= 0 || m.height <= 0 {
+		return help
+	}
+	return lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, help)
+}
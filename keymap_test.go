@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func loadKeymap(t *testing.T, config string) (*Keymap, error) {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	return LoadKeymap(v)
+}
+
+// resolves checks what key does in the main view, or a modal if modal is
+// set; want "" means nothing
+func resolves(t *testing.T, k *Keymap, key string, modal bool, want KeyAction) {
+	t.Helper()
+	got, ok := k.Resolve(key, modal)
+	if want == "" && ok {
+		t.Errorf("%q is bound to %s", key, got)
+	} else if want != "" && got != want {
+		t.Errorf("%q resolves to %q, want %s", key, got, want)
+	}
+}
+
+func TestLoadKeymapRemaps(t *testing.T) {
+	k, err := loadKeymap(t, `
+keys:
+  group: G
+  machine_logs: [m, M]
+  follow: Space
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolves(t, k, "G", false, ActionGroup)
+	resolves(t, k, "g", false, "")
+	resolves(t, k, "m", false, ActionMachineLogs)
+	resolves(t, k, "M", false, ActionMachineLogs)
+	resolves(t, k, " ", false, ActionFollow)
+	resolves(t, k, "f", false, "")
+	// Actions the config leaves alone keep their defaults
+	resolves(t, k, "j", false, ActionDown)
+	if hint := k.Hint(ActionFollow); hint != "Space" {
+		t.Errorf("follow hint %q, want Space", hint)
+	}
+}
+
+func TestLoadKeymapUnbinds(t *testing.T) {
+	k, err := loadKeymap(t, "keys:\n  help: []\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolves(t, k, "?", false, "")
+	if hint := k.Hint(ActionHelp); hint != "" {
+		t.Errorf("unbound help has hint %q", hint)
+	}
+}
+
+func TestLoadKeymapRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"unknown action", "keys:\n  teleport: t\n", `unknown key action "teleport"`},
+		{"table keys", "keys:\n  group: j\n", `key "j" is bound to both down and group`},
+		{"table and log pane", "keys:\n  follow: k\n", `key "k" is bound to both up and follow`},
+		{"table and detail view", "keys:\n  close_detail: enter\n", `key "enter" is bound to both select and close_detail`},
+		{"log pane and detail view", "keys:\n  close_detail: f\n", `key "f" is bound to both follow and close_detail`},
+		{"modal keys", "keys:\n  ssh: x\n", `key "x" is bound to both cancel and ssh`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadKeymap(t, tt.config)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadKeymap = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModalKeysDontClashWithTheMainView(t *testing.T) {
+	// Modals take every key while open, so their keys can overlap the rest
+	k, err := loadKeymap(t, "keys:\n  retry: g\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolves(t, k, "g", false, ActionGroup)
+	resolves(t, k, "g", true, ActionRetry)
+	resolves(t, k, "r", true, "")
+}
+
+func TestKeyLabels(t *testing.T) {
+	for key, want := range map[string]string{
+		"up":     "↑",
+		"pgdown": "PgDn",
+		" ":      "Space",
+		"ctrl+x": "Ctrl+X",
+		"G":      "G",
+	} {
+		if got := keyLabel(key); got != want {
+			t.Errorf("keyLabel(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// tableBorderWidth is the horizontal space taken by the table's border
+const tableBorderWidth = 2
+
+// cellPadding is the horizontal padding around every table cell
+const cellPadding = 2
+
+// LayoutColumns fits columns into width, the space available for the table
+// including its border. Flexible columns (MinWidth < MaxWidth) shrink first,
+// least important first; if the table still does not fit, columns are hidden
+// starting with the highest Priority. Priority 0 columns are never hidden.
+// Any spare space first restores shrunk columns to their default Width and
+// then grows flexible columns up to their MaxWidth, most important first.
+// A width of zero or less means the terminal size is not yet known and
+// every column keeps its default Width.
+func LayoutColumns(columns []DisplayColumn, width int) []DisplayColumn {
+	laidOut := make([]DisplayColumn, len(columns))
+	defaultWidths := make([]int, len(columns))
+	for i, column := range columns {
+		column.Width = effectiveWidth(column)
+		column.Hidden = false
+		laidOut[i] = column
+		defaultWidths[i] = column.Width
+	}
+	if width <= 0 {
+		return laidOut
+	}
+	available := width - tableBorderWidth
+
+	// Least important first; among equals, rightmost first
+	byPriority := make([]int, len(laidOut))
+	for i := range byPriority {
+		byPriority[i] = i
+	}
+	sort.SliceStable(byPriority, func(a, b int) bool {
+		ca, cb := laidOut[byPriority[a]], laidOut[byPriority[b]]
+		if ca.Priority != cb.Priority {
+			return ca.Priority > cb.Priority
+		}
+		return byPriority[a] > byPriority[b]
+	})
+
+	for _, i := range byPriority {
+		excess := visibleWidth(laidOut) - available
+		if excess <= 0 {
+			break
+		}
+		if laidOut[i].flexible() {
+			shrink := min(excess, laidOut[i].Width-laidOut[i].MinWidth)
+			laidOut[i].Width -= shrink
+		}
+	}
+
+	for _, i := range byPriority {
+		if visibleWidth(laidOut) <= available {
+			break
+		}
+		if laidOut[i].Priority > 0 {
+			laidOut[i].Hidden = true
+		}
+	}
+
+	grow := func(limit func(i int) int) {
+		for j := len(byPriority) - 1; j >= 0; j-- {
+			i := byPriority[j]
+			spare := available - visibleWidth(laidOut)
+			if spare <= 0 {
+				return
+			}
+			if !laidOut[i].Hidden && laidOut[i].flexible() && laidOut[i].Width < limit(i) {
+				laidOut[i].Width += min(spare, limit(i)-laidOut[i].Width)
+			}
+		}
+	}
+	grow(func(i int) int { return defaultWidths[i] })
+	grow(func(i int) int { return laidOut[i].MaxWidth })
+
+	return laidOut
+}
+
+func (c DisplayColumn) flexible() bool {
+	return c.MinWidth > 0 && c.MinWidth < c.MaxWidth
+}
+
+// effectiveWidth is the width a column actually renders at. Symbol columns
+// are narrower than their padded title, so they are widened to fit it.
+func effectiveWidth(column DisplayColumn) int {
+	return max(column.Width, lipgloss.Width(column.title())+cellPadding)
+}
+
+func visibleWidth(columns []DisplayColumn) int {
+	width := 0
+	for _, column := range columns {
+		if !column.Hidden {
+			width += column.Width
+		}
+	}
+	return width
+}
+
+// columnIndex returns the index of the column titled title
+func columnIndex(columns []DisplayColumn, title string) int {
+	for i, column := range columns {
+		if column.TextTitle == title {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// hidden marks a column LayoutColumns should hide in wantWidths
+const hidden = -1
+
+func TestLayoutColumns(t *testing.T) {
+	// 26 wide by default, 28 with the border
+	columns := []DisplayColumn{
+		{TextTitle: "A", Width: 10, MinWidth: 5, MaxWidth: 20},
+		{TextTitle: "B", Width: 10, MinWidth: 5, MaxWidth: 10, Priority: 2},
+		{TextTitle: "C", Width: 6, Priority: 1},
+	}
+
+	tests := []struct {
+		name       string
+		width      int
+		wantWidths []int
+	}{
+		{"unknown width keeps defaults", 0, []int{10, 10, 6}},
+		{"exact fit keeps defaults", 28, []int{10, 10, 6}},
+		{"shrinks least important first", 23, []int{10, 5, 6}},
+		{"shrinks every flexible column", 18, []int{5, 5, 6}},
+		{"hides least important then grows the rest back", 14, []int{6, hidden, 6}},
+		{"never hides priority 0", 5, []int{5, hidden, hidden}},
+		{"grows flexible columns to their maximum", 40, []int{20, 10, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			laidOut := LayoutColumns(columns, tt.width)
+			got := make([]int, len(laidOut))
+			for i, column := range laidOut {
+				got[i] = column.Width
+				if column.Hidden {
+					got[i] = hidden
+				}
+			}
+			if !slices.Equal(got, tt.wantWidths) {
+				t.Errorf("LayoutColumns(%d) widths = %v, want %v", tt.width, got, tt.wantWidths)
+			}
+		})
+	}
+}
+
+func TestLayoutColumnsLeavesInputUnchanged(t *testing.T) {
+	columns := []DisplayColumn{
+		{TextTitle: "A", Width: 10, MinWidth: 5, MaxWidth: 20},
+		{TextTitle: "B", Width: 6, Priority: 1},
+	}
+	LayoutColumns(columns, 8)
+	if columns[0].Width != 10 || columns[1].Hidden {
+		t.Errorf("LayoutColumns modified its input: %+v", columns)
+	}
+}
+
+func TestLayoutColumnsWidensColumnsToTheirTitle(t *testing.T) {
+	columns := []DisplayColumn{{TextTitle: "Status", Width: 2}}
+	laidOut := LayoutColumns(columns, 0)
+	if want := len("Status") + cellPadding; laidOut[0].Width != want {
+		t.Errorf("width = %d, want %d", laidOut[0].Width, want)
+	}
+}
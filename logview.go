@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// LogHistorySize is the number of log lines kept for scrolling back
+const LogHistorySize = 1000
+
+// LogEntry is a single line in the log pane
+type LogEntry struct {
+	Time    time.Time
+	Level   models.LogLevel
+	Machine string
+	Text    string
+}
+
+// LogView is a scrollable, filterable log pane with a bounded history
+type LogView struct {
+	entries []LogEntry
+
+	// Height is the number of log lines shown at once
+	Height int
+	// Follow keeps the newest line in view as lines arrive
+	Follow bool
+	// offset is how many matching lines the view is scrolled back from the newest
+	offset int
+	// matched counts the entries the filter and machine let through
+	matched int
+
+	filter      string
+	filterRegex *regexp.Regexp
+	// Machine limits the pane to lines about one machine
+	Machine string
+
+	// Filter prompt state; while editing, the prompt takes all key presses
+	editing   bool
+	input     string
+	regexMode bool
+	inputErr  string
+}
+
+// NewLogView returns a following LogView showing height lines
+func NewLogView(height int) *LogView {
+	return &LogView{Height: height, Follow: true}
+}
+
+// Append adds an entry, dropping the oldest once LogHistorySize is reached
+func (l *LogView) Append(entry LogEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	l.entries = append(l.entries, entry)
+	if l.matches(entry) {
+		l.matched++
+		// Keep the same lines in view while paused
+		if !l.Follow {
+			l.offset++
+		}
+	}
+	if len(l.entries) > LogHistorySize {
+		for _, dropped := range l.entries[:len(l.entries)-LogHistorySize] {
+			if l.matches(dropped) {
+				l.matched--
+			}
+		}
+		l.entries = l.entries[len(l.entries)-LogHistorySize:]
+	}
+	l.clampOffset()
+}
+
+// Lines returns the number of lines in the history
+func (l *LogView) Lines() int {
+	return len(l.entries)
+}
+
+// Editing reports whether the filter prompt has focus
+func (l *LogView) Editing() bool {
+	return l.editing
+}
+
+// ScrollUp moves the view back by n lines and pauses following
+func (l *LogView) ScrollUp(n int) {
+	l.Follow = false
+	l.offset += n
+	l.clampOffset()
+}
+
+// ScrollDown moves the view forward by n lines, resuming following once the
+// newest line is reached
+func (l *LogView) ScrollDown(n int) {
+	l.offset -= n
+	if l.offset <= 0 {
+		l.offset = 0
+		l.Follow = true
+	}
+}
+
+// ToggleFollow switches between following new lines and a paused view
+func (l *LogView) ToggleFollow() {
+	l.Follow = !l.Follow
+	if l.Follow {
+		l.offset = 0
+	}
+}
+
+// ToggleMachine limits the pane to machine, or removes the limit if it is
+// already applied
+func (l *LogView) ToggleMachine(machine string) {
+	if l.Machine == machine {
+		l.Machine = ""
+	} else {
+		l.Machine = machine
+	}
+	l.offset = 0
+	l.recount()
+}
+
+// StartFilter opens the filter prompt, pre-filled with the current filter
+func (l *LogView) StartFilter() {
+	l.editing = true
+	l.input = l.filter
+	l.inputErr = ""
+}
+
+// HandleFilterKey handles a key press while the filter prompt has focus.
+// Enter applies the filter (an empty filter clears it), Esc cancels and
+// Ctrl+R toggles between substring and regular expression matching.
+func (l *LogView) HandleFilterKey(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		if err := l.SetFilter(l.input, l.regexMode); err != nil {
+			l.inputErr = err.Error()
+			return
+		}
+		l.editing = false
+	case tea.KeyEsc:
+		l.editing = false
+	case tea.KeyCtrlR:
+		l.regexMode = !l.regexMode
+	case tea.KeyBackspace:
+		if runes := []rune(l.input); len(runes) > 0 {
+			l.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		l.input += string(msg.Runes)
+	}
+}
+
+// SetFilter filters the pane by a case-insensitive substring, or by a
+// regular expression when regex is set
+func (l *LogView) SetFilter(filter string, regex bool) error {
+	l.filterRegex = nil
+	if regex && filter != "" {
+		re, err := regexp.Compile(filter)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		l.filterRegex = re
+	}
+	l.filter = filter
+	l.regexMode = regex
+	l.offset = 0
+	l.recount()
+	return nil
+}
+
+func (l *LogView) matches(entry LogEntry) bool {
+	if l.Machine != "" && entry.Machine != l.Machine && !strings.Contains(entry.Text, l.Machine) {
+		return false
+	}
+	switch {
+	case l.filter == "":
+		return true
+	case l.filterRegex != nil:
+		return l.filterRegex.MatchString(entry.Text) || l.filterRegex.MatchString(entry.Machine)
+	default:
+		filter := strings.ToLower(l.filter)
+		return strings.Contains(strings.ToLower(entry.Text), filter) ||
+			strings.Contains(strings.ToLower(entry.Machine), filter)
+	}
+}
+
+func (l *LogView) filtered() []LogEntry {
+	var entries []LogEntry
+	for _, entry := range l.entries {
+		if l.matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// recount counts the matching entries afresh after the filter changes
+func (l *LogView) recount() {
+	l.matched = 0
+	for _, entry := range l.entries {
+		if l.matches(entry) {
+			l.matched++
+		}
+	}
+}
+
+func (l *LogView) clampOffset() {
+	maxOffset := l.matched - l.Height
+	if maxOffset < 0 {
+		maxOffset = 0
+	}
+	if l.offset > maxOffset {
+		l.offset = maxOffset
+	}
+}
+
+// Render returns the pane's title line followed by the visible lines, each
+// cut to width so none wraps
+func (l *LogView) Render(width int) string {
+	entries := l.filtered()
+	end := len(entries) - l.offset
+	if end < 0 {
+		end = 0
+	}
+	start := end - l.Height
+	if start < 0 {
+		start = 0
+	}
+
+	lines := []string{l.renderTitle(start, end, len(entries), width)}
+	for _, entry := range entries[start:end] {
+		lines = append(lines, renderLogEntry(entry, width))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (l *LogView) renderTitle(start, end, total, width int) string {
+	titleStyle := lipgloss.NewStyle().Foreground(ActiveTheme.Muted)
+
+	if l.editing {
+		prompt := "/"
+		if l.regexMode {
+			prompt = "regex /"
+		}
+		text := fmt.Sprintf("%s%s█  (Enter apply, Esc cancel, Ctrl+R regex)", prompt, l.input)
+		if l.inputErr != "" {
+			text += "  " + l.inputErr
+		}
+		return lipgloss.NewStyle().Bold(true).Render(ansi.Truncate(text, width, "…"))
+	}
+
+	state := "following"
+	if !l.Follow {
+		state = "paused"
+	}
+	position := fmt.Sprintf("%d-%d/%d", start+1, end, total)
+	if total == 0 {
+		position = "0/0"
+	}
+	parts := []string{fmt.Sprintf("Logs (%s) %s", state, position)}
+	if l.filter != "" {
+		if l.regexMode {
+			parts = append(parts, fmt.Sprintf("regex:/%s/", l.filter))
+		} else {
+			parts = append(parts, fmt.Sprintf("filter:%q", l.filter))
+		}
+	}
+	if l.Machine != "" {
+		parts = append(parts, "machine:"+l.Machine)
+	}
+	return titleStyle.Render(ansi.Truncate(strings.Join(parts, "  "), width, "…"))
+}
+
+func renderLogEntry(entry LogEntry, width int) string {
+	line := fmt.Sprintf("%s %-5s ", entry.Time.Format("15:04:05"), entry.Level)
+	if entry.Machine != "" {
+		line += fmt.Sprintf("[%s] ", entry.Machine)
+	}
+	// A multi-line text would push the pane's other lines out of view
+	line += strings.ReplaceAll(entry.Text, "\n", " ")
+	return logLevelStyle(entry.Level).Render(ansi.Truncate(line, width, "…"))
+}
+
+func logLevelStyle(level models.LogLevel) lipgloss.Style {
+	style := lipgloss.NewStyle()
+	switch level {
+	case models.LogLevelDebug:
+		return style.Foreground(ActiveTheme.Muted)
+	case models.LogLevelWarn:
+		return style.Foreground(ActiveTheme.Warning)
+	case models.LogLevelError:
+		return style.Foreground(ActiveTheme.Failure).Bold(true)
+	}
+	return style
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// logView has n lines, "line 0" to "line n-1", about abc01-vm and abc02-vm
+// in turn
+func logView(height, n int) *LogView {
+	l := NewLogView(height)
+	for i := 0; i < n; i++ {
+		l.Append(LogEntry{Machine: fmt.Sprintf("abc0%d-vm", i%2+1), Text: fmt.Sprintf("line %d", i)})
+	}
+	return l
+}
+
+// visible is the texts of the lines in view
+func visible(l *LogView) []string {
+	lines := strings.Split(ansi.Strip(l.Render(200)), "\n")[1:]
+	for i, line := range lines {
+		lines[i] = line[strings.Index(line, "line "):]
+	}
+	return lines
+}
+
+func TestLogViewFollowAndPause(t *testing.T) {
+	l := logView(3, 10)
+	if got := strings.Join(visible(l), ","); got != "line 7,line 8,line 9" {
+		t.Errorf("following shows %s", got)
+	}
+
+	l.ToggleFollow()
+	l.Append(LogEntry{Text: "line 10"})
+	if got := strings.Join(visible(l), ","); got != "line 7,line 8,line 9" {
+		t.Errorf("paused view moved to %s", got)
+	}
+	if title := ansi.Strip(strings.Split(l.Render(200), "\n")[0]); !strings.Contains(title, "paused") || !strings.Contains(title, "8-10/11") {
+		t.Errorf("title = %q", title)
+	}
+
+	l.ToggleFollow()
+	if got := strings.Join(visible(l), ","); got != "line 8,line 9,line 10" {
+		t.Errorf("following again shows %s", got)
+	}
+}
+
+func TestLogViewScrolling(t *testing.T) {
+	l := logView(3, 10)
+	l.ScrollUp(4)
+	if l.Follow {
+		t.Error("scrolling up kept following")
+	}
+	if got := strings.Join(visible(l), ","); got != "line 3,line 4,line 5" {
+		t.Errorf("scrolled up to %s", got)
+	}
+	// The oldest line is as far as it goes
+	l.ScrollUp(100)
+	if got := strings.Join(visible(l), ","); got != "line 0,line 1,line 2" {
+		t.Errorf("scrolled past the top to %s", got)
+	}
+	l.ScrollDown(3)
+	if l.Follow {
+		t.Error("following before the newest line came back")
+	}
+	l.ScrollDown(100)
+	if !l.Follow || strings.Join(visible(l), ",") != "line 7,line 8,line 9" {
+		t.Errorf("scrolling to the bottom: follow %v, showing %v", l.Follow, visible(l))
+	}
+}
+
+func TestLogViewFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		regex   bool
+		machine string
+		want    string
+	}{
+		{"substring", "LINE 1", false, "", "line 1"},
+		{"regex", `line [2-4]$`, true, "", "line 2,line 3,line 4"},
+		{"regex on the machine", `abc02`, true, "", "line 1,line 3,line 5"},
+		{"machine", "", false, "abc01-vm", "line 0,line 2,line 4"},
+		{"machine and filter", "4", false, "abc01-vm", "line 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := logView(10, 6)
+			if err := l.SetFilter(tt.filter, tt.regex); err != nil {
+				t.Fatal(err)
+			}
+			if tt.machine != "" {
+				l.ToggleMachine(tt.machine)
+			}
+			if got := strings.Join(visible(l), ","); got != tt.want {
+				t.Errorf("showing %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	l := logView(10, 6)
+	if err := l.SetFilter("line [", true); err == nil {
+		t.Error("accepted an invalid regex")
+	}
+}
+
+func TestLogViewPausedCountsMatches(t *testing.T) {
+	l := logView(2, LogHistorySize)
+	if err := l.SetFilter("abc01", false); err != nil {
+		t.Fatal(err)
+	}
+	l.ScrollUp(LogHistorySize)
+	if l.offset != LogHistorySize/2-2 {
+		t.Fatalf("scrolled to %d, want the oldest of %d matches", l.offset, LogHistorySize/2)
+	}
+
+	// Lines that fall out of the history take their matches with them, and
+	// the view stays on the oldest line left
+	for i := 0; i < 10; i++ {
+		l.Append(LogEntry{Machine: "abc02-vm", Text: "other"})
+	}
+	if l.matched != LogHistorySize/2-5 {
+		t.Errorf("%d matches counted, want %d", l.matched, LogHistorySize/2-5)
+	}
+	if want := strings.Join(visible(l), ","); want != "line 10,line 12" {
+		t.Errorf("showing %s, want the oldest matches left", want)
+	}
+}
+
+func TestLogViewCutsLinesToWidth(t *testing.T) {
+	l := NewLogView(3)
+	l.Append(LogEntry{Machine: "abc01-vm", Text: strings.Repeat("long ", 40) + "\nsecond line"})
+	rendered := l.Render(40)
+	lines := strings.Split(rendered, "\n")
+	if len(lines) != 2 {
+		t.Fatalf("rendered %d lines, want the title and the entry:\n%s", len(lines), rendered)
+	}
+	for _, line := range lines {
+		if w := ansi.StringWidth(line); w > 40 {
+			t.Errorf("line is %d wide: %q", w, ansi.Strip(line))
+		}
+	}
+	if !strings.HasSuffix(ansi.Strip(lines[1]), "…") {
+		t.Errorf("cut line %q has no ellipsis", ansi.Strip(lines[1]))
+	}
+}
@@ -2,174 +2,305 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"github.com/aronchick/bubble-tea-experiment/pkg/api"
+	"github.com/aronchick/bubble-tea-experiment/pkg/events"
+	"github.com/aronchick/bubble-tea-experiment/pkg/journal"
 	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/metrics"
 	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/report"
 	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/pflag"
 )
 
-const LogFilePath = "bubble-tea-experiment.log"
-
-var EmojisEnabled = false
-
-var LogFile *os.File
-
-const statusLength = 30
-
-var words = []string{
-	"apple", "banana", "cherry", "date", "elderberry",
-	"fig", "grape", "honeydew", "kiwi", "lemon",
-	"mango", "nectarine", "orange", "papaya", "quince",
-	"raspberry", "strawberry", "tangerine", "ugli", "watermelon",
-}
+func main() {
+	cfg, loaded, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, pflag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error in configuration:\n%v\n", err)
+		os.Exit(2) //nolint:gomnd
+	}
+	switch {
+	case slices.Equal(args, []string{"config", "show"}):
+		if err := loaded.showConfig(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error showing config: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case len(args) > 0:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (available: config show)\n", strings.Join(args, " "))
+		os.Exit(2) //nolint:gomnd
+	}
 
-func getRandomWords(n int) string {
-	rand.Shuffle(len(words), func(i, j int) {
-		words[i], words[j] = words[j], words[i]
-	})
-	return strings.Join(words[:n], " ")
-}
+	logOptions, err := cfg.loggerOptions()
+	if err == nil {
+		err = logger.Init(logOptions)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+	logger.Info("starting", "source", cfg.Source, "log_level", logOptions.Level, "config", cfg.ConfigFile)
 
-func main() {
-	// Check if the EmojisEnabled environment variable is set to true
-	if os.Getenv("EMOJIS_ENABLED") == "true" {
-		EmojisEnabled = true
+	ActiveTheme, err = LoadTheme(loaded.v, cfg.Theme)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading theme: %v\n", err)
+		os.Exit(1)
 	}
 
-	// Create the log file
-	if err := os.WriteFile(LogFilePath, []byte{}, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+	keys, err := LoadKeymap(loaded.v)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading keymap: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Truncate the log file
-	if err := os.Truncate(LogFilePath, 0); err != nil {
-		fmt.Fprintf(os.Stderr, "Error truncating log file: %v\n", err)
+	glyphs, err := selectGlyphSet(cfg.Glyphs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error selecting glyphs: %v\n", err)
 		os.Exit(1)
 	}
+	models.SetGlyphs(glyphs)
+
+	cfg.applyDisplay()
+	m := GetGlobalModel()
+	m.Keys = keys
+	m.DebugMode = cfg.Display.Debug
+	if cfg.Resume {
+		deployment, err := models.LoadDeploymentFromStateFile(cfg.StateFile, cfg.Azure.ResourceGroup)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error resuming deployment: %v\n", err)
+			os.Exit(1)
+		}
+		m.Deployment = deployment
+		if cfg.Azure.SubscriptionID == "" {
+			cfg.Azure.SubscriptionID = deployment.SubscriptionID
+		}
+	} else if cfg.Plan != "" {
+		deployment, err := models.LoadDeploymentPlan(cfg.Plan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading deployment plan: %v\n", err)
+			os.Exit(1)
+		}
+		m.Deployment = deployment
+		if cfg.Azure.ResourceGroup == "" {
+			cfg.Azure.ResourceGroup = deployment.ResourceGroupName
+		}
+		if cfg.Azure.SubscriptionID == "" {
+			cfg.Azure.SubscriptionID = deployment.SubscriptionID
+		}
+	}
+
+	if m.Deployment.ResourceGroupName == "" {
+		m.Deployment.ResourceGroupName = cfg.Azure.ResourceGroup
+	}
+	// Only the azure source, or a resumed deployment, is real state; a
+	// simulated run must not overwrite what was saved for the group
+	m.PersistState = m.Deployment.ResourceGroupName != "" && (cfg.Source == "azure" || cfg.Resume)
+	m.StateFile = cfg.StateFile
 
-	var err error
-	LogFile, err = os.OpenFile(LogFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	terminal := isatty.IsTerminal(os.Stdout.Fd())
+	if err := checkAutoHeadless(cfg, terminal, loaded.source("source", "source") != "default"); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(2) //nolint:gomnd
+	}
+	headlessMode := cfg.Headless || !terminal
+	source, err := events.New(cfg.Source, events.Options{
+		Input:          cfg.Input,
+		Follow:         cfg.Follow,
+		SubscriptionID: cfg.Azure.SubscriptionID,
+		ResourceGroup:  cfg.Azure.ResourceGroup,
+		PollInterval:   cfg.Azure.PollInterval,
+		ARMEndpoint:    cfg.Azure.ARMEndpoint,
+		Deployment:     m.Deployment,
+		Speed:          cfg.Speed,
+		Seed:           cfg.Seed,
+		ReplayStep:     cfg.ReplayStep,
+		Interactive:    !headlessMode,
+	})
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening log file: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error creating event source: %v\n", err)
 		os.Exit(1)
 	}
-	defer LogFile.Close()
 
-	// Set the log file for the logger package
-	logger.SetLogFile(LogFile)
+	if cfg.API != "" {
+		m.API = api.New()
+		if err := m.API.Listen(cfg.API); err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting API server: %v\n", err)
+			os.Exit(1)
+		}
+		defer m.API.Close()
+		m.API.PublishDeployment(m.Deployment)
+		logger.Info("api listening", "addr", m.API.Addr())
+	}
+
+	if cfg.Metrics != "" {
+		m.Metrics = metrics.New()
+		m.Metrics.Observe(m.Deployment, time.Now())
+		server, err := serveMetrics(cfg.Metrics, m.Metrics)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error starting metrics server: %v\n", err)
+			os.Exit(1)
+		}
+		defer server.Close()
+		logger.Info("metrics listening", "addr", cfg.Metrics)
+	}
 
-	// Ensure we flush the log file before exiting
-	defer LogFile.Sync()
+	if cfg.Record != "" {
+		m.Journal, err = journal.Create(cfg.Record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating journal: %v\n", err)
+			os.Exit(1)
+		}
+		defer m.Journal.Close()
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
-	go testutils.StartLogGenerator(ctx, LogFilePath)
-	if err := runTestDisplay(cancel); err != nil {
+	if cfg.Source == "demo" {
+		go testutils.StartLogGenerator(ctx)
+	}
+
+	if headlessMode {
+		if cfg.ReplayStep {
+			fmt.Fprintf(os.Stderr, "--replay-step needs the interactive display\n")
+			os.Exit(1)
+		}
+		failed, err := runHeadlessDisplay(ctx, cfg, m, source, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error running headless display: %v\n", err)
+			os.Exit(1)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if stepper, ok := source.(events.Stepper); ok && cfg.ReplayStep {
+		m.Stepper = stepper
+	}
+	if commander, ok := source.(events.Commander); ok {
+		m.Commander = commander
+	}
+	if err := runTestDisplay(ctx, cancel, cfg, m, source); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running display: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-func runTestDisplay(cancel context.CancelFunc) error {
-	m := GetGlobalModel()
+func runTestDisplay(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	cfg *Config,
+	m *DisplayModel,
+	source events.EventSource,
+) error {
 	m.Cancel = cancel
 	p := tea.NewProgram(m, tea.WithAltScreen())
 
-	done := make(chan struct{})
-	closeOnce := sync.Once{}
-	if os.Getenv("DEBUG_CHANNELS") == "1" {
-		fmt.Fprintf(LogFile, "Starting runTestDisplay\n")
-		LogFile.Sync()
-	}
+	logger.Debug("starting the display", "source", cfg.Source)
 
-	go func() {
-		defer closeOnce.Do(func() { close(done) })
-		if os.Getenv("DEBUG_CHANNELS") == "1" {
-			fmt.Fprintf(LogFile, "Starting background goroutine\n")
-			LogFile.Sync()
-		}
-		totalTasks := 5
-		statuses := make([]*models.DisplayStatus, totalTasks)
-		for i := 0; i < totalTasks; i++ {
-			newDisplayStatus := models.NewDisplayVMStatus(
-				fmt.Sprintf("testVM%d", i+1),
-				models.AzureResourceStateNotStarted,
-			)
-			newDisplayStatus.Location = testutils.RandomRegion()
-			newDisplayStatus.StatusMessage = "Initializing"
-			newDisplayStatus.DetailedStatus = "Starting"
-			newDisplayStatus.ElapsedTime = 0
-			newDisplayStatus.InstanceID = fmt.Sprintf("test%d", i+1)
-
-			if i%2 == 0 {
-				newDisplayStatus.Orchestrator = false
-				newDisplayStatus.SSH = models.ServiceStateSucceeded
-				newDisplayStatus.Docker = models.ServiceStateFailed
-				newDisplayStatus.Bacalhau = models.ServiceStateSucceeded
-			} else {
-				newDisplayStatus.Orchestrator = true
-				newDisplayStatus.SSH = models.ServiceStateFailed
-				newDisplayStatus.Docker = models.ServiceStateSucceeded
-				newDisplayStatus.Bacalhau = models.ServiceStateFailed
-			}
-			newDisplayStatus.PublicIP = testutils.RandomIP()
-			newDisplayStatus.PrivateIP = testutils.RandomIP()
-			statuses[i] = newDisplayStatus
-			p.Send(models.StatusUpdateMsg{Status: statuses[i]})
-		}
-
-		wordTicker := time.NewTicker(1 * time.Second)
-		timeTicker := time.NewTicker(100 * time.Millisecond)
-		defer wordTicker.Stop()
-		defer timeTicker.Stop()
-
-		for {
-			select {
-			case <-wordTicker.C:
-				if os.Getenv("DEBUG_CHANNELS") == "1" {
-					fmt.Fprintf(LogFile, "wordTicker triggered\n")
-					LogFile.Sync()
-				}
-				for i := 0; i < totalTasks; i++ {
-					rawStatus := getRandomWords(3)
-					if len(rawStatus) > statusLength {
-						statuses[i].StatusMessage = rawStatus[:statusLength]
-					} else {
-						statuses[i].StatusMessage = fmt.Sprintf("%-*s", statusLength, rawStatus)
-					}
-					statuses[i].Progress = (statuses[i].Progress + 1) % 7
-					p.Send(models.StatusUpdateMsg{Status: statuses[i]})
-				}
-			case <-timeTicker.C:
-				if os.Getenv("DEBUG_CHANNELS") == "1" {
-					fmt.Fprintf(LogFile, "timeTicker triggered\n")
-					LogFile.Sync()
-				}
-				p.Send(models.TimeUpdateMsg{})
-			case <-done:
-				if os.Getenv("DEBUG_CHANNELS") == "1" {
-					fmt.Fprintf(LogFile, "done channel triggered\n")
-					LogFile.Sync()
-				}
-				return
-			}
-		}
-	}()
+	if err := source.Start(ctx, p); err != nil {
+		return fmt.Errorf("Error starting event source: %v", err)
+	}
 
 	if _, err := p.Run(); err != nil {
+		_ = source.Stop()
 		return fmt.Errorf("Error running program: %v", err)
 	}
 
+	if err := source.Stop(); err != nil {
+		return fmt.Errorf("Error stopping event source: %v", err)
+	}
+
+	if m.PersistState {
+		if err := m.SaveState(); err != nil {
+			return err
+		}
+	}
+
 	fmt.Println(m.RenderFinalTable())
+	return writeReports(m, cfg.Report)
+}
+
+// runHeadlessDisplay runs without a TUI, printing to out, and reports
+// whether any machine failed
+func runHeadlessDisplay(
+	ctx context.Context,
+	cfg *Config,
+	m *DisplayModel,
+	source events.EventSource,
+	out io.Writer,
+) (bool, error) {
+	if err := runHeadless(ctx, m, source, out, cfg.SummaryInterval); err != nil {
+		return false, err
+	}
+
+	if m.PersistState {
+		if err := m.SaveState(); err != nil {
+			return false, err
+		}
+	}
 
-	closeOnce.Do(func() { close(done) })
+	printSummary(out, m)
+	fmt.Fprintln(out, m.RenderFinalTable())
+	if err := writeReports(m, cfg.Report); err != nil {
+		return false, err
+	}
+	return anyMachineFailed(m), nil
+}
+
+// writeReports writes the final deployment to each of paths
+func writeReports(m *DisplayModel, paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	r := report.New(m.Deployment, time.Now())
+	for _, path := range paths {
+		if err := r.WriteFile(path); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// serveMetrics serves the collector at /metrics on addr in the background
+func serveMetrics(addr string, collector *metrics.Collector) (*http.Server, error) {
+	listener, err := api.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second, //nolint:gomnd
+	}
+	go server.Serve(listener) //nolint:errcheck
+	return server, nil
+}
+
+// selectGlyphSet returns the glyph set named by name or, if it is empty,
+// detects one from the locale and whether stdout is a terminal
+func selectGlyphSet(name string) (models.GlyphSet, error) {
+	if name == "" {
+		return models.DetectGlyphSet(os.Getenv, isatty.IsTerminal(os.Stdout.Fd())), nil
+	}
+	return models.LookupGlyphSet(name)
+}
@@ -0,0 +1,358 @@
+// Package api serves the display's deployment state over HTTP on localhost
+// or a Unix socket.
+//
+//	GET /api/deployment  the current deployment, as a report.Report
+//	GET /api/events      a Server-Sent Events stream of changes
+//
+// The stream opens with a "deployment" event holding the full snapshot,
+// followed by a "status" event for every status the display applies and a
+// "machine" event with the new state of every machine that changed. Event
+// IDs increase by one per event. Every payload carries schema_version,
+// which is bumped whenever a field is renamed or removed.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/report"
+)
+
+// SchemaVersion is the version of the event payloads; the deployment
+// snapshot carries report.SchemaVersion
+const SchemaVersion = 1
+
+// Event names on the SSE stream
+const (
+	EventDeployment = "deployment"
+	EventStatus     = "status"
+	EventMachine    = "machine"
+)
+
+// unixPrefix marks a listen address as a Unix socket path
+const unixPrefix = "unix:"
+
+const (
+	// subscriberBuffer is the number of events a slow client may fall behind
+	// before it is disconnected; it can reconnect for a fresh snapshot
+	subscriberBuffer = 256
+	// heartbeatInterval keeps idle connections open through proxies
+	heartbeatInterval = 15 * time.Second
+)
+
+// StatusEvent is a status the display applied
+type StatusEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Name          string    `json:"name"`
+	Provider      string    `json:"provider,omitempty"`
+	ResourceType  string    `json:"resource_type,omitempty"`
+	ResourceState string    `json:"resource_state"`
+	Location      string    `json:"location,omitempty"`
+	StatusMessage string    `json:"status_message,omitempty"`
+	PublicIP      string    `json:"public_ip,omitempty"`
+	PrivateIP     string    `json:"private_ip,omitempty"`
+	Orchestrator  bool      `json:"orchestrator,omitempty"`
+	// Service states are omitted when the status leaves them unchanged
+	SSH          string `json:"ssh,omitempty"`
+	Docker       string `json:"docker,omitempty"`
+	CorePackages string `json:"core_packages,omitempty"`
+	Bacalhau     string `json:"bacalhau,omitempty"`
+}
+
+// NewStatusEvent converts a status to its event payload
+func NewStatusEvent(status *models.DisplayStatus, now time.Time) StatusEvent {
+	service := func(state models.ServiceState) string {
+		if state == models.ServiceStateUnknown {
+			return ""
+		}
+		return state.String()
+	}
+	return StatusEvent{
+		SchemaVersion: SchemaVersion,
+		Time:          now,
+		Name:          status.Name,
+		Provider:      string(status.Type.Provider),
+		ResourceType:  status.Type.ShortResourceName,
+		ResourceState: status.ResourceState.String(),
+		Location:      status.Location,
+		StatusMessage: strings.TrimSpace(status.StatusMessage),
+		PublicIP:      status.PublicIP,
+		PrivateIP:     status.PrivateIP,
+		Orchestrator:  status.Orchestrator,
+		SSH:           service(status.SSH),
+		Docker:        service(status.Docker),
+		CorePackages:  service(status.CorePackages),
+		Bacalhau:      service(status.Bacalhau),
+	}
+}
+
+// MachineEvent is the new state of a machine after a change
+type MachineEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	report.MachineReport
+}
+
+// event is one encoded message on the stream
+type event struct {
+	id   uint64
+	name string
+	data []byte
+}
+
+// Server holds the latest deployment snapshot and the connected streams.
+// Publishing never blocks on clients.
+type Server struct {
+	mu          sync.Mutex
+	snapshot    []byte
+	seq         uint64
+	subscribers map[chan event]struct{}
+
+	http     *http.Server
+	listener net.Listener
+}
+
+// New returns a server with an empty deployment
+func New() *Server {
+	s := &Server{subscribers: map[chan event]struct{}{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/deployment", s.handleDeployment)
+	mux.HandleFunc("/api/events", s.handleEvents)
+	s.http = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second, //nolint:gomnd
+	}
+	s.PublishDeployment(models.NewDeployment())
+	return s
+}
+
+// Listen binds the server to addr, either "unix:<path>" or a host:port on a
+// loopback address, and serves in the background until Close
+func (s *Server) Listen(addr string) error {
+	listener, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go s.http.Serve(listener) //nolint:errcheck
+	return nil
+}
+
+// Addr is the address the server is listening on
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return ""
+	}
+	if s.listener.Addr().Network() == "unix" {
+		return unixPrefix + s.listener.Addr().String()
+	}
+	return s.listener.Addr().String()
+}
+
+// Listen opens a listener on addr, either "unix:<path>" or a host:port on a
+// loopback address. Socket files are only accessible to the current user.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if path == "" {
+			return nil, fmt.Errorf("api address %q has no socket path", addr)
+		}
+		// Replace a socket left behind by an earlier run, but nothing else
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+		}
+		if err := os.Chmod(path, 0o600); err != nil { //nolint:gomnd
+			listener.Close()
+			return nil, fmt.Errorf("failed to restrict %s: %w", path, err)
+		}
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid api address %q: %w", addr, err)
+	}
+	if !loopback(host) {
+		return nil, fmt.Errorf("api address %q is not on localhost", addr)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return listener, nil
+}
+
+// loopback reports whether host only resolves to loopback addresses
+func loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Close stops the server and ends every open stream
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.http.Shutdown(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
+
+// PublishDeployment replaces the snapshot served at /api/deployment. The
+// snapshot is taken before returning, so d may change afterwards.
+func (s *Server) PublishDeployment(d *models.Deployment) {
+	s.Publish(d, nil)
+}
+
+// Publish replaces the snapshot with d and sends status, if any, and the new
+// state of machines to every stream. Both happen under one lock, so a client
+// that connects meanwhile gets either the old snapshot and every event, or
+// the new snapshot and none of them.
+func (s *Server) Publish(d *models.Deployment, status *models.DisplayStatus, machines ...*models.Machine) {
+	now := time.Now()
+	snapshot, err := json.Marshal(report.New(d, now))
+	if err != nil {
+		return
+	}
+	var events []event
+	if status != nil {
+		if data, err := json.Marshal(NewStatusEvent(status, now)); err == nil {
+			events = append(events, event{name: EventStatus, data: data})
+		}
+	}
+	for _, machine := range machines {
+		data, err := json.Marshal(MachineEvent{
+			SchemaVersion: SchemaVersion,
+			Time:          now,
+			MachineReport: report.NewMachineReport(machine, now),
+		})
+		if err == nil {
+			events = append(events, event{name: EventMachine, data: data})
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = snapshot
+	for _, e := range events {
+		s.broadcast(e)
+	}
+}
+
+// broadcast numbers e and sends it to every stream; s.mu must be held
+func (s *Server) broadcast(e event) {
+	s.seq++
+	e.id = s.seq
+	for ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// Too far behind: end the stream rather than skip events
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// subscribe registers a stream and returns the snapshot it starts from
+func (s *Server) subscribe() (chan event, event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan event, subscriberBuffer)
+	s.subscribers[ch] = struct{}{}
+	return ch, event{id: s.seq, name: EventDeployment, data: s.snapshot}
+}
+
+func (s *Server) unsubscribe(ch chan event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscribers[ch]; ok {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (s *Server) handleDeployment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	data := s.snapshot
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)         //nolint:errcheck
+	w.Write([]byte{'\n'}) //nolint:errcheck
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, snapshot := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	if err := writeEvent(w, snapshot); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.name, e.data)
+	return err
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/report"
+)
+
+func startServer(t *testing.T) *Server {
+	t.Helper()
+	s := New()
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func oneMachine(name string) (*models.Deployment, *models.Machine) {
+	d := models.NewDeployment()
+	d.Machines = []models.Machine{{Name: name, Type: models.AzureResourceTypeVM, Provider: models.ProviderAzure}}
+	return d, &d.Machines[0]
+}
+
+func TestDeploymentEndpoint(t *testing.T) {
+	s := startServer(t)
+	d, _ := oneMachine("abc01-vm")
+	s.PublishDeployment(d)
+
+	resp, err := http.Get("http://" + s.Addr() + "/api/deployment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var got report.Report
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got.SchemaVersion != report.SchemaVersion || len(got.Machines) != 1 || got.Machines[0].Name != "abc01-vm" {
+		t.Errorf("deployment = %+v, want abc01-vm", got)
+	}
+
+	resp, err = http.Post("http://"+s.Addr()+"/api/deployment", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+type sseEvent struct {
+	id   uint64
+	name string
+	data string
+}
+
+// stream connects to the event stream and returns a function reading the
+// next event
+func stream(t *testing.T, s *Server) func() sseEvent {
+	t.Helper()
+	resp, err := http.Get("http://" + s.Addr() + "/api/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(nil, 1<<20) //nolint:gomnd
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return func() sseEvent {
+		t.Helper()
+		var e sseEvent
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					t.Fatal("the stream ended")
+				}
+				field, value, _ := strings.Cut(line, ": ")
+				switch field {
+				case "id":
+					e.id, _ = strconv.ParseUint(value, 10, 64)
+				case "event":
+					e.name = value
+				case "data":
+					e.data = value
+				case "":
+					if e.name != "" {
+						return e
+					}
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no event arrived")
+			}
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := startServer(t)
+	d, machine := oneMachine("abc01-vm")
+	s.PublishDeployment(d)
+	next := stream(t, s)
+
+	if e := next(); e.name != EventDeployment || e.id != 0 || !strings.Contains(e.data, `"abc01-vm"`) {
+		t.Fatalf("first event = %+v, want the deployment", e)
+	}
+
+	machine.SSH = models.ServiceStateSucceeded
+	status := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	status.SSH = models.ServiceStateSucceeded
+	s.Publish(d, status, machine)
+
+	e := next()
+	var got StatusEvent
+	if err := json.Unmarshal([]byte(e.data), &got); err != nil {
+		t.Fatal(err)
+	}
+	if e.name != EventStatus || e.id != 1 || got.Name != "abc01-vm" || got.SSH != "Succeeded" || got.Docker != "" {
+		t.Errorf("status event %d %s = %+v", e.id, e.name, got)
+	}
+	e = next()
+	var changed MachineEvent
+	if err := json.Unmarshal([]byte(e.data), &changed); err != nil {
+		t.Fatal(err)
+	}
+	if e.name != EventMachine || e.id != 2 || changed.Name != "abc01-vm" || changed.SSH != "Succeeded" {
+		t.Errorf("machine event %d %s = %+v", e.id, e.name, changed)
+	}
+
+	// A client connecting later starts from a snapshot holding the change,
+	// numbered after the events it already includes
+	if e := stream(t, s)(); e.id != 2 || !strings.Contains(e.data, `"ssh":"Succeeded"`) {
+		t.Errorf("later snapshot = %+v, want the change at id 2", e)
+	}
+}
+
+func TestSlowClientIsDisconnected(t *testing.T) {
+	s := New()
+	defer s.Close()
+	d, machine := oneMachine("abc01-vm")
+	slow, _ := s.subscribe()
+
+	for i := 0; i < subscriberBuffer; i++ {
+		s.Publish(d, nil, machine)
+	}
+	if subscriberCount(s) != 1 {
+		t.Fatal("disconnected a client that kept up")
+	}
+	s.Publish(d, nil, machine)
+	if subscriberCount(s) != 0 {
+		t.Fatal("a client that fell behind stayed connected")
+	}
+
+	// It still gets the events it had room for, then the end of the stream
+	var received int
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events, want %d", received, subscriberBuffer)
+	}
+}
+
+func subscriberCount(s *Server) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers)
+}
+
+func TestListenOnlyOnLocalhost(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:0", ":0", "192.0.2.1:8080", "example.com:80", "localhost", "unix:"} {
+		if listener, err := Listen(addr); err == nil {
+			listener.Close()
+			t.Errorf("Listen(%q) passed", addr)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:0", "localhost:0"} {
+		listener, err := Listen(addr)
+		if err != nil {
+			t.Errorf("Listen(%q): %v", addr, err)
+			continue
+		}
+		listener.Close()
+	}
+
+	path := filepath.Join(t.TempDir(), "api.sock")
+	listener, err := Listen(unixPrefix + path)
+	if err != nil {
+		t.Fatalf("Listen(unix): %v", err)
+	}
+	defer listener.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket mode %v, want 0600", perm)
+	}
+}
@@ -0,0 +1,237 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEndpoint is the public Azure Resource Manager endpoint
+	DefaultEndpoint = "https://management.azure.com"
+
+	resourcesAPIVersion = "2021-04-01"
+	requestTimeout      = 30 * time.Second
+)
+
+// ResourceLister lists the resources in a resource group as the raw maps
+// consumed by models.ConvertFromRawResourceToStatus. Each map has the keys
+// "name", "type", "location" and "provisioningState".
+type ResourceLister interface {
+	ListResources(ctx context.Context, resourceGroup string) ([]map[string]interface{}, error)
+}
+
+// TokenSource provides bearer tokens for ARM requests
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// CLITokenSource gets tokens from the Azure CLI and caches them until shortly
+// before they expire
+type CLITokenSource struct {
+	mu        sync.Mutex
+	token     string
+	expiresOn time.Time
+}
+
+func (c *CLITokenSource) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.expiresOn) > time.Minute {
+		return c.token, nil
+	}
+
+	out, err := exec.CommandContext(
+		ctx,
+		"az", "account", "get-access-token",
+		"--resource", DefaultEndpoint+"/",
+		"--output", "json",
+	).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token from az cli: %w", err)
+	}
+
+	var resp struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresOn   int64  `json:"expires_on"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return "", fmt.Errorf("failed to parse az cli token: %w", err)
+	}
+	c.token = resp.AccessToken
+	c.expiresOn = time.Unix(resp.ExpiresOn, 0)
+	if resp.ExpiresOn == 0 {
+		c.expiresOn = time.Now().Add(5 * time.Minute) //nolint:gomnd
+	}
+	return c.token, nil
+}
+
+// DefaultTokenSource uses AZURE_ACCESS_TOKEN when it is set and falls back to
+// the Azure CLI otherwise
+func DefaultTokenSource() TokenSource {
+	if token := os.Getenv("AZURE_ACCESS_TOKEN"); token != "" {
+		return StaticToken(token)
+	}
+	return &CLITokenSource{}
+}
+
+// ThrottledError is returned when ARM asks the caller to slow down
+type ThrottledError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("throttled by azure resource manager (HTTP %d), retry after %s", e.StatusCode, e.RetryAfter)
+}
+
+// IsThrottled reports whether err is a ThrottledError and returns it
+func IsThrottled(err error) (*ThrottledError, bool) {
+	var throttled *ThrottledError
+	ok := errors.As(err, &throttled)
+	return throttled, ok
+}
+
+// ARMClient lists resources using the ARM REST API
+type ARMClient struct {
+	Endpoint       string
+	SubscriptionID string
+	Tokens         TokenSource
+	HTTPClient     *http.Client
+}
+
+// NewARMClient returns a client for subscriptionID. An empty endpoint means
+// DefaultEndpoint.
+func NewARMClient(endpoint, subscriptionID string, tokens TokenSource) *ARMClient {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &ARMClient{
+		Endpoint:       strings.TrimSuffix(endpoint, "/"),
+		SubscriptionID: subscriptionID,
+		Tokens:         tokens,
+		HTTPClient:     &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type armResource struct {
+	Name              string `json:"name"`
+	Type              string `json:"type"`
+	Location          string `json:"location"`
+	ProvisioningState string `json:"provisioningState"`
+	Properties        struct {
+		ProvisioningState string `json:"provisioningState"`
+	} `json:"properties"`
+}
+
+type armResourceList struct {
+	Value    []armResource `json:"value"`
+	NextLink string        `json:"nextLink"`
+}
+
+// ListResources returns every resource in resourceGroup, following nextLink
+// pagination
+func (c *ARMClient) ListResources(
+	ctx context.Context,
+	resourceGroup string,
+) ([]map[string]interface{}, error) {
+	query := url.Values{}
+	query.Set("api-version", resourcesAPIVersion)
+	query.Set("$expand", "provisioningState")
+	next := fmt.Sprintf(
+		"%s/subscriptions/%s/resourceGroups/%s/resources?%s",
+		c.Endpoint,
+		url.PathEscape(c.SubscriptionID),
+		url.PathEscape(resourceGroup),
+		query.Encode(),
+	)
+
+	var resources []map[string]interface{}
+	for next != "" {
+		page, err := c.getPage(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page.Value {
+			state := r.ProvisioningState
+			if state == "" {
+				state = r.Properties.ProvisioningState
+			}
+			resources = append(resources, map[string]interface{}{
+				"name":              r.Name,
+				"type":              r.Type,
+				"location":          r.Location,
+				"provisioningState": state,
+			})
+		}
+		next = page.NextLink
+	}
+	return resources, nil
+}
+
+func (c *ARMClient) getPage(ctx context.Context, pageURL string) (*armResourceList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Tokens != nil {
+		token, err := c.Tokens.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return nil, &ThrottledError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to list resources: unexpected status %s", resp.Status)
+	}
+
+	var page armResourceList
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to decode resource list: %w", err)
+	}
+	return &page, nil
+}
+
+// parseRetryAfter handles both the delay-seconds and HTTP-date forms of the
+// Retry-After header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
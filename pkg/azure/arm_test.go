@@ -0,0 +1,106 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
+)
+
+func newFakeClient(t *testing.T) (*testutils.FakeARMServer, *ARMClient) {
+	t.Helper()
+	server := testutils.NewFakeARMServer()
+	t.Cleanup(server.Close)
+	return server, NewARMClient(server.URL, "sub", StaticToken("token"))
+}
+
+func TestListResourcesFollowsPages(t *testing.T) {
+	server, client := newFakeClient(t)
+	for i := 1; i <= 5; i++ {
+		server.SetResource("rg", testutils.FakeARMResource{
+			Name:              fmt.Sprintf("abc%02d-vm", i),
+			Type:              "Microsoft.Compute/virtualMachines",
+			Location:          "eastus",
+			ProvisioningState: "Succeeded",
+		})
+	}
+	server.SetPageSize(2)
+
+	resources, err := client.ListResources(context.Background(), "rg")
+	if err != nil {
+		t.Fatalf("ListResources: %v", err)
+	}
+	if len(resources) != 5 {
+		t.Fatalf("listed %d resources, want 5", len(resources))
+	}
+	for i, resource := range resources {
+		if want := fmt.Sprintf("abc%02d-vm", i+1); resource["name"] != want {
+			t.Errorf("resource %d is %v, want %s", i, resource["name"], want)
+		}
+		if resource["provisioningState"] != "Succeeded" || resource["location"] != "eastus" {
+			t.Errorf("resource %d = %v", i, resource)
+		}
+	}
+	if requests := server.Requests(); requests != 3 {
+		t.Errorf("made %d requests for 3 pages", requests)
+	}
+}
+
+func TestListResourcesEmptyGroup(t *testing.T) {
+	_, client := newFakeClient(t)
+	resources, err := client.ListResources(context.Background(), "empty")
+	if err != nil || len(resources) != 0 {
+		t.Fatalf("ListResources = %v, %v; want nothing", resources, err)
+	}
+}
+
+func TestListResourcesThrottled(t *testing.T) {
+	server, client := newFakeClient(t)
+	server.ThrottleNext(1, 7)
+
+	_, err := client.ListResources(context.Background(), "rg")
+	throttled, ok := IsThrottled(err)
+	if !ok {
+		t.Fatalf("err = %v, want a ThrottledError", err)
+	}
+	if throttled.StatusCode != http.StatusTooManyRequests || throttled.RetryAfter != 7*time.Second {
+		t.Errorf("throttled = %+v, want 429 retrying after 7s", throttled)
+	}
+
+	if _, err := client.ListResources(context.Background(), "rg"); err != nil {
+		t.Errorf("request after throttling: %v", err)
+	}
+}
+
+func TestListResourcesUnexpectedStatus(t *testing.T) {
+	_, client := newFakeClient(t)
+	// The escaped slash makes the path one segment too long for the fake
+	_, err := client.ListResources(context.Background(), "a/b")
+	if err == nil {
+		t.Fatal("want an error for a 404")
+	}
+	if _, ok := IsThrottled(err); ok {
+		t.Errorf("404 reported as throttling: %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		value    string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"soon", 0, 0},
+		{future, 50 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/azure"
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+var azureLog = logger.Component("azure")
+
+const (
+	defaultPollInterval = 10 * time.Second
+	maxPollBackoff      = 5 * time.Minute
+)
+
+func init() {
+	Register("azure", func(opts Options) (EventSource, error) {
+		if opts.SubscriptionID == "" {
+			return nil, fmt.Errorf("azure source requires a subscription ID")
+		}
+		if opts.ResourceGroup == "" {
+			return nil, fmt.Errorf("azure source requires a resource group")
+		}
+		client := azure.NewARMClient(opts.ARMEndpoint, opts.SubscriptionID, azure.DefaultTokenSource())
+		poller := NewAzurePoller(client, opts.ResourceGroup, opts.PollInterval)
+		if opts.Deployment != nil {
+			poller.AddPlannedMachines(opts.Deployment.Machines)
+		}
+		return poller, nil
+	})
+}
+
+// AzurePoller lists the resources in a resource group on an interval and
+// sends the resulting per-machine updates to the display. It keeps its own
+// Deployment so that ConvertFromRawResourceToStatus only reports changes.
+type AzurePoller struct {
+	runner
+	lister     azure.ResourceLister
+	interval   time.Duration
+	deployment *models.Deployment
+}
+
+// NewAzurePoller returns a poller for resourceGroup. A zero interval means
+// defaultPollInterval.
+func NewAzurePoller(lister azure.ResourceLister, resourceGroup string, interval time.Duration) *AzurePoller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	deployment := models.NewDeployment()
+	deployment.ResourceGroupName = resourceGroup
+	return &AzurePoller{
+		lister:     lister,
+		interval:   interval,
+		deployment: deployment,
+	}
+}
+
+// AddPlannedMachines seeds the poller with machines that are known before
+// their VMs exist, so location-scoped resources fan out to them straight away
+func (p *AzurePoller) AddPlannedMachines(machines []models.Machine) {
+	for _, machine := range machines {
+		if _, err := models.GetMachineIndexByName(machine.Name, p.deployment.Machines); err == nil {
+			continue
+		}
+		p.deployment.Machines = append(p.deployment.Machines, models.Machine{
+			Name:     machine.Name,
+			Type:     machine.Type,
+			Provider: machine.Provider,
+			Location: machine.Location,
+		})
+	}
+}
+
+// Start begins polling
+func (p *AzurePoller) Start(ctx context.Context, sender Sender) error {
+	return p.start(ctx, func(ctx context.Context) {
+		p.run(ctx, sender)
+	})
+}
+
+func (p *AzurePoller) run(ctx context.Context, sender Sender) {
+	failures := 0
+	delay := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		err := p.poll(ctx, sender)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			failures++
+			level := models.LogLevelError
+			if _, throttled := azure.IsThrottled(err); throttled {
+				level = models.LogLevelWarn
+			}
+			sender.Send(models.LogLineMsg{Text: fmt.Sprintf("azure: %v", err), Level: level})
+		} else {
+			failures = 0
+		}
+		delay = p.nextDelay(err, failures)
+		if err != nil {
+			azureLog.Warn("poll failed", "err", err, "failures", failures, "retry_in", delay)
+		}
+		sender.Send(models.TimeUpdateMsg{})
+	}
+}
+
+// nextDelay doubles the interval for every consecutive failure up to
+// maxPollBackoff, and never polls sooner than a throttling Retry-After
+func (p *AzurePoller) nextDelay(err error, failures int) time.Duration {
+	if err == nil {
+		return p.interval
+	}
+
+	delay := p.interval
+	for i := 0; i < failures && delay < maxPollBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxPollBackoff {
+		delay = maxPollBackoff
+	}
+	if throttled, ok := azure.IsThrottled(err); ok && throttled.RetryAfter > delay {
+		delay = throttled.RetryAfter
+	}
+	return delay
+}
+
+func (p *AzurePoller) poll(ctx context.Context, sender Sender) error {
+	resources, err := p.lister.ListResources(ctx, p.deployment.ResourceGroupName)
+	if err != nil {
+		return err
+	}
+	azureLog.Debug("listed resources", "resource_group", p.deployment.ResourceGroupName, "count", len(resources))
+
+	// Register every machine before converting, so location-scoped resources
+	// (e.g. eastus-vnet) fan out to all machines in that location
+	for _, resource := range resources {
+		p.addMachine(resource, sender)
+	}
+
+	for _, resource := range resources {
+		statuses, err := models.ConvertFromRawResourceToStatus(resource, p.deployment)
+		if err != nil {
+			name, _ := resource["name"].(string)
+			sender.Send(models.LogLineMsg{
+				Text:    fmt.Sprintf("azure: %v", err),
+				Machine: models.GetMachineNameFromResourceName(name),
+				Level:   models.LogLevelWarn,
+			})
+			continue
+		}
+		for i := range statuses {
+			sender.Send(models.StatusUpdateMsg{Status: &statuses[i]})
+		}
+	}
+	return nil
+}
+
+func (p *AzurePoller) addMachine(resource map[string]interface{}, sender Sender) {
+	name, _ := resource["name"].(string)
+	location, _ := resource["location"].(string)
+	machineName := models.GetMachineNameFromResourceName(name)
+	if machineName == "" {
+		return
+	}
+	if _, err := models.GetMachineIndexByName(machineName, p.deployment.Machines); err == nil {
+		return
+	}
+
+	p.deployment.Machines = append(p.deployment.Machines, models.Machine{
+		Name:      machineName,
+		Type:      models.AzureResourceTypeVM,
+		Provider:  models.ProviderAzure,
+		Location:  location,
+		StartTime: time.Now(),
+	})
+
+	status := models.NewDisplayVMStatus(machineName, models.AzureResourceStateNotStarted)
+	status.Location = location
+	sender.Send(models.StatusUpdateMsg{Status: status})
+}
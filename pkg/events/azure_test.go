@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/azure"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
+)
+
+func newFakePoller(t *testing.T) (*testutils.FakeARMServer, *AzurePoller) {
+	t.Helper()
+	server := testutils.NewFakeARMServer()
+	t.Cleanup(server.Close)
+	client := azure.NewARMClient(server.URL, "sub", azure.StaticToken("token"))
+	return server, NewAzurePoller(client, "rg", time.Second)
+}
+
+// statusesFor groups the status updates by machine name
+func statusesFor(sender *recordingSender) map[string][]*models.DisplayStatus {
+	byMachine := map[string][]*models.DisplayStatus{}
+	for _, status := range sender.statuses() {
+		byMachine[status.Name] = append(byMachine[status.Name], status)
+	}
+	return byMachine
+}
+
+func TestAzurePollerFansOutLocationResources(t *testing.T) {
+	server, poller := newFakePoller(t)
+	server.SetPageSize(1)
+	for _, resource := range []testutils.FakeARMResource{
+		// The location-scoped network comes first, before its machines
+		{Name: "eastus-vnet", Type: "Microsoft.Network/virtualNetworks", Location: "eastus", ProvisioningState: "Succeeded"},
+		{Name: "abc01-vm", Type: "Microsoft.Compute/virtualMachines", Location: "eastus", ProvisioningState: "Creating"},
+		{Name: "abc02-vm", Type: "Microsoft.Compute/virtualMachines", Location: "eastus", ProvisioningState: "Succeeded"},
+		{Name: "abc03-vm", Type: "Microsoft.Compute/virtualMachines", Location: "westus", ProvisioningState: "Succeeded"},
+	} {
+		server.SetResource("rg", resource)
+	}
+
+	sender := &recordingSender{}
+	if err := poller.poll(context.Background(), sender); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	byMachine := statusesFor(sender)
+	if len(byMachine) != 3 {
+		t.Fatalf("updated machines %v, want abc01-vm to abc03-vm", byMachine)
+	}
+	hasVNet := func(name string) bool {
+		for _, status := range byMachine[name] {
+			if status.Type == models.AzureResourceTypeVNET {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range []string{"abc01-vm", "abc02-vm"} {
+		if !hasVNet(name) {
+			t.Errorf("eastus-vnet not fanned out to %s", name)
+		}
+	}
+	if hasVNet("abc03-vm") {
+		t.Error("eastus-vnet fanned out to abc03-vm in westus")
+	}
+
+	// Unchanged resources aren't reported again
+	sender = &recordingSender{}
+	if err := poller.poll(context.Background(), sender); err != nil {
+		t.Fatalf("second poll: %v", err)
+	}
+	if statuses := sender.statuses(); len(statuses) != 0 {
+		t.Errorf("second poll sent %d updates for unchanged resources", len(statuses))
+	}
+}
+
+func TestAzurePollerReportsEveryChange(t *testing.T) {
+	server, poller := newFakePoller(t)
+	vm := testutils.FakeARMResource{Name: "abc01-vm", Type: "Microsoft.Compute/virtualMachines", Location: "eastus"}
+
+	// Forward, back and forward again; a missing state changes nothing
+	for _, step := range []struct {
+		armState string
+		want     models.AzureResourceState
+	}{
+		{"Creating", models.AzureResourceStatePending},
+		{"Running", models.AzureResourceStateRunning},
+		{"Succeeded", models.AzureResourceStateSucceeded},
+		{"Failed", models.AzureResourceStateFailed},
+		{"Updating", models.AzureResourceStatePending},
+		{"", models.AzureResourceStateUnknown},
+		{"Succeeded", models.AzureResourceStateSucceeded},
+	} {
+		vm.ProvisioningState = step.armState
+		server.SetResource("rg", vm)
+		sender := &recordingSender{}
+		if err := poller.poll(context.Background(), sender); err != nil {
+			t.Fatalf("poll: %v", err)
+		}
+
+		var reported []models.AzureResourceState
+		for _, status := range sender.statuses() {
+			if status.Type == models.AzureResourceTypeVM && status.ResourceState != models.AzureResourceStateNotStarted {
+				reported = append(reported, status.ResourceState)
+			}
+		}
+		switch {
+		case step.want == models.AzureResourceStateUnknown && len(reported) != 0:
+			t.Errorf("%q reported %v, want nothing", step.armState, reported)
+		case step.want != models.AzureResourceStateUnknown && (len(reported) != 1 || reported[0] != step.want):
+			t.Errorf("%q reported %v, want %v", step.armState, reported, step.want)
+		}
+	}
+}
+
+func TestAzurePollerPlannedMachines(t *testing.T) {
+	server, poller := newFakePoller(t)
+	poller.AddPlannedMachines([]models.Machine{{Name: "abc01-vm", Location: "eastus"}})
+	server.SetResource("rg", testutils.FakeARMResource{
+		Name: "eastus-nsg", Type: "Microsoft.Network/networkSecurityGroups", Location: "eastus", ProvisioningState: "Succeeded",
+	})
+
+	sender := &recordingSender{}
+	if err := poller.poll(context.Background(), sender); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if statuses := statusesFor(sender)["abc01-vm"]; len(statuses) != 1 || statuses[0].Type != models.AzureResourceTypeNSG {
+		t.Errorf("planned machine got %+v, want the NSG before its VM exists", statuses)
+	}
+}
+
+func TestAzurePollerThrottled(t *testing.T) {
+	server, poller := newFakePoller(t)
+	server.ThrottleNext(1, 90)
+
+	err := poller.poll(context.Background(), &recordingSender{})
+	if _, ok := azure.IsThrottled(err); !ok {
+		t.Fatalf("poll err = %v, want throttling", err)
+	}
+	if delay := poller.nextDelay(err, 1); delay != 90*time.Second {
+		t.Errorf("delay after throttling = %s, want the 90s Retry-After", delay)
+	}
+}
+
+func TestAzurePollerNextDelay(t *testing.T) {
+	poller := NewAzurePoller(nil, "rg", 10*time.Second)
+	failed := errors.New("boom")
+	tests := []struct {
+		name     string
+		err      error
+		failures int
+		want     time.Duration
+	}{
+		{"success", nil, 0, 10 * time.Second},
+		{"first failure", failed, 1, 20 * time.Second},
+		{"third failure", failed, 3, 80 * time.Second},
+		{"capped", failed, 20, maxPollBackoff},
+		{"short retry-after", &azure.ThrottledError{RetryAfter: time.Second}, 1, 20 * time.Second},
+		{"long retry-after", &azure.ThrottledError{RetryAfter: time.Hour}, 1, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := poller.nextDelay(tt.err, tt.failures); got != tt.want {
+				t.Errorf("nextDelay = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzurePollerRunReportsThrottlingAsWarning(t *testing.T) {
+	server, poller := newFakePoller(t)
+	server.ThrottleNext(1, 60)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sender := &recordingSender{}
+	if err := poller.Start(ctx, sender); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sender.logLines()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := poller.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	lines := sender.logLines()
+	if len(lines) == 0 || lines[0].Level != models.LogLevelWarn {
+		t.Fatalf("log lines = %+v, want a throttling warning", lines)
+	}
+	if requests := server.Requests(); requests != 1 {
+		t.Errorf("made %d requests before the Retry-After elapsed", requests)
+	}
+}
@@ -0,0 +1,152 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
+)
+
+var demoLog = logger.Component("demo")
+
+const demoStatusLength = 30
+
+var demoWords = []string{
+	"apple", "banana", "cherry", "date", "elderberry",
+	"fig", "grape", "honeydew", "kiwi", "lemon",
+	"mango", "nectarine", "orange", "papaya", "quince",
+	"raspberry", "strawberry", "tangerine", "ugli", "watermelon",
+}
+
+func init() {
+	Register("demo", func(Options) (EventSource, error) { return NewDemoSource(5), nil })
+}
+
+// DemoSource creates a fixed number of test VMs and cycles random words
+// through their status column. Cancelled machines stop changing until they
+// are retried.
+type DemoSource struct {
+	runner
+	totalTasks int
+	commands   commandQueue
+}
+
+// NewDemoSource returns a DemoSource that drives totalTasks machines
+func NewDemoSource(totalTasks int) *DemoSource {
+	return &DemoSource{totalTasks: totalTasks, commands: newCommandQueue()}
+}
+
+// Execute queues cmd for the running source
+func (s *DemoSource) Execute(cmd Command) error {
+	return s.commands.push(s.Done(), cmd)
+}
+
+// Start begins sending demo updates to sender
+func (s *DemoSource) Start(ctx context.Context, sender Sender) error {
+	return s.start(ctx, func(ctx context.Context) {
+		s.run(ctx, sender)
+	})
+}
+
+func (s *DemoSource) run(ctx context.Context, sender Sender) {
+	demoLog.Debug("starting", "machines", s.totalTasks)
+
+	statuses := make([]*models.DisplayStatus, s.totalTasks)
+	for i := 0; i < s.totalTasks; i++ {
+		newDisplayStatus := models.NewDisplayVMStatus(
+			fmt.Sprintf("testVM%d", i+1),
+			models.AzureResourceStateNotStarted,
+		)
+		newDisplayStatus.Location = testutils.RandomRegion()
+		newDisplayStatus.StatusMessage = "Initializing"
+		newDisplayStatus.DetailedStatus = "Starting"
+		newDisplayStatus.ElapsedTime = 0
+		newDisplayStatus.InstanceID = fmt.Sprintf("test%d", i+1)
+
+		if i%2 == 0 {
+			newDisplayStatus.Orchestrator = false
+			newDisplayStatus.SSH = models.ServiceStateSucceeded
+			newDisplayStatus.Docker = models.ServiceStateFailed
+			newDisplayStatus.Bacalhau = models.ServiceStateSucceeded
+		} else {
+			newDisplayStatus.Orchestrator = true
+			newDisplayStatus.SSH = models.ServiceStateFailed
+			newDisplayStatus.Docker = models.ServiceStateSucceeded
+			newDisplayStatus.Bacalhau = models.ServiceStateFailed
+		}
+		newDisplayStatus.PublicIP = testutils.RandomIP()
+		newDisplayStatus.PrivateIP = testutils.RandomIP()
+		statuses[i] = newDisplayStatus
+		sendStatus(sender, statuses[i])
+	}
+
+	cancelled := map[string]bool{}
+	wordTicker := time.NewTicker(1 * time.Second)
+	timeTicker := time.NewTicker(100 * time.Millisecond)
+	defer wordTicker.Stop()
+	defer timeTicker.Stop()
+
+	for {
+		select {
+		case <-wordTicker.C:
+			for i := 0; i < s.totalTasks; i++ {
+				if cancelled[statuses[i].Name] {
+					continue
+				}
+				rawStatus := getRandomWords(3)
+				if len(rawStatus) > demoStatusLength {
+					statuses[i].StatusMessage = rawStatus[:demoStatusLength]
+				} else {
+					statuses[i].StatusMessage = fmt.Sprintf("%-*s", demoStatusLength, rawStatus)
+				}
+				statuses[i].Progress = (statuses[i].Progress + 1) % 7
+				sendStatus(sender, statuses[i])
+			}
+		case <-timeTicker.C:
+			sender.Send(models.TimeUpdateMsg{})
+		case cmd := <-s.commands:
+			s.execute(cmd, statuses, cancelled, sender)
+		case <-ctx.Done():
+			demoLog.Debug("stopped")
+			return
+		}
+	}
+}
+
+// execute applies cmd to its machine and sends the machine's new status
+func (s *DemoSource) execute(cmd Command, statuses []*models.DisplayStatus, cancelled map[string]bool, sender Sender) {
+	index := slices.IndexFunc(statuses, func(status *models.DisplayStatus) bool { return status.Name == cmd.Machine })
+	if index < 0 {
+		commandFailed(sender, "demo", cmd, fmt.Errorf("no demo machine named %q", cmd.Machine))
+		return
+	}
+	if err := applyCommand(statuses[index], cmd.Action); err != nil {
+		commandFailed(sender, "demo", cmd, err)
+		return
+	}
+	demoLog.Info("command executed", logger.MachineKey, cmd.Machine, "action", cmd.Action)
+	cancelled[cmd.Machine] = cmd.Action == ActionCancel
+	sendStatus(sender, statuses[index])
+}
+
+func getRandomWords(n int) string {
+	words := make([]string, len(demoWords))
+	copy(words, demoWords)
+	rand.Shuffle(len(words), func(i, j int) {
+		words[i], words[j] = words[j], words[i]
+	})
+	return strings.Join(words[:n], " ")
+}
+
+// sendStatus sends a copy of status so the source can keep mutating its own
+// value after the display has received it
+func sendStatus(sender Sender, status *models.DisplayStatus) {
+	statusCopy := *status
+	sender.Send(models.StatusUpdateMsg{Status: &statusCopy})
+}
@@ -0,0 +1,238 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Sender is the part of *tea.Program an EventSource needs to deliver messages
+// to the display.
+type Sender interface {
+	Send(msg tea.Msg)
+}
+
+// EventSource produces the messages that drive the display:
+// models.StatusUpdateMsg, models.TimeUpdateMsg and models.LogLineMsg.
+//
+// Start must not block; the source runs until ctx is cancelled, Stop is
+// called or it runs out of events. Stop waits for the source to finish
+// sending. Done is closed once the source has stopped sending.
+type EventSource interface {
+	Start(ctx context.Context, sender Sender) error
+	Stop() error
+	Done() <-chan struct{}
+}
+
+// Options carries the startup settings an event source may need. Each
+// source reads only the fields that apply to it.
+type Options struct {
+	// Input is the path of the file to read from; "-" means stdin
+	Input string
+	// Follow keeps reading Input as it grows instead of stopping at EOF
+	Follow bool
+
+	// SubscriptionID and ResourceGroup select what the azure source polls
+	SubscriptionID string
+	ResourceGroup  string
+	// PollInterval is the time between successful polls
+	PollInterval time.Duration
+	// ARMEndpoint overrides the Azure Resource Manager endpoint
+	ARMEndpoint string
+
+	// Deployment is the planned deployment, if a plan was loaded. Sources
+	// must not modify it.
+	Deployment *models.Deployment
+
+	// Speed scales time for the replay and sim sources; 2 plays twice as
+	// fast and 0 sends events as fast as the display takes them
+	Speed float64
+	// Seed overrides the scenario's seed for the sim source when non-zero
+	Seed uint64
+	// ReplayStep makes the replay source wait for Step before each entry
+	ReplayStep bool
+	// Interactive is set when the display takes commands from the user.
+	// Sources that accept commands keep running after their events run out.
+	Interactive bool
+}
+
+// Stepper is implemented by sources that can be advanced one event at a time
+type Stepper interface {
+	Step()
+}
+
+// Action is something the user asks the event source to do to a machine
+type Action string
+
+const (
+	// ActionRetry reruns the step that failed and everything after it
+	ActionRetry Action = "retry"
+	// ActionCancel stops the machine's rollout and marks it failed
+	ActionCancel Action = "cancel"
+)
+
+// Command is an action on one machine
+type Command struct {
+	Action  Action
+	Machine string
+}
+
+// Commander is implemented by sources that can act on commands from the
+// display. Execute must not block; the outcome arrives as the status
+// updates the source sends afterwards.
+type Commander interface {
+	Execute(cmd Command) error
+}
+
+// Factory creates a new, unstarted EventSource
+type Factory func(opts Options) (EventSource, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an event source available by name
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// New returns the event source registered under name
+func New(name string, opts Options) (EventSource, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown event source %q (available: %v)", name, Names())
+	}
+	return factory(opts)
+}
+
+// Names returns the names of all registered event sources
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runner holds the start/stop plumbing shared by the event sources
+type runner struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+	done    chan struct{}
+}
+
+func (r *runner) start(ctx context.Context, fn func(ctx context.Context)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started {
+		return fmt.Errorf("event source already started")
+	}
+	r.started = true
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	done := r.doneChan()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(done)
+		fn(ctx)
+	}()
+	return nil
+}
+
+// Done is closed once the source's goroutine has returned
+func (r *runner) Done() <-chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.doneChan()
+}
+
+// doneChan lazily creates the done channel; r.mu must be held
+func (r *runner) doneChan() chan struct{} {
+	if r.done == nil {
+		r.done = make(chan struct{})
+	}
+	return r.done
+}
+
+// Stop cancels the source and waits for it to return
+func (r *runner) Stop() error {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	r.wg.Wait()
+	return nil
+}
+
+// commandQueue carries commands from the display to a source's goroutine
+type commandQueue chan Command
+
+func newCommandQueue() commandQueue {
+	return make(commandQueue, 16) //nolint:gomnd
+}
+
+// push queues cmd without blocking, failing once done is closed
+func (q commandQueue) push(done <-chan struct{}, cmd Command) error {
+	select {
+	case <-done:
+		return fmt.Errorf("the event source has stopped")
+	default:
+	}
+	select {
+	case q <- cmd:
+		return nil
+	default:
+		return fmt.Errorf("too many commands pending, try again")
+	}
+}
+
+// applyCommand retries or cancels a made-up machine by changing its status:
+// retry clears whatever failed and cancel fails the machine
+func applyCommand(status *models.DisplayStatus, action Action) error {
+	switch action {
+	case ActionRetry:
+		for _, state := range []*models.ServiceState{&status.SSH, &status.Docker, &status.CorePackages, &status.Bacalhau} {
+			if *state == models.ServiceStateFailed {
+				*state = models.ServiceStateSucceeded
+			}
+		}
+		if status.ResourceState == models.AzureResourceStateFailed {
+			status.ResourceState = models.AzureResourceStateSucceeded
+		}
+		status.StatusMessage = "Retried"
+	case ActionCancel:
+		status.ResourceState = models.AzureResourceStateFailed
+		status.StatusMessage = "Cancelled"
+	default:
+		return fmt.Errorf("unsupported action %q", action)
+	}
+	return nil
+}
+
+// commandFailed reports a command that couldn't be carried out in the log
+// pane
+func commandFailed(sender Sender, source string, cmd Command, err error) {
+	sender.Send(models.LogLineMsg{
+		Text:    fmt.Sprintf("%s: %s failed: %v", source, cmd.Action, err),
+		Machine: cmd.Machine,
+		Level:   models.LogLevelError,
+	})
+}
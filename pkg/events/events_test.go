@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// waitFor polls sender until found reports true
+func waitFor(t *testing.T, sender *recordingSender, what string, found func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !found() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s arrived", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// statusWith is whether sender has had a status for name with message
+func statusWith(sender *recordingSender, name, message string) func() bool {
+	return func() bool {
+		for _, status := range sender.statuses() {
+			if status.Name == name && status.StatusMessage == message {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	for _, name := range []string{"azure", "demo", "jsonl", "random", "replay", "sim"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("%s isn't registered: %v", name, names)
+		}
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("names aren't sorted: %v", names)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var got Options
+	factory := func(opts Options) (EventSource, error) {
+		got = opts
+		return NewDemoSource(1), nil
+	}
+	Register("test-source", factory)
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		delete(registry, "test-source")
+	})
+
+	if !slices.Contains(Names(), "test-source") {
+		t.Errorf("test-source isn't listed: %v", Names())
+	}
+	source, err := New("test-source", Options{Input: "in.jsonl", Speed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := source.(*DemoSource); !ok {
+		t.Errorf("New made a %T", source)
+	}
+	if got.Input != "in.jsonl" || got.Speed != 2 {
+		t.Errorf("the factory got %+v", got)
+	}
+
+	// Registering a name again replaces its factory
+	Register("test-source", func(Options) (EventSource, error) { return nil, errors.New("broken") })
+	if _, err := New("test-source", Options{}); err == nil || err.Error() != "broken" {
+		t.Errorf("New = %v, want the replacement factory's error", err)
+	}
+}
+
+func TestNewUnknownSource(t *testing.T) {
+	_, err := New("carrier-pigeon", Options{})
+	if err == nil {
+		t.Fatal("New made an unknown source")
+	}
+	if !strings.Contains(err.Error(), `"carrier-pigeon"`) || !strings.Contains(err.Error(), "demo") {
+		t.Errorf("error %q doesn't name the source and the ones available", err)
+	}
+}
+
+func TestSourceStartsOnce(t *testing.T) {
+	source := NewDemoSource(1)
+	sender := &recordingSender{}
+	if err := source.Start(context.Background(), sender); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Start(context.Background(), sender); err == nil {
+		t.Error("started twice")
+	}
+	if err := source.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-source.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done isn't closed after Stop")
+	}
+}
+
+func TestMadeUpSourcesTakeCommands(t *testing.T) {
+	for _, name := range []string{"demo", "random"} {
+		t.Run(name, func(t *testing.T) {
+			source, err := New(name, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			commander, ok := source.(Commander)
+			if !ok {
+				t.Fatalf("the %s source doesn't take commands", name)
+			}
+			sender := &recordingSender{}
+			if err := source.Start(context.Background(), sender); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, sender, "machine", func() bool { return len(sender.statuses()) > 0 })
+			machine := sender.statuses()[0].Name
+
+			if err := commander.Execute(Command{Action: ActionCancel, Machine: machine}); err != nil {
+				t.Fatalf("cancel: %v", err)
+			}
+			waitFor(t, sender, "cancelled status", statusWith(sender, machine, "Cancelled"))
+			if err := commander.Execute(Command{Action: ActionRetry, Machine: machine}); err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+			waitFor(t, sender, "retried status", statusWith(sender, machine, "Retried"))
+
+			if err := commander.Execute(Command{Action: ActionCancel, Machine: "nobody"}); err != nil {
+				t.Fatalf("cancel: %v", err)
+			}
+			waitFor(t, sender, "error", func() bool {
+				for _, line := range sender.logLines() {
+					if line.Level == models.LogLevelError && strings.Contains(line.Text, `"nobody"`) {
+						return true
+					}
+				}
+				return false
+			})
+
+			if err := source.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			if err := commander.Execute(Command{Action: ActionRetry, Machine: machine}); err == nil {
+				t.Error("a stopped source took a command")
+			}
+		})
+	}
+}
+
+func TestApplyCommand(t *testing.T) {
+	status := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	status.SSH = models.ServiceStateSucceeded
+	status.Docker = models.ServiceStateFailed
+
+	if err := applyCommand(status, ActionCancel); err != nil {
+		t.Fatal(err)
+	}
+	if status.ResourceState != models.AzureResourceStateFailed || status.StatusMessage != "Cancelled" {
+		t.Errorf("after cancel: %v %q", status.ResourceState, status.StatusMessage)
+	}
+
+	if err := applyCommand(status, ActionRetry); err != nil {
+		t.Fatal(err)
+	}
+	if status.ResourceState != models.AzureResourceStateSucceeded || status.Docker != models.ServiceStateSucceeded ||
+		status.Bacalhau != models.ServiceStateUnknown {
+		t.Errorf("after retry: %v, Docker %v, Bacalhau %v", status.ResourceState, status.Docker, status.Bacalhau)
+	}
+
+	if err := applyCommand(status, "reboot"); err == nil {
+		t.Error("applied an unknown action")
+	}
+}
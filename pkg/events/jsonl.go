@@ -0,0 +1,288 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+var jsonlLog = logger.Component("jsonl")
+
+// followPollInterval is how often a followed file is checked for new data
+const followPollInterval = 250 * time.Millisecond
+
+func init() {
+	Register("jsonl", func(opts Options) (EventSource, error) {
+		return NewJSONLinesSource(opts.Input, opts.Follow), nil
+	})
+}
+
+// StatusRecord is the wire schema of one line of a JSON-lines status stream.
+// Every line is a single JSON object; only "name" is required. Service and
+// resource states use their string names (e.g. "Succeeded", "NotStarted").
+// "provider" (Azure, AWS or GCP, default Azure) selects the catalog "type"
+// is looked up in, and defaults "type" to that provider's machine type.
+//
+//	{"name":"abc123-vm","type":"VM","state":"Running","location":"eastus",
+//	 "public_ip":"1.2.3.4","ssh":"Succeeded","docker":"Updating","progress":3}
+//
+// "value" is shown with the resource in the detail pane, e.g. an IP's
+// address.
+//
+// A line with a "log" field (and optionally "level": "debug", "info",
+// "warn" or "error") is shown in the log pane. Its "name", if any, only tags
+// the log line with the machine; the table is updated only if the line also
+// carries status fields.
+type StatusRecord struct {
+	Name           string                     `json:"name,omitempty"`
+	Provider       string                     `json:"provider,omitempty"`
+	Type           string                     `json:"type,omitempty"`
+	State          *models.AzureResourceState `json:"state,omitempty"`
+	Location       string                     `json:"location,omitempty"`
+	Status         string                     `json:"status,omitempty"`
+	DetailedStatus string                     `json:"detailed_status,omitempty"`
+	InstanceID     string                     `json:"instance_id,omitempty"`
+	PublicIP       string                     `json:"public_ip,omitempty"`
+	PrivateIP      string                     `json:"private_ip,omitempty"`
+	Value          string                     `json:"value,omitempty"`
+	Orchestrator   bool                       `json:"orchestrator,omitempty"`
+	SSH            *models.ServiceState       `json:"ssh,omitempty"`
+	Docker         *models.ServiceState       `json:"docker,omitempty"`
+	CorePackages   *models.ServiceState       `json:"core_packages,omitempty"`
+	Bacalhau       *models.ServiceState       `json:"bacalhau,omitempty"`
+	Progress       int                        `json:"progress,omitempty"`
+	ElapsedSeconds float64                    `json:"elapsed_seconds,omitempty"`
+	Log            string                     `json:"log,omitempty"`
+	Level          models.LogLevel            `json:"level,omitempty"`
+}
+
+// ToDisplayStatus converts the record into a DisplayStatus. Service states
+// that are absent from the record are left as ServiceStateUnknown so they do
+// not overwrite the machine's current state.
+func (r *StatusRecord) ToDisplayStatus() (*models.DisplayStatus, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("missing required field \"name\"")
+	}
+
+	provider, err := models.ParseProvider(r.Provider)
+	if err != nil {
+		return nil, err
+	}
+	resourceType := models.MachineResourceType(provider)
+	if r.Type != "" {
+		resourceType = models.LookupResourceType(provider, r.Type)
+		if resourceType.ResourceString == "" {
+			return nil, fmt.Errorf("unknown %s resource type: %q", provider, r.Type)
+		}
+	}
+
+	status := &models.DisplayStatus{
+		ID:             r.Name,
+		Name:           r.Name,
+		Type:           resourceType,
+		Location:       r.Location,
+		StatusMessage:  r.Status,
+		DetailedStatus: r.DetailedStatus,
+		InstanceID:     r.InstanceID,
+		PublicIP:       r.PublicIP,
+		PrivateIP:      r.PrivateIP,
+		ResourceValue:  r.Value,
+		Orchestrator:   r.Orchestrator,
+		Progress:       r.Progress,
+		ElapsedTime:    time.Duration(r.ElapsedSeconds * float64(time.Second)),
+		SSH:            serviceStateOrUnknown(r.SSH),
+		Docker:         serviceStateOrUnknown(r.Docker),
+		CorePackages:   serviceStateOrUnknown(r.CorePackages),
+		Bacalhau:       serviceStateOrUnknown(r.Bacalhau),
+	}
+	if r.State != nil {
+		status.ResourceState = *r.State
+		if status.StatusMessage == "" {
+			status.StatusMessage = models.CreateStateMessage(resourceType, *r.State, r.Name)
+		}
+	}
+	return status, nil
+}
+
+// hasStatus reports whether the record sets anything besides its name and
+// log line
+func (r *StatusRecord) hasStatus() bool {
+	status := *r
+	status.Name, status.Log, status.Level = "", "", 0
+	return status != StatusRecord{}
+}
+
+func serviceStateOrUnknown(state *models.ServiceState) models.ServiceState {
+	if state == nil {
+		return models.ServiceStateUnknown
+	}
+	return *state
+}
+
+// JSONLinesSource reads newline-delimited StatusRecords from a file or stdin
+// and turns each one into a StatusUpdateMsg. Malformed lines are reported in
+// the log box and skipped.
+type JSONLinesSource struct {
+	runner
+	path   string
+	follow bool
+}
+
+// NewJSONLinesSource returns a source reading from path ("-" for stdin). When
+// follow is set the file is tailed as it grows.
+func NewJSONLinesSource(path string, follow bool) *JSONLinesSource {
+	if path == "" {
+		path = "-"
+	}
+	return &JSONLinesSource{path: path, follow: follow}
+}
+
+// Start opens the input and begins streaming it to sender
+func (s *JSONLinesSource) Start(ctx context.Context, sender Sender) error {
+	var input io.ReadCloser = os.Stdin
+	if s.path != "-" {
+		f, err := os.Open(s.path)
+		if err != nil {
+			return fmt.Errorf("failed to open status stream: %w", err)
+		}
+		input = f
+	}
+
+	return s.start(ctx, func(ctx context.Context) {
+		if input != os.Stdin {
+			defer input.Close()
+		}
+		s.run(ctx, input, sender)
+	})
+}
+
+type jsonLine struct {
+	data []byte
+	err  error
+}
+
+func (s *JSONLinesSource) run(ctx context.Context, input io.Reader, sender Sender) {
+	// Reads from stdin cannot be interrupted, so the reader runs on its own
+	// goroutine and this loop only waits on it while ctx is live.
+	lines := make(chan jsonLine)
+	go s.readLines(ctx, input, lines)
+
+	lineNumber := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				sender.Send(models.LogLineMsg{
+					Text:  fmt.Sprintf("jsonl: end of input after %d lines", lineNumber),
+					Level: models.LogLevelInfo,
+				})
+				return
+			}
+			if line.err != nil {
+				sender.Send(models.LogLineMsg{
+					Text:  fmt.Sprintf("jsonl: read error: %v", line.err),
+					Level: models.LogLevelError,
+				})
+				return
+			}
+			lineNumber++
+			s.handleLine(lineNumber, line.data, sender)
+		}
+	}
+}
+
+func (s *JSONLinesSource) readLines(ctx context.Context, input io.Reader, lines chan<- jsonLine) {
+	defer close(lines)
+
+	reader := bufio.NewReader(input)
+	var pending []byte
+	for {
+		chunk, err := reader.ReadBytes('\n')
+		pending = append(pending, chunk...)
+
+		if err == nil {
+			if !s.emit(ctx, lines, jsonLine{data: pending}) {
+				return
+			}
+			pending = nil
+			continue
+		}
+
+		if err != io.EOF {
+			s.emit(ctx, lines, jsonLine{err: err})
+			return
+		}
+
+		if !s.follow {
+			if len(bytes.TrimSpace(pending)) > 0 {
+				s.emit(ctx, lines, jsonLine{data: pending})
+			}
+			return
+		}
+
+		// Keep any partial line and wait for the writer to finish it
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(followPollInterval):
+		}
+	}
+}
+
+func (s *JSONLinesSource) emit(ctx context.Context, lines chan<- jsonLine, line jsonLine) bool {
+	select {
+	case lines <- line:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *JSONLinesSource) handleLine(lineNumber int, data []byte, sender Sender) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return
+	}
+
+	var record StatusRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		jsonlLog.Warn("malformed line", "line", lineNumber, "err", err)
+		sender.Send(models.LogLineMsg{
+			Text:  fmt.Sprintf("jsonl: line %d: %v", lineNumber, err),
+			Level: models.LogLevelError,
+		})
+		return
+	}
+
+	if record.Log != "" {
+		sender.Send(models.LogLineMsg{
+			Text:    record.Log,
+			Machine: record.Name,
+			Level:   record.Level,
+		})
+		if !record.hasStatus() {
+			return
+		}
+	}
+
+	status, err := record.ToDisplayStatus()
+	if err != nil {
+		sender.Send(models.LogLineMsg{
+			Text:    fmt.Sprintf("jsonl: line %d: %v", lineNumber, err),
+			Machine: record.Name,
+			Level:   models.LogLevelError,
+		})
+		return
+	}
+	sender.Send(models.StatusUpdateMsg{Status: status})
+}
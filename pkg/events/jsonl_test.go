@@ -0,0 +1,181 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// recordingSender collects the messages a source sends
+type recordingSender struct {
+	mu   sync.Mutex
+	msgs []tea.Msg
+}
+
+func (r *recordingSender) Send(msg tea.Msg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *recordingSender) messages() []tea.Msg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]tea.Msg(nil), r.msgs...)
+}
+
+// statuses and logLines split the recorded messages by type
+func (r *recordingSender) statuses() []*models.DisplayStatus {
+	var statuses []*models.DisplayStatus
+	for _, msg := range r.messages() {
+		if update, ok := msg.(models.StatusUpdateMsg); ok {
+			statuses = append(statuses, update.Status)
+		}
+	}
+	return statuses
+}
+
+func (r *recordingSender) logLines() []models.LogLineMsg {
+	var lines []models.LogLineMsg
+	for _, msg := range r.messages() {
+		if line, ok := msg.(models.LogLineMsg); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func handle(t *testing.T, line string) *recordingSender {
+	t.Helper()
+	sender := &recordingSender{}
+	NewJSONLinesSource("-", false).handleLine(1, []byte(line), sender)
+	return sender
+}
+
+func TestJSONLinesMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"not JSON", `{"name": "abc`, "jsonl: line 1:"},
+		{"missing name", `{"state": "Succeeded"}`, `missing required field "name"`},
+		{"unknown state", `{"name": "abc-vm", "state": "Sideways"}`, "jsonl: line 1:"},
+		{"unknown provider", `{"name": "abc-vm", "provider": "Oracle"}`, "jsonl: line 1:"},
+		{"unknown type", `{"name": "abc-vm", "type": "TOASTER"}`, "unknown Azure resource type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := handle(t, tt.line)
+			if statuses := sender.statuses(); len(statuses) != 0 {
+				t.Fatalf("sent %d status updates for a malformed line", len(statuses))
+			}
+			lines := sender.logLines()
+			if len(lines) != 1 || lines[0].Level != models.LogLevelError || !strings.Contains(lines[0].Text, tt.want) {
+				t.Fatalf("log lines = %+v, want one error containing %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLinesBlankLineIsIgnored(t *testing.T) {
+	if msgs := handle(t, "   ").messages(); len(msgs) != 0 {
+		t.Fatalf("sent %v for a blank line", msgs)
+	}
+}
+
+func TestJSONLinesLogOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantMachine string
+		wantLevel   models.LogLevel
+	}{
+		{"untagged", `{"log": "hello"}`, "", models.LogLevelInfo},
+		{"with level", `{"log": "hello", "level": "warn"}`, "", models.LogLevelWarn},
+		{"tagged with a machine", `{"log": "hello", "name": "abc-vm", "level": "debug"}`, "abc-vm", models.LogLevelDebug},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := handle(t, tt.line)
+			if statuses := sender.statuses(); len(statuses) != 0 {
+				t.Fatalf("log-only line sent status updates %+v", statuses)
+			}
+			lines := sender.logLines()
+			if len(lines) != 1 {
+				t.Fatalf("sent %d log lines, want 1", len(lines))
+			}
+			if lines[0].Text != "hello" || lines[0].Machine != tt.wantMachine || lines[0].Level != tt.wantLevel {
+				t.Errorf("log line = %+v, want hello for %q at %v", lines[0], tt.wantMachine, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestJSONLinesStatus(t *testing.T) {
+	sender := handle(t, `{"name": "abc-vm", "state": "Succeeded", "location": "eastus",`+
+		` "public_ip": "1.2.3.4", "ssh": "Succeeded", "progress": 3, "elapsed_seconds": 1.5}`)
+	statuses := sender.statuses()
+	if len(statuses) != 1 {
+		t.Fatalf("sent %d status updates, want 1", len(statuses))
+	}
+	status := statuses[0]
+	if status.Name != "abc-vm" || status.Type.ShortResourceName != "VM" {
+		t.Errorf("status is %q of type %q, want VM abc-vm", status.Name, status.Type.ShortResourceName)
+	}
+	if status.ResourceState != models.AzureResourceStateSucceeded || status.Location != "eastus" ||
+		status.PublicIP != "1.2.3.4" || status.Progress != 3 || status.ElapsedTime.Seconds() != 1.5 {
+		t.Errorf("status fields not copied: %+v", status)
+	}
+	if status.SSH != models.ServiceStateSucceeded || status.Docker != models.ServiceStateUnknown {
+		t.Errorf("ssh = %v, docker = %v; want Succeeded and absent services left Unknown", status.SSH, status.Docker)
+	}
+	if status.StatusMessage == "" {
+		t.Error("status message not derived from the state")
+	}
+}
+
+func TestJSONLinesResourceValue(t *testing.T) {
+	sender := handle(t, `{"name": "abc-vm", "type": "IP", "state": "Succeeded", "value": "1.2.3.4"}`)
+	statuses := sender.statuses()
+	if len(statuses) != 1 || statuses[0].Type.ShortResourceName != "IP" || statuses[0].ResourceValue != "1.2.3.4" {
+		t.Errorf("status updates = %+v, want the IP with its address", statuses)
+	}
+}
+
+func TestJSONLinesStatusWithLog(t *testing.T) {
+	sender := handle(t, `{"name": "abc-vm", "log": "booted", "public_ip": "1.2.3.4"}`)
+	if lines := sender.logLines(); len(lines) != 1 || lines[0].Machine != "abc-vm" {
+		t.Errorf("log lines = %+v, want one tagged abc-vm", lines)
+	}
+	if statuses := sender.statuses(); len(statuses) != 1 || statuses[0].PublicIP != "1.2.3.4" {
+		t.Errorf("status updates = %+v, want one with the public IP", statuses)
+	}
+}
+
+func TestJSONLinesRun(t *testing.T) {
+	input := strings.Join([]string{
+		`{"name": "a-vm", "state": "Pending"}`,
+		`garbage`,
+		``,
+		`{"log": "note"}`,
+		`{"name": "a-vm", "state": "Succeeded"}`, // no trailing newline
+	}, "\n")
+	sender := &recordingSender{}
+	NewJSONLinesSource("-", false).run(context.Background(), strings.NewReader(input), sender)
+
+	if statuses := sender.statuses(); len(statuses) != 2 {
+		t.Errorf("sent %d status updates, want 2", len(statuses))
+	}
+	lines := sender.logLines()
+	if len(lines) != 3 {
+		t.Fatalf("sent log lines %+v, want the error, the note and end of input", lines)
+	}
+	if last := lines[len(lines)-1].Text; last != "jsonl: end of input after 5 lines" {
+		t.Errorf("last log line = %q", last)
+	}
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	rand "math/rand/v2"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
+)
+
+func init() {
+	Register("random", func(Options) (EventSource, error) { return NewRandomSource(20), nil })
+}
+
+// RandomSource creates random machines and randomly updates one of them every
+// second, emitting a random log entry every two seconds. Cancelled machines
+// are left alone until they are retried.
+type RandomSource struct {
+	runner
+	totalTasks int
+	commands   commandQueue
+}
+
+// NewRandomSource returns a RandomSource that drives totalTasks machines
+func NewRandomSource(totalTasks int) *RandomSource {
+	return &RandomSource{totalTasks: totalTasks, commands: newCommandQueue()}
+}
+
+// Execute queues cmd for the running source
+func (s *RandomSource) Execute(cmd Command) error {
+	return s.commands.push(s.Done(), cmd)
+}
+
+// Start begins sending random updates to sender
+func (s *RandomSource) Start(ctx context.Context, sender Sender) error {
+	return s.start(ctx, func(ctx context.Context) {
+		s.generateEvents(ctx, sender)
+	})
+}
+
+func (s *RandomSource) generateEvents(ctx context.Context, sender Sender) {
+	statuses := make(map[string]*models.DisplayStatus)
+	cancelled := make(map[string]*models.DisplayStatus)
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for i := 0; i < s.totalTasks; i++ {
+		newStatus := testutils.CreateRandomStatus()
+		statuses[newStatus.ID] = newStatus
+		sendStatus(sender, newStatus)
+	}
+
+	logTicker := time.NewTicker(2 * time.Second)
+	defer logTicker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if status := testutils.GetRandomStatus(statuses); status != nil {
+				if updateRandomStatus(status) {
+					sendStatus(sender, status)
+				}
+			}
+			sender.Send(models.TimeUpdateMsg{})
+		case <-logTicker.C:
+			logLine := models.LogLineMsg{
+				Text:  testutils.GenerateRandomLogEntry(),
+				Level: randomLogLevel(),
+			}
+			if status := testutils.GetRandomStatus(statuses); status != nil {
+				logLine.Machine = status.Name
+			}
+			sender.Send(logLine)
+		case cmd := <-s.commands:
+			s.execute(cmd, statuses, cancelled, sender)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// execute applies cmd to its machine and sends the machine's new status.
+// Cancelled machines are moved out of statuses so the random updates pass
+// them by, and back in when they are retried.
+func (s *RandomSource) execute(cmd Command, statuses, cancelled map[string]*models.DisplayStatus, sender Sender) {
+	status, ok := statuses[cmd.Machine]
+	if !ok {
+		status, ok = cancelled[cmd.Machine]
+	}
+	if !ok {
+		commandFailed(sender, "random", cmd, fmt.Errorf("no random machine named %q", cmd.Machine))
+		return
+	}
+	if err := applyCommand(status, cmd.Action); err != nil {
+		commandFailed(sender, "random", cmd, err)
+		return
+	}
+	delete(statuses, cmd.Machine)
+	delete(cancelled, cmd.Machine)
+	if cmd.Action == ActionCancel {
+		cancelled[cmd.Machine] = status
+	} else {
+		statuses[cmd.Machine] = status
+	}
+	sendStatus(sender, status)
+}
+
+func updateRandomStatus(status *models.DisplayStatus) bool {
+	oldStatus := *status
+	status.ElapsedTime += time.Duration(rand.IntN(10)) * time.Second
+	status.StatusMessage = testutils.RandomStatus()
+	status.DetailedStatus = testutils.GetRandomDetailedStatus(status.StatusMessage)
+	return oldStatus != *status // Return true if there's a change
+}
+
+func randomLogLevel() models.LogLevel {
+	switch n := rand.IntN(20); { //nolint:gomnd,gosec
+	case n == 0:
+		return models.LogLevelError
+	case n < 3:
+		return models.LogLevelWarn
+	case n < 6:
+		return models.LogLevelDebug
+	default:
+		return models.LogLevelInfo
+	}
+}
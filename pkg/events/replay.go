@@ -0,0 +1,141 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/journal"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func init() {
+	Register("replay", func(opts Options) (EventSource, error) {
+		if opts.Input == "" || opts.Input == "-" {
+			return nil, fmt.Errorf("the replay source needs a journal file as its input")
+		}
+		if opts.Speed < 0 {
+			return nil, fmt.Errorf("replay speed must not be negative, got %v", opts.Speed)
+		}
+		return NewReplaySource(opts.Input, opts.Speed, opts.ReplayStep), nil
+	})
+}
+
+// ReplaySource feeds a recorded journal back to the display. Entries are
+// sent with their recorded gaps divided by speed; a speed of 0 sends them
+// as fast as the display takes them. In step mode each entry other than a
+// clock tick waits for a call to Step instead.
+//
+// Key presses are sent as journal.ReplayedKeyMsg, so the display can refuse
+// the ones that would quit it or act outside it, whatever keys they are
+// bound to.
+type ReplaySource struct {
+	runner
+	path  string
+	speed float64
+	step  bool
+	steps chan struct{}
+}
+
+// NewReplaySource returns a source replaying the journal at path
+func NewReplaySource(path string, speed float64, step bool) *ReplaySource {
+	return &ReplaySource{
+		path:  path,
+		speed: speed,
+		step:  step,
+		steps: make(chan struct{}, 16), //nolint:gomnd
+	}
+}
+
+// Step releases the next entry in step mode. Presses beyond the ones
+// already queued are dropped.
+func (s *ReplaySource) Step() {
+	select {
+	case s.steps <- struct{}{}:
+	default:
+	}
+}
+
+// Start opens the journal and begins replaying it to sender
+func (s *ReplaySource) Start(ctx context.Context, sender Sender) error {
+	reader, err := journal.Open(s.path)
+	if err != nil {
+		return err
+	}
+	return s.start(ctx, func(ctx context.Context) {
+		defer reader.Close()
+		s.run(ctx, reader, sender)
+	})
+}
+
+func (s *ReplaySource) run(ctx context.Context, reader *journal.Reader, sender Sender) {
+	sender.Send(models.LogLineMsg{
+		Text:  fmt.Sprintf("replay: session recorded %s", reader.Started.Format(time.RFC3339)),
+		Level: models.LogLevelInfo,
+	})
+
+	var previous time.Duration
+	replayed := 0
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			sender.Send(models.LogLineMsg{Text: fmt.Sprintf("replay: %v", err), Level: models.LogLevelError})
+			return
+		}
+
+		if !s.wait(ctx, entry, entry.Elapsed-previous) {
+			return
+		}
+		previous = entry.Elapsed
+
+		msg, err := entry.Msg()
+		if err != nil {
+			sender.Send(models.LogLineMsg{Text: fmt.Sprintf("replay: %v", err), Level: models.LogLevelWarn})
+			continue
+		}
+		if key, ok := msg.(tea.KeyMsg); ok {
+			msg = journal.ReplayedKeyMsg{KeyMsg: key}
+		}
+		sender.Send(msg)
+		replayed++
+	}
+
+	sender.Send(models.LogLineMsg{
+		Text:  fmt.Sprintf("replay: end of journal after %d entries", replayed),
+		Level: models.LogLevelInfo,
+	})
+}
+
+// wait holds the entry back until it is due, or until Step is called in
+// step mode. It returns false if ctx is cancelled first.
+func (s *ReplaySource) wait(ctx context.Context, entry journal.Entry, gap time.Duration) bool {
+	if s.step {
+		if entry.Kind == journal.KindTime {
+			return ctx.Err() == nil
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.steps:
+			return true
+		}
+	}
+
+	if s.speed == 0 || gap <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(time.Duration(float64(gap) / s.speed))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
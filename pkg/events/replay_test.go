@@ -0,0 +1,240 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/journal"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// writeJournal writes a journal whose entries are at the given offsets from
+// the start of the session
+func writeJournal(t *testing.T, entries ...journal.Entry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	enc := json.NewEncoder(f)
+	if err := enc.Encode(journal.Entry{Kind: journal.KindHeader, Version: journal.Version, Started: &started}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func statusEntry(at time.Duration, name string) journal.Entry {
+	return journal.Entry{
+		Elapsed: at,
+		Kind:    journal.KindStatus,
+		Status:  models.NewDisplayVMStatus(name, models.AzureResourceStateSucceeded),
+	}
+}
+
+// timedSender notes when each status arrives
+type timedSender struct {
+	mu     sync.Mutex
+	msgs   []tea.Msg
+	times  []time.Time
+	update chan struct{}
+}
+
+func newTimedSender() *timedSender {
+	return &timedSender{update: make(chan struct{}, 100)} //nolint:gomnd
+}
+
+func (s *timedSender) Send(msg tea.Msg) {
+	s.mu.Lock()
+	s.msgs = append(s.msgs, msg)
+	if _, ok := msg.(models.StatusUpdateMsg); ok {
+		s.times = append(s.times, time.Now())
+	}
+	s.mu.Unlock()
+	select {
+	case s.update <- struct{}{}:
+	default:
+	}
+}
+
+func (s *timedSender) statusTimes() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.times...)
+}
+
+func (s *timedSender) messages() []tea.Msg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tea.Msg(nil), s.msgs...)
+}
+
+// replay plays the journal at path to the end and returns the sender
+func replay(t *testing.T, path string, speed float64) *timedSender {
+	t.Helper()
+	source := NewReplaySource(path, speed, false)
+	sender := newTimedSender()
+	if err := source.Start(context.Background(), sender); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	select {
+	case <-source.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replay didn't finish")
+	}
+	if err := source.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	return sender
+}
+
+func TestReplayTiming(t *testing.T) {
+	path := writeJournal(t,
+		statusEntry(0, "abc01-vm"),
+		statusEntry(200*time.Millisecond, "abc02-vm"),
+		statusEntry(400*time.Millisecond, "abc03-vm"),
+	)
+	tests := []struct {
+		name     string
+		speed    float64
+		min, max time.Duration
+	}{
+		{"1x keeps the recorded gaps", 1, 400 * time.Millisecond, 2 * time.Second},
+		{"4x divides them", 4, 100 * time.Millisecond, 350 * time.Millisecond},
+		{"0 sends at once", 0, 0, 150 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := replay(t, path, tt.speed).statusTimes()
+			if len(times) != 3 {
+				t.Fatalf("replayed %d statuses, want 3", len(times))
+			}
+			if took := times[2].Sub(times[0]); took < tt.min || took > tt.max {
+				t.Errorf("replay took %s, want between %s and %s", took, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestReplayStepMode(t *testing.T) {
+	path := writeJournal(t,
+		statusEntry(time.Hour, "abc01-vm"),
+		journal.Entry{Elapsed: 2 * time.Hour, Kind: journal.KindTime},
+		statusEntry(3*time.Hour, "abc02-vm"),
+	)
+	source := NewReplaySource(path, 1, true)
+	sender := newTimedSender()
+	if err := source.Start(context.Background(), sender); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer source.Stop() //nolint:errcheck
+
+	// statusesAfter waits for the source to settle and counts the statuses
+	statusesAfter := func(want int) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for len(sender.statusTimes()) < want {
+			select {
+			case <-sender.update:
+			case <-deadline:
+				t.Fatalf("%d statuses sent, want %d", len(sender.statusTimes()), want)
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		if got := len(sender.statusTimes()); got != want {
+			t.Fatalf("%d statuses sent, want %d", got, want)
+		}
+	}
+
+	// Nothing but the session line is sent until a step, however long the
+	// recorded gaps
+	statusesAfter(0)
+	source.Step()
+	statusesAfter(1)
+	// The clock tick passes without a step, the next status waits for one
+	source.Step()
+	statusesAfter(2)
+	select {
+	case <-source.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("the replay didn't finish after the last step")
+	}
+
+	var ticks int
+	for _, msg := range sender.messages() {
+		if _, ok := msg.(models.TimeUpdateMsg); ok {
+			ticks++
+		}
+	}
+	if ticks != 1 {
+		t.Errorf("%d clock ticks replayed, want 1", ticks)
+	}
+}
+
+func TestReplayMarksKeys(t *testing.T) {
+	path := writeJournal(t,
+		journal.Entry{Kind: journal.KindKey, Key: "j"},
+		journal.Entry{Kind: journal.KindKey, Key: "q"},
+		journal.Entry{Kind: journal.KindResize, Width: 80, Height: 24},
+	)
+	var keys []string
+	for _, msg := range replay(t, path, 0).messages() {
+		switch msg := msg.(type) {
+		case tea.KeyMsg:
+			t.Errorf("key %s sent as a live press", msg)
+		case journal.ReplayedKeyMsg:
+			keys = append(keys, msg.String())
+		}
+	}
+	// Quit keys are left for the display to refuse, since only it knows
+	// the keymap
+	if strings.Join(keys, ",") != "j,q" {
+		t.Errorf("replayed keys %v, want j and q", keys)
+	}
+}
+
+func TestReplaySkipsBadEntries(t *testing.T) {
+	path := writeJournal(t,
+		journal.Entry{Kind: "mystery"},
+		statusEntry(0, "abc01-vm"),
+	)
+	sender := replay(t, path, 0)
+	if got := len(sender.statusTimes()); got != 1 {
+		t.Errorf("replayed %d statuses, want the one after the bad entry", got)
+	}
+	var warned bool
+	for _, msg := range sender.messages() {
+		if line, ok := msg.(models.LogLineMsg); ok && line.Level == models.LogLevelWarn {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Error("the bad entry wasn't reported")
+	}
+}
+
+func TestReplayNeedsAJournal(t *testing.T) {
+	for _, opts := range []Options{{Input: "-"}, {Input: ""}, {Input: "x.jsonl", Speed: -1}} {
+		if _, err := New("replay", opts); err == nil {
+			t.Errorf("New(replay, %+v) passed", opts)
+		}
+	}
+	source := NewReplaySource(filepath.Join(t.TempDir(), "missing.jsonl"), 1, false)
+	if err := source.Start(context.Background(), newTimedSender()); err == nil {
+		t.Error("started replaying a journal that doesn't exist")
+	}
+}
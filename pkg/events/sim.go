@@ -0,0 +1,200 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/aronchick/bubble-tea-experiment/pkg/testutils"
+)
+
+func init() {
+	Register("sim", func(opts Options) (EventSource, error) {
+		if opts.Input == "" || opts.Input == "-" {
+			return nil, fmt.Errorf("the sim source needs a scenario file as its input")
+		}
+		if opts.Speed < 0 {
+			return nil, fmt.Errorf("sim speed must not be negative, got %v", opts.Speed)
+		}
+		scenario, err := testutils.LoadScenario(opts.Input)
+		if err != nil {
+			return nil, err
+		}
+		source := NewSimSource(testutils.NewSimulator(scenario, opts.Seed), opts.Speed)
+		source.interactive = opts.Interactive
+		return source, nil
+	})
+}
+
+var simLog = logger.Component("sim")
+
+// SimSource plays a simulator's timeline to the display, with the gaps
+// between events divided by speed (0 sends them as fast as possible).
+// Commands retry or cancel machines part way through; in interactive mode
+// the source keeps waiting for them after the timeline ends.
+type SimSource struct {
+	runner
+	sim         *testutils.Simulator
+	speed       float64
+	interactive bool
+	commands    commandQueue
+}
+
+// NewSimSource returns a source playing sim's timeline
+func NewSimSource(sim *testutils.Simulator, speed float64) *SimSource {
+	return &SimSource{
+		sim:      sim,
+		speed:    speed,
+		commands: newCommandQueue(),
+	}
+}
+
+// Execute queues cmd for the running timeline
+func (s *SimSource) Execute(cmd Command) error {
+	return s.commands.push(s.Done(), cmd)
+}
+
+// Start begins playing the timeline to sender
+func (s *SimSource) Start(ctx context.Context, sender Sender) error {
+	timeline := s.sim.Timeline()
+	return s.start(ctx, func(ctx context.Context) {
+		s.play(ctx, sender, timeline)
+	})
+}
+
+func (s *SimSource) play(ctx context.Context, sender Sender, timeline []testutils.SimEvent) {
+	start := time.Now()
+	queue := append([]testutils.SimEvent(nil), timeline...)
+	// last is the simulated time of the latest event sent, which is the
+	// clock when events are sent as fast as possible
+	var last time.Duration
+	now := func() time.Duration {
+		if s.speed > 0 {
+			return max(last, time.Duration(float64(time.Since(start))*s.speed))
+		}
+		return last
+	}
+	complete := false
+
+	for {
+		if len(queue) == 0 {
+			if !complete {
+				complete = true
+				sender.Send(models.LogLineMsg{
+					Text:  fmt.Sprintf("sim: timeline complete after %s (seed %d)", last, s.sim.Seed()),
+					Level: models.LogLevelInfo,
+				})
+			}
+			if !s.interactive {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case cmd := <-s.commands:
+				queue = s.execute(cmd, now(), queue, sender)
+			}
+			continue
+		}
+
+		event := queue[0]
+		if s.speed > 0 {
+			due := time.Duration(float64(event.At) / s.speed)
+			if wait := due - time.Since(start); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case cmd := <-s.commands:
+					timer.Stop()
+					queue = s.execute(cmd, now(), queue, sender)
+					continue
+				case <-timer.C:
+				}
+				sender.Send(models.TimeUpdateMsg{})
+			}
+		} else {
+			select {
+			case cmd := <-s.commands:
+				queue = s.execute(cmd, now(), queue, sender)
+				continue
+			default:
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		queue = queue[1:]
+		last = max(last, event.At)
+		sender.Send(event.Msg)
+	}
+}
+
+// execute applies cmd at the simulated time at and returns the new queue.
+// Both actions drop the machine's pending events first, since the timeline
+// they belonged to no longer holds. Failures are reported in the log.
+func (s *SimSource) execute(
+	cmd Command,
+	at time.Duration,
+	queue []testutils.SimEvent,
+	sender Sender,
+) []testutils.SimEvent {
+	var events []testutils.SimEvent
+	var err error
+	switch cmd.Action {
+	case ActionRetry:
+		events, err = s.sim.Retry(cmd.Machine, at)
+	case ActionCancel:
+		events, err = s.sim.Cancel(cmd.Machine, at)
+	default:
+		err = fmt.Errorf("the sim source does not support %q", cmd.Action)
+	}
+	if err != nil {
+		simLog.Warn("command failed", logger.MachineKey, cmd.Machine, "action", cmd.Action, "err", err)
+		commandFailed(sender, "sim", cmd, err)
+		return queue
+	}
+	simLog.Info("command executed", logger.MachineKey, cmd.Machine, "action", cmd.Action, "at", at, "events", len(events))
+
+	kept := queue[:0]
+	for _, event := range queue {
+		if eventMachine(event) != cmd.Machine {
+			kept = append(kept, event)
+		}
+	}
+	return mergeEvents(kept, events)
+}
+
+// eventMachine is the machine an event belongs to, or "" for events about
+// the whole deployment or a region
+func eventMachine(event testutils.SimEvent) string {
+	switch msg := event.Msg.(type) {
+	case models.StatusUpdateMsg:
+		// Location-scoped statuses are named after their resource, never a
+		// machine
+		return msg.Status.Name
+	case models.LogLineMsg:
+		return msg.Machine
+	}
+	return ""
+}
+
+// mergeEvents merges two time-ordered event lists, keeping a's events
+// first on ties
+func mergeEvents(a, b []testutils.SimEvent) []testutils.SimEvent {
+	merged := make([]testutils.SimEvent, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		if b[0].At < a[0].At {
+			merged = append(merged, b[0])
+			b = b[1:]
+		} else {
+			merged = append(merged, a[0])
+			a = a[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// waitForSim waits until the sender has a message found reports true for
+func waitForSim(t *testing.T, sender *recordingSender, what string, found func(tea.Msg) bool) {
+	t.Helper()
+	waitFor(t, sender, what, func() bool {
+		for _, msg := range sender.messages() {
+			if found(msg) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestSimSourceTakesCommandsAfterTheTimeline(t *testing.T) {
+	source, err := New("sim", Options{Input: writeScenario(t), Interactive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &recordingSender{}
+	if err := source.Start(context.Background(), sender); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer source.Stop() //nolint:errcheck
+	logged := func(text string) func(tea.Msg) bool {
+		return func(msg tea.Msg) bool {
+			line, ok := msg.(models.LogLineMsg)
+			return ok && strings.Contains(line.Text, text)
+		}
+	}
+	waitForSim(t, sender, "end of the timeline", logged("timeline complete"))
+
+	commander := source.(Commander)
+	if err := commander.Execute(Command{Action: ActionCancel, Machine: "sim02-vm"}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	waitForSim(t, sender, "cancelled status", func(msg tea.Msg) bool {
+		update, ok := msg.(models.StatusUpdateMsg)
+		return ok && update.Status.Name == "sim02-vm" && update.Status.StatusMessage == "Cancelled"
+	})
+	if err := commander.Execute(Command{Action: ActionRetry, Machine: "sim02-vm"}); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	waitForSim(t, sender, "retry", logged("sim: retrying"))
+	if err := commander.Execute(Command{Action: ActionRetry, Machine: "nobody"}); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	waitForSim(t, sender, "failed retry", logged(`sim: retry failed: no simulated machine named "nobody"`))
+}
+
+// writeScenario writes a scenario of two machines that never fail
+func writeScenario(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	scenario := `
+regions:
+  - {region: eastus, machines: 2}
+latencies:
+  default: {distribution: fixed, mean: 1s}
+`
+	if err := os.WriteFile(path, []byte(scenario), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
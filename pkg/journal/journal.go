@@ -0,0 +1,246 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Version is written in every journal's header and bumped whenever the entry
+// format changes incompatibly
+const Version = 1
+
+// Kind is the type of message an Entry holds
+type Kind string
+
+const (
+	KindHeader Kind = "header"
+	KindStatus Kind = "status"
+	KindTime   Kind = "time"
+	KindLog    Kind = "log"
+	KindKey    Kind = "key"
+	KindResize Kind = "resize"
+)
+
+// Entry is one line of a journal. Elapsed is measured from the start of the
+// session on the monotonic clock, so entries are always in order even if the
+// wall clock jumps.
+type Entry struct {
+	Elapsed time.Duration         `json:"elapsed_ns"`
+	Kind    Kind                  `json:"kind"`
+	Version int                   `json:"version,omitempty"`
+	Started *time.Time            `json:"started,omitempty"`
+	Status  *models.DisplayStatus `json:"status,omitempty"`
+	Log     *models.LogLineMsg    `json:"log,omitempty"`
+	Key     string                `json:"key,omitempty"`
+	Paste   bool                  `json:"paste,omitempty"`
+	Width   int                   `json:"width,omitempty"`
+	Height  int                   `json:"height,omitempty"`
+}
+
+// Msg converts the entry back into the message that was recorded
+func (e Entry) Msg() (tea.Msg, error) {
+	switch e.Kind {
+	case KindStatus:
+		if e.Status == nil {
+			return nil, fmt.Errorf("status entry has no status")
+		}
+		status := *e.Status
+		return models.StatusUpdateMsg{Status: &status}, nil
+	case KindTime:
+		return models.TimeUpdateMsg{}, nil
+	case KindLog:
+		if e.Log == nil {
+			return nil, fmt.Errorf("log entry has no log line")
+		}
+		return *e.Log, nil
+	case KindKey:
+		return ParseKey(e.Key, e.Paste), nil
+	case KindResize:
+		return tea.WindowSizeMsg{Width: e.Width, Height: e.Height}, nil
+	default:
+		return nil, fmt.Errorf("unknown journal entry kind %q", e.Kind)
+	}
+}
+
+// ReplayedKeyMsg is a key press read back from a journal. It is kept apart
+// from tea.KeyMsg so the display can tell a recorded press from a live one.
+type ReplayedKeyMsg struct {
+	tea.KeyMsg
+}
+
+// Writer appends entries to a journal. Each entry is written as soon as it
+// is recorded, so the journal is usable even if the session crashes.
+type Writer struct {
+	out   io.Writer
+	enc   *json.Encoder
+	start time.Time
+}
+
+// Create truncates or creates the journal file at path
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewWriter starts a journal on out by writing its header
+func NewWriter(out io.Writer) (*Writer, error) {
+	w := &Writer{out: out, enc: json.NewEncoder(out), start: time.Now()}
+	started := w.start.Round(0)
+	if err := w.enc.Encode(Entry{Kind: KindHeader, Version: Version, Started: &started}); err != nil {
+		return nil, fmt.Errorf("failed to write journal header: %w", err)
+	}
+	return w, nil
+}
+
+// Record appends msg to the journal. Messages of kinds that are not
+// journalled are ignored.
+func (w *Writer) Record(msg tea.Msg) error {
+	entry := Entry{Elapsed: time.Since(w.start)}
+	switch msg := msg.(type) {
+	case models.StatusUpdateMsg:
+		if msg.Status == nil {
+			return nil
+		}
+		entry.Kind = KindStatus
+		entry.Status = msg.Status
+	case models.TimeUpdateMsg:
+		entry.Kind = KindTime
+	case models.LogLineMsg:
+		entry.Kind = KindLog
+		entry.Log = &msg
+	case tea.KeyMsg:
+		entry.Kind = KindKey
+		entry.Paste = msg.Paste
+		if msg.Paste {
+			entry.Key = string(msg.Runes)
+		} else {
+			entry.Key = msg.String()
+		}
+	case tea.WindowSizeMsg:
+		entry.Kind = KindResize
+		entry.Width = msg.Width
+		entry.Height = msg.Height
+	default:
+		return nil
+	}
+	if err := w.enc.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file, if the writer owns one
+func (w *Writer) Close() error {
+	if closer, ok := w.out.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Reader reads the entries of a journal in order
+type Reader struct {
+	dec    *json.Decoder
+	closer io.Closer
+	// Started is the wall-clock time the session was recorded
+	Started time.Time
+}
+
+// Open opens the journal file at path
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads and checks the journal header from in
+func NewReader(in io.Reader) (*Reader, error) {
+	r := &Reader{dec: json.NewDecoder(in)}
+	var header Entry
+	if err := r.dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read journal header: %w", err)
+	}
+	if header.Kind != KindHeader {
+		return nil, fmt.Errorf("not a journal: first entry is %q, not a header", header.Kind)
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("unsupported journal version %d (expected %d)", header.Version, Version)
+	}
+	if header.Started != nil {
+		r.Started = *header.Started
+	}
+	return r, nil
+}
+
+// Next returns the next entry, or io.EOF at the end of the journal
+func (r *Reader) Next() (Entry, error) {
+	var entry Entry
+	if err := r.dec.Decode(&entry); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Entry{}, io.EOF
+		}
+		return Entry{}, fmt.Errorf("failed to read journal entry: %w", err)
+	}
+	return entry, nil
+}
+
+// Close closes the journal file, if the reader owns one
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// keyTypes maps the names bubbletea gives special keys back to their types
+var keyTypes = func() map[string]tea.KeyType {
+	types := make(map[string]tea.KeyType)
+	for k := tea.KeyF20; k <= tea.KeyCtrlQuestionMark; k++ {
+		if name := k.String(); name != "" && k != tea.KeyRunes {
+			if _, ok := types[name]; !ok {
+				types[name] = k
+			}
+		}
+	}
+	return types
+}()
+
+// ParseKey rebuilds a key press from the string tea.KeyMsg.String returns
+// for it. Pasted text is passed as-is with paste set.
+func ParseKey(s string, paste bool) tea.KeyMsg {
+	if paste {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s), Paste: true}
+	}
+	if k, ok := keyTypes[s]; ok {
+		return tea.KeyMsg{Type: k}
+	}
+	if rest, ok := strings.CutPrefix(s, "alt+"); ok && rest != "" {
+		key := ParseKey(rest, false)
+		key.Alt = true
+		return key
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
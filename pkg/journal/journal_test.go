@@ -0,0 +1,149 @@
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	status := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	status.PublicIP = "1.2.3.4"
+	status.SSH = models.ServiceStateSucceeded
+	recorded := []tea.Msg{
+		models.StatusUpdateMsg{Status: status},
+		models.TimeUpdateMsg{},
+		models.LogLineMsg{Text: "installing docker", Machine: "abc01-vm", Level: models.LogLevelWarn,
+			Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")},
+		tea.KeyMsg{Type: tea.KeyEnter},
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x"), Alt: true},
+		tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("pasted text"), Paste: true},
+		tea.WindowSizeMsg{Width: 120, Height: 40},
+	}
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for _, msg := range recorded {
+		if err := w.Record(msg); err != nil {
+			t.Fatalf("Record(%T): %v", msg, err)
+		}
+	}
+	// Messages that aren't journalled, and empty statuses, are skipped
+	for _, msg := range []tea.Msg{tea.QuitMsg{}, models.StatusUpdateMsg{}} {
+		if err := w.Record(msg); err != nil {
+			t.Fatalf("Record(%T): %v", msg, err)
+		}
+	}
+
+	r, err := NewReader(&b)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if time.Since(r.Started) > time.Minute {
+		t.Errorf("started %s, want about now", r.Started)
+	}
+	var previous time.Duration
+	for i, want := range recorded {
+		entry, err := r.Next()
+		if err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		if entry.Elapsed < previous {
+			t.Errorf("entry %d at %s comes before %s", i, entry.Elapsed, previous)
+		}
+		previous = entry.Elapsed
+		got, err := entry.Msg()
+		if err != nil {
+			t.Fatalf("entry %d: Msg: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entry %d = %#v, want %#v", i, got, want)
+		}
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("after the last entry: %v, want io.EOF", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in    string
+		paste bool
+		want  tea.KeyMsg
+	}{
+		{"a", false, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")}},
+		{"enter", false, tea.KeyMsg{Type: tea.KeyEnter}},
+		{"ctrl+c", false, tea.KeyMsg{Type: tea.KeyCtrlC}},
+		{"up", false, tea.KeyMsg{Type: tea.KeyUp}},
+		{"pgdown", false, tea.KeyMsg{Type: tea.KeyPgDown}},
+		{"f5", false, tea.KeyMsg{Type: tea.KeyF5}},
+		{" ", false, tea.KeyMsg{Type: tea.KeySpace}},
+		{"alt+a", false, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a"), Alt: true}},
+		{"alt+up", false, tea.KeyMsg{Type: tea.KeyUp, Alt: true}},
+		{"alt+ctrl+c", false, tea.KeyMsg{Type: tea.KeyCtrlC, Alt: true}},
+		{"alt+", false, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("alt+")}},
+		{"enter", true, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("enter"), Paste: true}},
+	}
+	for _, tt := range tests {
+		got := ParseKey(tt.in, tt.paste)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKey(%q, %v) = %#v, want %#v", tt.in, tt.paste, got, tt.want)
+		}
+		// Every key that isn't pasted reads back as the string it came from
+		if !tt.paste && got.String() != tt.in {
+			t.Errorf("ParseKey(%q) prints as %q", tt.in, got.String())
+		}
+	}
+}
+
+func TestNewReaderChecksHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+		wantErr string
+	}{
+		{"empty", "", "failed to read journal header"},
+		{"not JSON", "hello\n", "failed to read journal header"},
+		{"no header", `{"elapsed_ns":0,"kind":"time"}` + "\n", "not a journal"},
+		{"newer version", `{"elapsed_ns":0,"kind":"header","version":2}` + "\n", "unsupported journal version 2"},
+		{"no version", `{"elapsed_ns":0,"kind":"header"}` + "\n", "unsupported journal version 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.journal))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewReader = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEntryMsgRejectsBadEntries(t *testing.T) {
+	for _, entry := range []Entry{{Kind: KindStatus}, {Kind: KindLog}, {Kind: "mystery"}} {
+		if msg, err := entry.Msg(); err == nil {
+			t.Errorf("%q entry gave %#v", entry.Kind, msg)
+		}
+	}
+}
+
+func TestNextReportsCorruptEntries(t *testing.T) {
+	journal := `{"elapsed_ns":0,"kind":"header","version":1}` + "\n{oops\n"
+	r, err := NewReader(strings.NewReader(journal))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if _, err := r.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Errorf("Next = %v, want a read error", err)
+	}
+}
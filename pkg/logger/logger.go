@@ -1,36 +1,187 @@
+// Package logger is the program's diagnostic log, built on log/slog.
+//
+// Records go to a file in text or JSON, through a buffer that is flushed
+// every FlushInterval, on warnings and errors, and on Close. The file is
+// rotated once it reaches its size limit. Until Init is called records are
+// discarded, so packages can log from anywhere without checking whether
+// logging is set up.
+//
+// Records carry a component field naming the part of the program that wrote
+// them and, where there is one, a machine field.
 package logger
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 )
 
+// Field names shared by every component
+const (
+	ComponentKey = "component"
+	MachineKey   = "machine"
+)
+
+// Formats for Options.Format
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures the log
+type Options struct {
+	// Path is the log file, appended to if it exists
+	Path string
+	// Level is the least severe level written
+	Level slog.Level
+	// Format is FormatText or FormatJSON
+	Format string
+	// MaxSize is the size in bytes the file is rotated at; 0 never rotates
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept as Path.1, Path.2...
+	MaxBackups int
+}
+
 var (
-	debugMode bool
-	logFile   *os.File
-	mu        sync.Mutex
+	level      slog.LevelVar
+	jsonFormat atomic.Bool
+
+	mu  sync.Mutex
+	out *rotatingFile
+
+	root = slog.New(&formatHandler{
+		text: slog.NewTextHandler(sink{}, &slog.HandlerOptions{Level: &level}),
+		json: slog.NewJSONHandler(sink{}, &slog.HandlerOptions{Level: &level}),
+	})
 )
 
-func init() {
-	debugMode = os.Getenv("DEBUG_CHANNELS") == "1"
+// Init opens the log file and starts writing records to it. Calling Init
+// again replaces the file, closing the old one.
+func Init(opts Options) error {
+	if opts.Format != "" && opts.Format != FormatText && opts.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q (available: %s, %s)", opts.Format, FormatText, FormatJSON)
+	}
+	file, err := openRotating(opts.Path, opts.MaxSize, opts.MaxBackups)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	old := out
+	out = file
+	mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	level.Set(opts.Level)
+	jsonFormat.Store(opts.Format == FormatJSON)
+	return nil
+}
+
+// Close flushes and closes the log file; later records are discarded
+func Close() error {
+	mu.Lock()
+	file := out
+	out = nil
+	mu.Unlock()
+	if file == nil {
+		return nil
+	}
+	return file.Close()
 }
 
-// SetLogFile sets the file to write debug logs to
-func SetLogFile(file *os.File) {
+// Flush writes any buffered records to the file
+func Flush() error {
 	mu.Lock()
 	defer mu.Unlock()
-	logFile = file
+	if out == nil {
+		return nil
+	}
+	return out.Flush()
 }
 
-// Debug logs a debug message if DEBUG_CHANNELS is set to 1
-func Debug(format string, args ...interface{}) {
-	if debugMode {
-		mu.Lock()
-		defer mu.Unlock()
-		if logFile != nil {
-			fmt.Fprintf(logFile, format+"\n", args...)
-			logFile.Sync()
-		}
+// ParseLevel converts a level name (debug, info, warn or error) to a level
+func ParseLevel(name string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (available: debug, info, warn, error)", name)
 	}
+	return l, nil
+}
+
+// Enabled reports whether records at l are written
+func Enabled(l slog.Level) bool {
+	return l >= level.Level()
+}
+
+// Component returns a logger whose records carry the component field. It
+// may be called before Init.
+func Component(name string) *slog.Logger {
+	return root.With(ComponentKey, name)
+}
+
+// Debug logs at debug level with key-value pairs
+func Debug(msg string, args ...any) {
+	root.Debug(msg, args...)
+}
+
+// Info logs at info level with key-value pairs
+func Info(msg string, args ...any) {
+	root.Info(msg, args...)
+}
+
+// Warn logs at warn level with key-value pairs
+func Warn(msg string, args ...any) {
+	root.Warn(msg, args...)
+}
+
+// Error logs at error level with key-value pairs
+func Error(msg string, args ...any) {
+	root.Error(msg, args...)
+}
+
+// sink writes to the current log file, or nowhere before Init
+type sink struct{}
+
+func (sink) Write(p []byte) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if out == nil {
+		return len(p), nil
+	}
+	return out.Write(p)
+}
+
+// formatHandler hands each record to the text or JSON handler, as chosen
+// by the last Init, so loggers made before Init follow its format
+type formatHandler struct {
+	text, json slog.Handler
+}
+
+func (h *formatHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return Enabled(l)
+}
+
+func (h *formatHandler) Handle(ctx context.Context, record slog.Record) error {
+	var err error
+	if jsonFormat.Load() {
+		err = h.json.Handle(ctx, record)
+	} else {
+		err = h.text.Handle(ctx, record)
+	}
+	if err == nil && record.Level >= slog.LevelWarn {
+		err = Flush()
+	}
+	return err
+}
+
+func (h *formatHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &formatHandler{text: h.text.WithAttrs(attrs), json: h.json.WithAttrs(attrs)}
+}
+
+func (h *formatHandler) WithGroup(name string) slog.Handler {
+	return &formatHandler{text: h.text.WithGroup(name), json: h.json.WithGroup(name)}
 }
@@ -0,0 +1,174 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FlushInterval is how often buffered records are written to the file
+const FlushInterval = time.Second
+
+// bufferSize is the size of the write buffer in front of the file
+const bufferSize = 64 * 1024
+
+// rotatingFile is a buffered log file that is renamed to path.1, and the
+// older backups shifted up, once it reaches maxSize
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file      *os.File
+	buf       *bufio.Writer
+	size      int64
+	closed    chan struct{}
+	closeOnce sync.Once
+	// failedAt is when rotation last failed. It isn't tried again for a
+	// FlushInterval, so a lasting failure doesn't cost every write.
+	failedAt time.Time
+}
+
+func openRotating(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+		closed:     make(chan struct{}),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	go r.flushLoop()
+	return r, nil
+}
+
+// open opens the file for appending; r.mu must be held or r unshared
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644) //nolint:gomnd
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.file = file
+	r.buf = bufio.NewWriterSize(file, bufferSize)
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past maxSize.
+// If rotation fails the file is reopened as it is, and rotation is retried
+// later, so records keep being written.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		if r.isClosed() {
+			return len(p), nil
+		}
+		// A failed rotation couldn't reopen the file; try again
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize && time.Since(r.failedAt) >= FlushInterval {
+		if err := r.rotate(); err != nil {
+			r.failedAt = time.Now()
+			if r.file == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := r.buf.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file, shifts the backups and starts a new file. If the
+// file can't be moved aside it is reopened to carry on appending. r.mu must
+// be held.
+func (r *rotatingFile) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return errors.Join(fmt.Errorf("failed to rotate log file: %w", err), r.open())
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(backupName(r.path, i), backupName(r.path, i+1))
+	}
+	if err := os.Rename(r.path, backupName(r.path, 1)); err != nil {
+		return errors.Join(fmt.Errorf("failed to rotate log file: %w", err), r.open())
+	}
+	return r.open()
+}
+
+func backupName(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Flush writes the buffer to the file
+func (r *rotatingFile) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buf == nil {
+		return nil
+	}
+	return r.buf.Flush()
+}
+
+func (r *rotatingFile) flushLoop() {
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			_ = r.Flush()
+		}
+	}
+}
+
+// Close flushes and closes the file and stops the flush loop. Later writes
+// are discarded.
+func (r *rotatingFile) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	return r.closeFile()
+}
+
+func (r *rotatingFile) isClosed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeFile flushes and closes the file; r.mu must be held
+func (r *rotatingFile) closeFile() error {
+	flushErr := r.buf.Flush()
+	closeErr := r.file.Close()
+	r.file, r.buf = nil, nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// record is a 9-byte log line
+func record(n int) string {
+	return fmt.Sprintf("line %03d\n", n)
+}
+
+func openTest(t *testing.T, maxSize int64, maxBackups int) (*rotatingFile, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.log")
+	r, err := openRotating(path, maxSize, maxBackups)
+	if err != nil {
+		t.Fatalf("openRotating: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r, path
+}
+
+func writeRecords(t *testing.T, r *rotatingFile, from, to int) {
+	t.Helper()
+	for n := from; n < to; n++ {
+		if _, err := r.Write([]byte(record(n))); err != nil {
+			t.Fatalf("Write %d: %v", n, err)
+		}
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+}
+
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func records(from, to int) string {
+	var b strings.Builder
+	for n := from; n < to; n++ {
+		b.WriteString(record(n))
+	}
+	return b.String()
+}
+
+func TestRotateShiftsBackups(t *testing.T) {
+	// Three records to a file, two backups kept
+	r, path := openTest(t, 27, 2)
+	writeRecords(t, r, 0, 11)
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{path, records(9, 11)},
+		{backupName(path, 1), records(6, 9)},
+		{backupName(path, 2), records(3, 6)},
+	}
+	for _, tt := range tests {
+		if got := readLog(t, tt.file); got != tt.want {
+			t.Errorf("%s = %q, want %q", filepath.Base(tt.file), got, tt.want)
+		}
+	}
+	if _, err := os.Stat(backupName(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("a third backup was kept: %v", err)
+	}
+}
+
+func TestRotateWithoutBackups(t *testing.T) {
+	r, path := openTest(t, 27, 0)
+	writeRecords(t, r, 0, 4)
+	if got := readLog(t, path); got != record(3) {
+		t.Errorf("log = %q, want only the newest record", got)
+	}
+	if _, err := os.Stat(backupName(path, 1)); !os.IsNotExist(err) {
+		t.Errorf("a backup was kept: %v", err)
+	}
+}
+
+func TestRotateNeverSplitsAFreshFile(t *testing.T) {
+	r, path := openTest(t, 5, 1)
+	writeRecords(t, r, 0, 1)
+	if got := readLog(t, path); got != record(0) {
+		t.Errorf("log = %q, want the record that is larger than the limit", got)
+	}
+}
+
+func TestWritesContinueAfterAFailedRotation(t *testing.T) {
+	r, path := openTest(t, 27, 1)
+	// A directory in the way of the backup stops the file being moved aside
+	if err := os.MkdirAll(filepath.Join(backupName(path, 1), "blocker"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeRecords(t, r, 0, 5)
+	if got := readLog(t, path); got != records(0, 5) {
+		t.Errorf("log = %q, want every record in the unrotated file", got)
+	}
+	if r.failedAt.IsZero() {
+		t.Error("the rotation didn't fail")
+	}
+}
+
+func TestWriteReopensAClosedFile(t *testing.T) {
+	r, path := openTest(t, 0, 0)
+	writeRecords(t, r, 0, 1)
+	// As left by a rotation that couldn't reopen the file
+	r.mu.Lock()
+	if err := r.closeFile(); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Unlock()
+
+	writeRecords(t, r, 1, 2)
+	if got := readLog(t, path); got != records(0, 2) {
+		t.Errorf("log = %q, want the record written after the reopen", got)
+	}
+}
+
+func TestCloseStopsTheFlushLoop(t *testing.T) {
+	r, path := openTest(t, 0, 0)
+	r.mu.Lock()
+	if err := r.closeFile(); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Unlock()
+
+	// Close still stops the loop when there is no file to close, and can be
+	// called again
+	for i := 0; i < 2; i++ {
+		if err := r.Close(); err != nil {
+			t.Fatalf("Close %d: %v", i, err)
+		}
+	}
+	if !r.isClosed() {
+		t.Error("Close didn't stop the flush loop")
+	}
+
+	// Records after Close are dropped rather than reopening the file
+	if n, err := r.Write([]byte(record(0))); n != len(record(0)) || err != nil {
+		t.Errorf("Write after Close = %d, %v", n, err)
+	}
+	if got := readLog(t, path); got != "" {
+		t.Errorf("log = %q, want nothing written after Close", got)
+	}
+}
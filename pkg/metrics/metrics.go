@@ -0,0 +1,340 @@
+// Package metrics exposes deployment and machine state in the Prometheus
+// text exposition format.
+//
+// State gauges follow the Prometheus enum convention: one series per
+// possible state, set to 1 for the current state and 0 for the others.
+// Durations run from the first update that shows a resource or service in
+// progress to the update that shows it succeeded.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// namespace prefixes every metric name
+const namespace = "bte"
+
+// durationBuckets are the upper bounds, in seconds, of the duration
+// histograms
+var durationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200, 1800, 3600}
+
+// serviceNames are the label values of the machine services, in the order
+// machineServices returns their states
+var serviceNames = []string{"ssh", "docker", "core_packages", "bacalhau"}
+
+func machineServices(machine *models.Machine) []models.ServiceState {
+	return []models.ServiceState{machine.SSH, machine.Docker, machine.CorePackages, machine.Bacalhau}
+}
+
+// machineSample is the state of one machine at the last Observe
+type machineSample struct {
+	name      string
+	provider  string
+	location  string
+	services  []models.ServiceState
+	resources map[string]models.AzureResourceState
+	complete  bool
+	failed    bool
+}
+
+// progressKey names a resource or service of a machine whose duration is
+// being timed
+type progressKey struct {
+	machine string
+	kind    string
+	name    string
+}
+
+// Collector keeps the latest deployment state and the counters and
+// histograms built up from the updates. Observe and the counters are called
+// from the display's update loop and ServeHTTP from the HTTP server.
+type Collector struct {
+	mu       sync.Mutex
+	received uint64
+	dropped  uint64
+
+	machines []machineSample
+	started  map[progressKey]time.Time
+	// finished holds the keys already observed as succeeded, so a repeated
+	// update is not counted twice
+	finished map[progressKey]bool
+
+	resourceDurations map[string]*histogram
+	serviceDurations  map[string]*histogram
+}
+
+// New returns an empty collector
+func New() *Collector {
+	return &Collector{
+		started:           map[progressKey]time.Time{},
+		finished:          map[progressKey]bool{},
+		resourceDurations: map[string]*histogram{},
+		serviceDurations:  map[string]*histogram{},
+	}
+}
+
+// StatusReceived counts a status update delivered to the display
+func (c *Collector) StatusReceived() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.received++
+}
+
+// StatusDropped counts a status update that matched no machine
+func (c *Collector) StatusDropped() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropped++
+}
+
+// Observe records the state of every machine in d at now, timing the
+// resources and services that have started or succeeded since the last call
+func (c *Collector) Observe(d *models.Deployment, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.machines = c.machines[:0]
+	for i := range d.Machines {
+		machine := &d.Machines[i]
+		if machine.Name == "" {
+			continue
+		}
+		sample := machineSample{
+			name:      machine.Name,
+			provider:  string(machine.GetProvider()),
+			location:  machine.Location,
+			services:  machineServices(machine),
+			resources: map[string]models.AzureResourceState{},
+			complete:  machine.Complete(),
+			failed:    machine.Failed(),
+		}
+		for _, resourceType := range machine.RequiredResources() {
+			state := machine.GetResource(resourceType.ResourceString).ResourceState
+			sample.resources[resourceType.ShortResourceName] = state
+			c.track(progressKey{machine.Name, "resource", resourceType.ShortResourceName},
+				resourceInProgress(state), state == models.AzureResourceStateSucceeded,
+				c.resourceDurations, now)
+		}
+		for j, state := range sample.services {
+			c.track(progressKey{machine.Name, "service", serviceNames[j]},
+				state == models.ServiceStateCreated || state == models.ServiceStateUpdating,
+				state == models.ServiceStateSucceeded,
+				c.serviceDurations, now)
+		}
+		c.machines = append(c.machines, sample)
+	}
+}
+
+func resourceInProgress(state models.AzureResourceState) bool {
+	return state == models.AzureResourceStatePending || state == models.AzureResourceStateRunning
+}
+
+// track starts timing key when it is first seen in progress and records the
+// duration in histograms[key.name] when it first succeeds. Something that
+// was never seen in progress, e.g. a resumed deployment, is not timed.
+func (c *Collector) track(
+	key progressKey,
+	inProgress, succeeded bool,
+	histograms map[string]*histogram,
+	now time.Time,
+) {
+	start, timing := c.started[key]
+	switch {
+	case inProgress && !timing:
+		c.started[key] = now
+		delete(c.finished, key)
+	case succeeded && timing && !c.finished[key]:
+		h, ok := histograms[key.name]
+		if !ok {
+			h = newHistogram(durationBuckets)
+			histograms[key.name] = h
+		}
+		h.observe(now.Sub(start).Seconds())
+		c.finished[key] = true
+	case !inProgress && !succeeded:
+		// Back to not started, e.g. retried: time the next attempt afresh
+		delete(c.started, key)
+		delete(c.finished, key)
+	}
+}
+
+// ServeHTTP writes the metrics in the text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteText(w) //nolint:errcheck
+}
+
+// WriteText writes the metrics in the text exposition format
+func (c *Collector) WriteText(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+	c.writeCounters(&b)
+	c.writeMachines(&b)
+	c.writeServiceStates(&b)
+	c.writeResourceStates(&b)
+	writeHistograms(&b, "resource_duration_seconds",
+		"Time from a resource first being in progress to it succeeding.", "type", c.resourceDurations)
+	writeHistograms(&b, "service_duration_seconds",
+		"Time from a service first being in progress to it succeeding.", "service", c.serviceDurations)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (c *Collector) writeCounters(b *strings.Builder) {
+	header(b, "status_updates_received_total", "counter", "Status updates delivered to the display.")
+	sample(b, "status_updates_received_total", nil, float64(c.received))
+	header(b, "status_updates_dropped_total", "counter", "Status updates that matched no machine.")
+	sample(b, "status_updates_dropped_total", nil, float64(c.dropped))
+}
+
+func (c *Collector) writeMachines(b *strings.Builder) {
+	counts := map[string]int{"complete": 0, "failed": 0, "in_progress": 0}
+	for _, machine := range c.machines {
+		switch {
+		case machine.failed:
+			counts["failed"]++
+		case machine.complete:
+			counts["complete"]++
+		default:
+			counts["in_progress"]++
+		}
+	}
+	header(b, "machines", "gauge", "Machines by outcome.")
+	for _, outcome := range []string{"complete", "failed", "in_progress"} {
+		sample(b, "machines", []string{"outcome", outcome}, float64(counts[outcome]))
+	}
+}
+
+func (c *Collector) writeServiceStates(b *strings.Builder) {
+	header(b, "machine_service_state", "gauge", "Current state of each machine service, 1 for the current state.")
+	for _, machine := range c.machines {
+		for i, current := range machine.services {
+			// Unknown only marks a status that leaves the service alone, a
+			// machine never settles in it
+			for state := models.ServiceStateNotStarted; state < models.ServiceStateUnknown; state++ {
+				sample(b, "machine_service_state", []string{
+					"machine", machine.name,
+					"location", machine.location,
+					"provider", machine.provider,
+					"service", serviceNames[i],
+					"state", state.String(),
+				}, boolValue(state == current))
+			}
+		}
+	}
+}
+
+func (c *Collector) writeResourceStates(b *strings.Builder) {
+	header(b, "machine_resource_state", "gauge", "Current state of each machine resource, 1 for the current state.")
+	for _, machine := range c.machines {
+		types := make([]string, 0, len(machine.resources))
+		for name := range machine.resources {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		for _, name := range types {
+			current := machine.resources[name]
+			for state := models.AzureResourceStateUnknown; state <= models.AzureResourceStateSucceeded; state++ {
+				sample(b, "machine_resource_state", []string{
+					"machine", machine.name,
+					"location", machine.location,
+					"provider", machine.provider,
+					"type", name,
+					"state", state.String(),
+				}, boolValue(state == current))
+			}
+		}
+	}
+}
+
+func writeHistograms(b *strings.Builder, name, help, label string, histograms map[string]*histogram) {
+	header(b, name, "histogram", help)
+	keys := make([]string, 0, len(histograms))
+	for key := range histograms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := histograms[key]
+		cumulative := uint64(0)
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			sample(b, name+"_bucket", []string{label, key, "le", formatFloat(bound)}, float64(cumulative))
+		}
+		sample(b, name+"_bucket", []string{label, key, "le", "+Inf"}, float64(h.count))
+		sample(b, name+"_sum", []string{label, key}, h.sum)
+		sample(b, name+"_count", []string{label, key}, float64(h.count))
+	}
+}
+
+// histogram counts observations per bucket; counts[i] is the number that
+// fell in (bounds[i-1], bounds[i]]
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	h.count++
+	h.sum += value
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s_%s %s\n", namespace, name, help)
+	fmt.Fprintf(b, "# TYPE %s_%s %s\n", namespace, name, kind)
+}
+
+// sample writes one series; labels alternate names and values
+func sample(b *strings.Builder, name string, labels []string, value float64) {
+	b.WriteString(namespace + "_" + name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
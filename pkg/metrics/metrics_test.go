@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+func deployment() *models.Deployment {
+	d := models.NewDeployment()
+	d.Machines = []models.Machine{{
+		Name:     "abc01-vm",
+		Type:     models.AzureResourceTypeVM,
+		Provider: models.ProviderAzure,
+		Location: "eastus",
+		SSH:      models.ServiceStateUpdating,
+	}}
+	return d
+}
+
+func exposition(t *testing.T, c *Collector) string {
+	t.Helper()
+	var b strings.Builder
+	if err := c.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestExposition(t *testing.T) {
+	c := New()
+	c.StatusReceived()
+	c.StatusReceived()
+	c.StatusDropped()
+	c.Observe(deployment(), time.Now())
+	text := exposition(t, c)
+
+	for _, want := range []string{
+		"# TYPE bte_status_updates_received_total counter\n",
+		"bte_status_updates_received_total 2\n",
+		"bte_status_updates_dropped_total 1\n",
+		`bte_machines{outcome="in_progress"} 1` + "\n",
+		`bte_machines{outcome="complete"} 0` + "\n",
+		`bte_machine_service_state{machine="abc01-vm",location="eastus",provider="Azure",service="ssh",state="Updating"} 1` + "\n",
+		`bte_machine_service_state{machine="abc01-vm",location="eastus",provider="Azure",service="ssh",state="NotStarted"} 0` + "\n",
+		`bte_machine_resource_state{machine="abc01-vm",location="eastus",provider="Azure",type="VM",state="Unknown"} 1` + "\n",
+		"# TYPE bte_service_duration_seconds histogram\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in\n%s", want, text)
+		}
+	}
+	// Every service has one series per state it can be in, exactly one of
+	// them set
+	var series, set int
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "bte_machine_service_state{") {
+			series++
+			if strings.HasSuffix(line, " 1") {
+				set++
+			}
+		}
+	}
+	if want := len(serviceNames) * int(models.ServiceStateUnknown); series != want || set != len(serviceNames) {
+		t.Errorf("%d service state series with %d set, want %d with %d", series, set, want, len(serviceNames))
+	}
+}
+
+func TestLabelsAreEscaped(t *testing.T) {
+	c := New()
+	d := deployment()
+	d.Machines[0].Location = "east \"us\"\\1\n"
+	c.Observe(d, time.Now())
+	if text := exposition(t, c); !strings.Contains(text, `location="east \"us\"\\1\n"`) {
+		t.Errorf("location not escaped:\n%s", text)
+	}
+}
+
+func TestDurationHistograms(t *testing.T) {
+	c := New()
+	d := deployment()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	machine := &d.Machines[0]
+
+	// ssh takes 7s; seeing it succeeded again doesn't count twice
+	c.Observe(d, start)
+	machine.SSH = models.ServiceStateSucceeded
+	c.Observe(d, start.Add(7*time.Second))
+	c.Observe(d, start.Add(8*time.Second))
+
+	// A retry is timed from its own start: 100s
+	machine.SSH = models.ServiceStateNotStarted
+	c.Observe(d, start.Add(10*time.Second))
+	machine.SSH = models.ServiceStateUpdating
+	c.Observe(d, start.Add(20*time.Second))
+	machine.SSH = models.ServiceStateSucceeded
+	c.Observe(d, start.Add(120*time.Second))
+
+	// Docker was never seen in progress, so it isn't timed
+	machine.Docker = models.ServiceStateSucceeded
+	c.Observe(d, start.Add(130*time.Second))
+
+	text := exposition(t, c)
+	for _, want := range []string{
+		`bte_service_duration_seconds_bucket{service="ssh",le="5"} 0`,
+		`bte_service_duration_seconds_bucket{service="ssh",le="10"} 1`,
+		`bte_service_duration_seconds_bucket{service="ssh",le="60"} 1`,
+		`bte_service_duration_seconds_bucket{service="ssh",le="120"} 2`,
+		`bte_service_duration_seconds_bucket{service="ssh",le="3600"} 2`,
+		`bte_service_duration_seconds_bucket{service="ssh",le="+Inf"} 2`,
+		`bte_service_duration_seconds_sum{service="ssh"} 107`,
+		`bte_service_duration_seconds_count{service="ssh"} 2`,
+	} {
+		if !strings.Contains(text, want+"\n") {
+			t.Errorf("missing %q in\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `bte_service_duration_seconds_count{service="docker"}`) {
+		t.Errorf("docker was timed without being seen in progress:\n%s", text)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]float64{1, 5, 10})
+	for _, value := range []float64{0.5, 1, 3, 10, 11} {
+		h.observe(value)
+	}
+	if want := []uint64{2, 1, 1}; !slices.Equal(h.counts, want) {
+		t.Errorf("bucket counts %v, want %v", h.counts, want)
+	}
+	if h.count != 5 || h.sum != 25.5 {
+		t.Errorf("count %d, sum %g, want 5 and 25.5", h.count, h.sum)
+	}
+}
@@ -1,13 +1,11 @@
 package models
 
 import (
-	"fmt"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute"
-	"github.com/spf13/viper"
 )
 
 type ServiceState int
@@ -24,13 +22,17 @@ const (
 type Machine struct {
 	ID            string
 	Name          string
-	Type          AzureResourceTypes
+	Type          ResourceType
+	Provider      Provider
 	Location      string
 	StatusMessage string
 	Parameters    Parameters
 	PublicIP      string
 	PrivateIP     string
 	StartTime     time.Time
+	// EndTime is when the machine completed or failed, zero while it is
+	// still in progress
+	EndTime time.Time
 
 	machineResources map[string]MachineResource
 
@@ -71,39 +73,64 @@ func (m *Machine) GetResource(resourceType string) MachineResource {
 	return MachineResource{}
 }
 
-func (m *Machine) SetResource(resourceType string, resourceState AzureResourceState) {
+// SetResource records the state of one of the machine's resources, and its
+// value if it has one. An empty value keeps the value already recorded, such
+// as one restored by --resume.
+func (m *Machine) SetResource(resourceType string, resourceState AzureResourceState, resourceValue string) {
 	if m.machineResources == nil {
 		m.machineResources = make(map[string]MachineResource)
 	}
+	updatedAt := time.Now()
+	existing, ok := m.machineResources[resourceType]
+	if ok && existing.ResourceState == resourceState {
+		updatedAt = existing.UpdatedAt
+	}
+	if resourceValue == "" {
+		resourceValue = existing.ResourceValue
+	}
 	m.machineResources[resourceType] = MachineResource{
 		ResourceName:  resourceType,
-		ResourceType:  GetAzureResourceType(resourceType),
+		ResourceType:  m.lookupResourceType(resourceType),
 		ResourceState: resourceState,
-		ResourceValue: "",
+		ResourceValue: resourceValue,
+		UpdatedAt:     updatedAt,
 	}
 }
 
-func (m *Machine) ResourcesComplete() (int, int) {
-	// Below is the list of resources that are required to be created for a machine
-	allResources := []MachineResource{
-		m.machineResources[AzureResourceTypeVNET.ResourceString],
-		m.machineResources[AzureResourceTypeNIC.ResourceString],
-		m.machineResources[AzureResourceTypeNSG.ResourceString],
-		m.machineResources[AzureResourceTypeIP.ResourceString],
-		m.machineResources[AzureResourceTypeDISK.ResourceString],
-		m.machineResources[AzureResourceTypeSNET.ResourceString],
-		m.machineResources[AzureResourceTypeVM.ResourceString],
+// GetProvider returns the machine's provider, or DefaultProvider if it has
+// none
+func (m *Machine) GetProvider() Provider {
+	if m.Provider == "" {
+		return DefaultProvider
 	}
+	return m.Provider
+}
 
-	totalResources := len(allResources)
+// RequiredResources lists the resources that are required to be created for
+// the machine, in the order they are displayed
+func (m *Machine) RequiredResources() []ResourceType {
+	return RequiredResources(m.GetProvider())
+}
+
+// lookupResourceType finds resourceType in the machine's provider catalog,
+// falling back to every provider for full resource strings
+func (m *Machine) lookupResourceType(resourceType string) ResourceType {
+	if r := LookupResourceType(m.GetProvider(), resourceType); r.ResourceString != "" {
+		return r
+	}
+	return FindResourceType(resourceType)
+}
+
+func (m *Machine) ResourcesComplete() (int, int) {
+	required := m.RequiredResources()
 	completedResources := 0
 
-	for _, resource := range m.machineResources {
-		if resource.ResourceState == AzureResourceStateSucceeded {
+	for _, resourceType := range required {
+		if m.GetResource(resourceType.ResourceString).ResourceState == AzureResourceStateSucceeded {
 			completedResources++
 		}
 	}
-	return completedResources, totalResources
+	return completedResources, len(required)
 }
 
 func (m *Machine) Complete() bool {
@@ -115,77 +142,41 @@ func (m *Machine) Complete() bool {
 		m.Bacalhau >= ServiceStateSucceeded
 }
 
-type AzureResourceTypes struct {
-	ResourceString    string
-	ShortResourceName string
-}
-
-var AzureResourceTypeNIC = AzureResourceTypes{
-	ResourceString:    "Microsoft.Network/networkInterfaces",
-	ShortResourceName: "NIC",
-}
-
-var AzureResourceTypeVNET = AzureResourceTypes{
-	ResourceString:    "Microsoft.Network/virtualNetworks",
-	ShortResourceName: "VNET",
-}
-
-var AzureResourceTypeSNET = AzureResourceTypes{
-	ResourceString:    "Microsoft.Network/subnets",
-	ShortResourceName: "SNET",
-}
-
-var AzureResourceTypeNSG = AzureResourceTypes{
-	ResourceString:    "Microsoft.Network/networkSecurityGroups",
-	ShortResourceName: "NSG",
-}
-
-var AzureResourceTypeVM = AzureResourceTypes{
-	ResourceString:    "Microsoft.Compute/virtualMachines",
-	ShortResourceName: "VM",
-}
-
-var AzureResourceTypeDISK = AzureResourceTypes{
-	ResourceString:    "Microsoft.Compute/disks",
-	ShortResourceName: "DISK",
-}
-
-var AzureResourceTypeIP = AzureResourceTypes{
-	ResourceString:    "Microsoft.Network/publicIPAddresses",
-	ShortResourceName: "IP",
-}
-
-func (a *AzureResourceTypes) GetResourceString() string {
-	return a.ResourceString
-}
-
-func (a *AzureResourceTypes) GetShortResourceName() string {
-	return a.ShortResourceName
+// Failed reports whether any service or required resource of the machine
+// has failed
+func (m *Machine) Failed() bool {
+	for _, state := range []ServiceState{m.SSH, m.Docker, m.CorePackages, m.Bacalhau} {
+		if state == ServiceStateFailed {
+			return true
+		}
+	}
+	for _, resource := range m.machineResources {
+		if resource.ResourceState == AzureResourceStateFailed {
+			return true
+		}
+	}
+	return false
 }
 
-func GetAzureResourceType(resource string) AzureResourceTypes {
+// GetAzureResourceType looks up an Azure resource type by its full resource
+// string
+func GetAzureResourceType(resource string) ResourceType {
 	for _, r := range GetAllAzureResources() {
 		if strings.EqualFold(r.ResourceString, resource) {
 			return r
 		}
 	}
-	return AzureResourceTypes{}
+	return ResourceType{}
 }
 
-func GetAllAzureResources() []AzureResourceTypes {
-	return []AzureResourceTypes{
-		AzureResourceTypeNIC,
-		AzureResourceTypeVNET,
-		AzureResourceTypeSNET,
-		AzureResourceTypeNSG,
-		AzureResourceTypeVM,
-		AzureResourceTypeDISK,
-		AzureResourceTypeIP,
-	}
+// GetAzureResourceTypeByName looks up a resource type by either its full
+// resource string (e.g. Microsoft.Compute/virtualMachines) or its short name (e.g. VM)
+func GetAzureResourceTypeByName(name string) ResourceType {
+	return LookupResourceType(ProviderAzure, name)
 }
 
-func IsValidResource(resource string) bool {
-	return GetAzureResourceType(resource).ResourceString != ""
+func GetAllAzureResources() []ResourceType {
+	return ResourceTypes(ProviderAzure)
 }
 
 type AzureResourceState int
@@ -203,11 +194,11 @@ func ConvertFromStringToAzureResourceState(s string) AzureResourceState {
 	switch s {
 	case "Not Started":
 		return AzureResourceStateNotStarted
-	case "Pending":
+	case "Pending", "Accepted", "Creating", "Updating":
 		return AzureResourceStatePending
 	case "Running":
 		return AzureResourceStateRunning
-	case "Failed":
+	case "Failed", "Canceled":
 		return AzureResourceStateFailed
 	case "Succeeded":
 		return AzureResourceStateSucceeded
@@ -218,15 +209,17 @@ func ConvertFromStringToAzureResourceState(s string) AzureResourceState {
 
 type MachineResource struct {
 	ResourceName  string
-	ResourceType  AzureResourceTypes
+	ResourceType  ResourceType
 	ResourceState AzureResourceState
 	ResourceValue string
+	// UpdatedAt is when ResourceState last changed
+	UpdatedAt time.Time
 }
 
 type Parameters struct {
-	Count        int
-	Type         string
-	Orchestrator bool
+	Count        int    `json:"count" mapstructure:"count"`
+	Type         string `json:"type" mapstructure:"type"`
+	Orchestrator bool   `json:"orchestrator" mapstructure:"orchestrator"`
 }
 
 type Deployment struct {
@@ -235,7 +228,6 @@ type Deployment struct {
 	ResourceGroupName     string
 	ResourceGroupLocation string
 	Locations             []string
-	OrchestratorNode      *Machine
 	Machines              []Machine
 	ProjectID             string
 	UniqueID              string
@@ -267,13 +259,49 @@ func NewDeployment() *Deployment {
 	}
 }
 
+// OrchestratorNode returns the orchestrator machine, or nil if there is
+// none. It is looked up on each call, since a pointer into Machines goes
+// stale when a machine is appended.
+func (d *Deployment) OrchestratorNode() *Machine {
+	for i := range d.Machines {
+		if d.Machines[i].Orchestrator {
+			return &d.Machines[i]
+		}
+	}
+	return nil
+}
+
+// MarkFinished stamps now as the end time of machines that have just
+// completed or failed, and of the deployment once every machine has. End
+// times are cleared again for anything that is back in progress.
+func (d *Deployment) MarkFinished(now time.Time) {
+	finished := len(d.Machines) > 0
+	for i := range d.Machines {
+		machine := &d.Machines[i]
+		done := machine.Complete() || machine.Failed()
+		switch {
+		case done && machine.EndTime.IsZero():
+			machine.EndTime = now
+		case !done:
+			machine.EndTime = time.Time{}
+			finished = false
+		}
+	}
+	switch {
+	case finished && d.EndTime.IsZero():
+		d.EndTime = now
+	case !finished:
+		d.EndTime = time.Time{}
+	}
+}
+
 func (d *Deployment) ToMap() map[string]interface{} {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 	return map[string]interface{}{
 		"ResourceGroupName":     d.ResourceGroupName,
 		"ResourceGroupLocation": d.ResourceGroupLocation,
-		"OrchestratorNode":      d.OrchestratorNode,
+		"OrchestratorNode":      d.OrchestratorNode(),
 		"Machines":              d.Machines,
 		"ProjectID":             d.ProjectID,
 		"UniqueID":              d.UniqueID,
@@ -281,25 +309,6 @@ func (d *Deployment) ToMap() map[string]interface{} {
 	}
 }
 
-func (d *Deployment) UpdateViperConfig() error {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-	v := viper.GetViper()
-	deploymentPath := fmt.Sprintf("deployments.azure.%s", d.ResourceGroupName)
-	viperMachines := make([]map[string]interface{}, len(d.Machines))
-	for i, machine := range d.Machines {
-		viperMachines[i] = map[string]interface{}{
-			"Name":         machine.Name,
-			"PublicIP":     machine.PublicIP,
-			"PrivateIP":    machine.PrivateIP,
-			"Orchestrator": machine.Parameters.Orchestrator,
-		}
-	}
-
-	v.Set(deploymentPath, viperMachines)
-	return v.WriteConfig()
-}
-
 type StatusUpdateMsg struct {
 	Status *DisplayStatus
 }
@@ -3,13 +3,14 @@ package models
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
-const StatusLength = 20
+// StatusLength is the width status messages are padded or cut to. It is
+// set from the config's display.status_width at startup.
+var StatusLength = 30
 
 type DisplayModel struct {
 	Deployment *Deployment
@@ -22,7 +23,7 @@ type DisplayModel struct {
 // DisplayMachine represents a single machine in the deployment
 type DisplayMachine struct {
 	Name          string
-	Type          AzureResourceTypes
+	Type          ResourceType
 	Location      string
 	StatusMessage string
 	StartTime     time.Time
@@ -60,7 +61,6 @@ func InitialModel() *DisplayModel {
 	return &DisplayModel{
 		Deployment: NewDeployment(),
 		TextBox:    []string{"Resource Status Monitor"},
-		DebugMode:  os.Getenv("DEBUG_DISPLAY") == "1",
 	}
 }
 
@@ -110,10 +110,11 @@ func (m *DisplayModel) findOrCreateMachine(status *DisplayStatus) (*Machine, boo
 		}
 	}
 
-	if status.Name != "" && status.Type == AzureResourceTypeVM {
+	if status.Name != "" && status.Type.IsMachine() {
 		newMachine := Machine{
 			Name:          status.Name,
 			Type:          status.Type,
+			Provider:      status.Type.Provider,
 			Location:      status.Location,
 			StatusMessage: status.StatusMessage,
 			StartTime:     time.Now(),
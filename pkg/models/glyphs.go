@@ -0,0 +1,261 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Glyph names a symbol the display shows for a state or a column
+type Glyph int
+
+const (
+	GlyphUnknown Glyph = iota
+	GlyphNotStarted
+	GlyphCreating
+	GlyphWaiting
+	GlyphSucceeded
+	GlyphFailed
+
+	GlyphOrchestratorNode
+	GlyphWorkerNode
+
+	// Titles of the service columns
+	GlyphOrchestrator
+	GlyphSSH
+	GlyphDocker
+	GlyphBacalhau
+
+	// The progress bar's filled and empty cells
+	GlyphProgressFilled
+	GlyphProgressEmpty
+
+	// Markers of expanded and collapsed groups of rows
+	GlyphGroupExpanded
+	GlyphGroupCollapsed
+)
+
+// GlyphSet maps glyphs to the symbols of one character repertoire
+type GlyphSet interface {
+	Name() string
+	Symbol(g Glyph) string
+}
+
+// Glyph set names
+const (
+	GlyphSetEmoji    = "emoji"
+	GlyphSetUnicode  = "unicode"
+	GlyphSetASCII    = "ascii"
+	GlyphSetNerdFont = "nerdfont"
+)
+
+// glyphTable is a GlyphSet backed by a fixed table
+type glyphTable struct {
+	name    string
+	symbols map[Glyph]string
+}
+
+func (t glyphTable) Name() string {
+	return t.name
+}
+
+func (t glyphTable) Symbol(g Glyph) string {
+	if symbol, ok := t.symbols[g]; ok {
+		return symbol
+	}
+	return t.symbols[GlyphUnknown]
+}
+
+var (
+	EmojiGlyphs GlyphSet = glyphTable{GlyphSetEmoji, map[Glyph]string{
+		GlyphUnknown:          "❓",
+		GlyphNotStarted:       "⬛️",
+		GlyphCreating:         "⬆️",
+		GlyphWaiting:          "⏳",
+		GlyphSucceeded:        "✅",
+		GlyphFailed:           "❌",
+		GlyphOrchestratorNode: "🌕",
+		GlyphWorkerNode:       "⚫️",
+		GlyphOrchestrator:     "🤖",
+		GlyphSSH:              "🔑",
+		GlyphDocker:           "🐳",
+		GlyphBacalhau:         "🐟",
+		GlyphProgressFilled:   "█",
+		GlyphProgressEmpty:    "░",
+		GlyphGroupExpanded:    "▾",
+		GlyphGroupCollapsed:   "▸",
+	}}
+
+	// UnicodeGlyphs uses single-width symbols that render in any UTF-8
+	// terminal font
+	UnicodeGlyphs GlyphSet = glyphTable{GlyphSetUnicode, map[Glyph]string{
+		GlyphUnknown:          "?",
+		GlyphNotStarted:       "┅",
+		GlyphCreating:         "⌃",
+		GlyphWaiting:          "↻",
+		GlyphSucceeded:        "✔",
+		GlyphFailed:           "✘",
+		GlyphOrchestratorNode: "⏼",
+		GlyphWorkerNode:       " ",
+		GlyphOrchestrator:     "O",
+		GlyphSSH:              "S",
+		GlyphDocker:           "D",
+		GlyphBacalhau:         "B",
+		GlyphProgressFilled:   "█",
+		GlyphProgressEmpty:    "░",
+		GlyphGroupExpanded:    "▾",
+		GlyphGroupCollapsed:   "▸",
+	}}
+
+	// ASCIIGlyphs is safe on serial consoles and in CI logs
+	ASCIIGlyphs GlyphSet = glyphTable{GlyphSetASCII, map[Glyph]string{
+		GlyphUnknown:          "?",
+		GlyphNotStarted:       ".",
+		GlyphCreating:         "^",
+		GlyphWaiting:          "~",
+		GlyphSucceeded:        "+",
+		GlyphFailed:           "x",
+		GlyphOrchestratorNode: "*",
+		GlyphWorkerNode:       " ",
+		GlyphOrchestrator:     "O",
+		GlyphSSH:              "S",
+		GlyphDocker:           "D",
+		GlyphBacalhau:         "B",
+		GlyphProgressFilled:   "#",
+		GlyphProgressEmpty:    "-",
+		GlyphGroupExpanded:    "v",
+		GlyphGroupCollapsed:   ">",
+	}}
+
+	// NerdFontGlyphs needs a patched font from nerdfonts.com
+	NerdFontGlyphs GlyphSet = glyphTable{GlyphSetNerdFont, map[Glyph]string{
+		GlyphUnknown:          "\uf128", // nf-fa-question
+		GlyphNotStarted:       "\uf10c", // nf-fa-circle_o
+		GlyphCreating:         "\uf062", // nf-fa-arrow_up
+		GlyphWaiting:          "\uf021", // nf-fa-refresh
+		GlyphSucceeded:        "\uf00c", // nf-fa-check
+		GlyphFailed:           "\uf00d", // nf-fa-times
+		GlyphOrchestratorNode: "\uf005", // nf-fa-star
+		GlyphWorkerNode:       " ",
+		GlyphOrchestrator:     "\U000f06a9", // nf-md-robot
+		GlyphSSH:              "\uf084",     // nf-fa-key
+		GlyphDocker:           "\uf308",     // nf-linux-docker
+		GlyphBacalhau:         "\U000f023a", // nf-md-fish
+		GlyphProgressFilled:   "█",
+		GlyphProgressEmpty:    "░",
+		GlyphGroupExpanded:    "\uf0d7", // nf-fa-caret_down
+		GlyphGroupCollapsed:   "\uf0da", // nf-fa-caret_right
+	}}
+)
+
+var glyphSets = map[string]GlyphSet{
+	GlyphSetEmoji:    EmojiGlyphs,
+	GlyphSetUnicode:  UnicodeGlyphs,
+	GlyphSetASCII:    ASCIIGlyphs,
+	GlyphSetNerdFont: NerdFontGlyphs,
+}
+
+// GlyphSetNames returns the names of the available glyph sets
+func GlyphSetNames() []string {
+	names := make([]string, 0, len(glyphSets))
+	for name := range glyphSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupGlyphSet returns the glyph set with the given name
+func LookupGlyphSet(name string) (GlyphSet, error) {
+	set, ok := glyphSets[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown glyph set %q (available: %s)", name, strings.Join(GlyphSetNames(), ", "))
+	}
+	return set, nil
+}
+
+// DetectGlyphSet picks a glyph set from the locale and terminal. Output that
+// is not a terminal, dumb terminals and the Linux console get ASCII; UTF-8
+// locales get the Unicode set. Emoji and Nerd Font glyphs depend on the font,
+// so they are only used when asked for.
+func DetectGlyphSet(getenv func(string) string, terminal bool) GlyphSet {
+	if !terminal {
+		return ASCIIGlyphs
+	}
+	switch getenv("TERM") {
+	case "dumb", "linux", "vt100", "vt220":
+		return ASCIIGlyphs
+	}
+
+	locale := ""
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale = getenv(name); locale != "" {
+			break
+		}
+	}
+	locale = strings.ToLower(locale)
+	if strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8") {
+		return UnicodeGlyphs
+	}
+	return ASCIIGlyphs
+}
+
+var (
+	glyphsMu     sync.RWMutex
+	activeGlyphs = UnicodeGlyphs
+)
+
+// Glyphs returns the glyph set every state symbol is rendered with
+func Glyphs() GlyphSet {
+	glyphsMu.RLock()
+	defer glyphsMu.RUnlock()
+	return activeGlyphs
+}
+
+// SetGlyphs replaces the glyph set returned by Glyphs
+func SetGlyphs(set GlyphSet) {
+	glyphsMu.Lock()
+	defer glyphsMu.Unlock()
+	activeGlyphs = set
+}
+
+// ServiceStateGlyph returns the glyph for a service state
+func ServiceStateGlyph(state ServiceState) Glyph {
+	switch state {
+	case ServiceStateNotStarted:
+		return GlyphNotStarted
+	case ServiceStateCreated:
+		return GlyphCreating
+	case ServiceStateUpdating:
+		return GlyphWaiting
+	case ServiceStateSucceeded:
+		return GlyphSucceeded
+	case ServiceStateFailed:
+		return GlyphFailed
+	}
+	return GlyphUnknown
+}
+
+// ResourceStateGlyph returns the glyph for a resource state
+func ResourceStateGlyph(state AzureResourceState) Glyph {
+	switch state {
+	case AzureResourceStateNotStarted:
+		return GlyphNotStarted
+	case AzureResourceStatePending:
+		return GlyphWaiting
+	case AzureResourceStateRunning, AzureResourceStateSucceeded:
+		return GlyphSucceeded
+	case AzureResourceStateFailed:
+		return GlyphFailed
+	}
+	return GlyphUnknown
+}
+
+// NodeGlyph returns the glyph marking a machine's role
+func NodeGlyph(orchestrator bool) Glyph {
+	if orchestrator {
+		return GlyphOrchestratorNode
+	}
+	return GlyphWorkerNode
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+	"unicode"
+)
+
+func TestDetectGlyphSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		terminal bool
+		want     GlyphSet
+	}{
+		{"not a terminal", map[string]string{"LANG": "en_US.UTF-8"}, false, ASCIIGlyphs},
+		{"utf-8 locale", map[string]string{"LANG": "en_US.UTF-8"}, true, UnicodeGlyphs},
+		{"utf8 spelling", map[string]string{"LANG": "de_DE.utf8"}, true, UnicodeGlyphs},
+		{"LC_ALL over LANG", map[string]string{"LC_ALL": "C", "LANG": "en_US.UTF-8"}, true, ASCIIGlyphs},
+		{"LC_CTYPE over LANG", map[string]string{"LC_CTYPE": "en_US.UTF-8", "LANG": "C"}, true, UnicodeGlyphs},
+		{"no locale", map[string]string{}, true, ASCIIGlyphs},
+		{"dumb terminal", map[string]string{"TERM": "dumb", "LANG": "en_US.UTF-8"}, true, ASCIIGlyphs},
+		{"linux console", map[string]string{"TERM": "linux", "LANG": "en_US.UTF-8"}, true, ASCIIGlyphs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[name] }
+			if got := DetectGlyphSet(getenv, tt.terminal); got.Name() != tt.want.Name() {
+				t.Errorf("DetectGlyphSet = %s, want %s", got.Name(), tt.want.Name())
+			}
+		})
+	}
+}
+
+func TestLookupGlyphSet(t *testing.T) {
+	set, err := LookupGlyphSet("NerdFont")
+	if err != nil || set.Name() != GlyphSetNerdFont {
+		t.Errorf("LookupGlyphSet(NerdFont) = %v, %v", set, err)
+	}
+	if _, err := LookupGlyphSet("hieroglyphs"); err == nil {
+		t.Error("found an unknown glyph set")
+	}
+}
+
+func TestGlyphSetsCoverEveryGlyph(t *testing.T) {
+	for _, name := range GlyphSetNames() {
+		set, err := LookupGlyphSet(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		table := set.(glyphTable)
+		for g := GlyphUnknown; g <= GlyphGroupCollapsed; g++ {
+			if _, ok := table.symbols[g]; !ok {
+				t.Errorf("%s has no symbol for glyph %d", name, g)
+			}
+		}
+	}
+
+	for g := GlyphUnknown; g <= GlyphGroupCollapsed; g++ {
+		for _, r := range ASCIIGlyphs.Symbol(g) {
+			if r > unicode.MaxASCII {
+				t.Errorf("ascii symbol for glyph %d is %q", g, ASCIIGlyphs.Symbol(g))
+			}
+		}
+	}
+}
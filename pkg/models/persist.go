@@ -0,0 +1,313 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// The persisted form of a Deployment. Viper lowercases map keys, so anything
+// whose case matters (tags, resource types) is stored as a list of objects
+// rather than as a map.
+
+type deploymentState struct {
+	Name                  string         `json:"name"`
+	ResourceGroupName     string         `json:"resource_group_name"`
+	ResourceGroupLocation string         `json:"resource_group_location"`
+	SubscriptionID        string         `json:"subscription_id"`
+	ProjectID             string         `json:"project_id"`
+	UniqueID              string         `json:"unique_id"`
+	Locations             []string       `json:"locations"`
+	DefaultVMSize         string         `json:"default_vm_size"`
+	DefaultDiskSizeGB     int32          `json:"default_disk_size_gb"`
+	DefaultLocation       string         `json:"default_location"`
+	AllowedPorts          []int          `json:"allowed_ports"`
+	Tags                  []tagState     `json:"tags"`
+	StartTime             time.Time      `json:"start_time"`
+	EndTime               time.Time      `json:"end_time"`
+	Machines              []machineState `json:"machines"`
+}
+
+type tagState struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type machineState struct {
+	ID            string          `json:"id"`
+	Name          string          `json:"name"`
+	Provider      Provider        `json:"provider"`
+	Location      string          `json:"location"`
+	StatusMessage string          `json:"status_message"`
+	Parameters    Parameters      `json:"parameters"`
+	PublicIP      string          `json:"public_ip"`
+	PrivateIP     string          `json:"private_ip"`
+	VMSize        string          `json:"vm_size"`
+	DiskSizeGB    int32           `json:"disk_size_gb"`
+	ComputerName  string          `json:"computer_name"`
+	Orchestrator  bool            `json:"orchestrator"`
+	StartTime     time.Time       `json:"start_time"`
+	EndTime       time.Time       `json:"end_time"`
+	ElapsedTime   string          `json:"elapsed_time"`
+	SSH           ServiceState    `json:"ssh"`
+	Docker        ServiceState    `json:"docker"`
+	CorePackages  ServiceState    `json:"core_packages"`
+	Bacalhau      ServiceState    `json:"bacalhau"`
+	Resources     []resourceState `json:"resources"`
+}
+
+type resourceState struct {
+	Type      string             `json:"type"`
+	Name      string             `json:"name"`
+	State     AzureResourceState `json:"state"`
+	Value     string             `json:"value"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// Resources returns the machine's tracked resources ordered by resource type
+func (m *Machine) Resources() []MachineResource {
+	resources := make([]MachineResource, 0, len(m.machineResources))
+	for _, resource := range m.machineResources {
+		resources = append(resources, resource)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		a, b := resources[i], resources[j]
+		if a.ResourceType.ResourceString != b.ResourceType.ResourceString {
+			return a.ResourceType.ResourceString < b.ResourceType.ResourceString
+		}
+		return a.ResourceName < b.ResourceName
+	})
+	return resources
+}
+
+// PutResource stores resource as-is, keyed by its name as SetResource keys
+// it, so types missing from the catalogs keep a key each
+func (m *Machine) PutResource(resource MachineResource) {
+	if m.machineResources == nil {
+		m.machineResources = make(map[string]MachineResource)
+	}
+	key := resource.ResourceName
+	if key == "" {
+		key = resource.ResourceType.ResourceString
+	}
+	m.machineResources[key] = resource
+}
+
+// DeploymentConfigKey returns the viper key a deployment is stored under
+func DeploymentConfigKey(resourceGroupName string) string {
+	return fmt.Sprintf("deployments.azure.%s", resourceGroupName)
+}
+
+// SaveToViper stores the full deployment state in v under
+// deployments.azure.<resource group>
+func (d *Deployment) SaveToViper(v *viper.Viper) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.ResourceGroupName == "" {
+		return fmt.Errorf("cannot save a deployment without a resource group name")
+	}
+
+	state := deploymentState{
+		Name:                  d.Name,
+		ResourceGroupName:     d.ResourceGroupName,
+		ResourceGroupLocation: d.ResourceGroupLocation,
+		SubscriptionID:        d.SubscriptionID,
+		ProjectID:             d.ProjectID,
+		UniqueID:              d.UniqueID,
+		Locations:             d.Locations,
+		DefaultVMSize:         d.DefaultVMSize,
+		DefaultDiskSizeGB:     d.DefaultDiskSizeGB,
+		DefaultLocation:       d.DefaultLocation,
+		AllowedPorts:          d.AllowedPorts,
+		StartTime:             d.StartTime,
+		EndTime:               d.EndTime,
+	}
+
+	tagKeys := make([]string, 0, len(d.Tags))
+	for key := range d.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		value := ""
+		if d.Tags[key] != nil {
+			value = *d.Tags[key]
+		}
+		state.Tags = append(state.Tags, tagState{Key: key, Value: value})
+	}
+
+	for i := range d.Machines {
+		machine := &d.Machines[i]
+		ms := machineState{
+			ID:            machine.ID,
+			Name:          machine.Name,
+			Provider:      machine.GetProvider(),
+			Location:      machine.Location,
+			StatusMessage: machine.StatusMessage,
+			Parameters:    machine.Parameters,
+			PublicIP:      machine.PublicIP,
+			PrivateIP:     machine.PrivateIP,
+			VMSize:        machine.VMSize,
+			DiskSizeGB:    machine.DiskSizeGB,
+			ComputerName:  machine.ComputerName,
+			Orchestrator:  machine.Orchestrator,
+			StartTime:     machine.StartTime,
+			EndTime:       machine.EndTime,
+			ElapsedTime:   machine.ElapsedTime.String(),
+			SSH:           machine.SSH,
+			Docker:        machine.Docker,
+			CorePackages:  machine.CorePackages,
+			Bacalhau:      machine.Bacalhau,
+		}
+		for _, resource := range machine.Resources() {
+			ms.Resources = append(ms.Resources, resourceState{
+				Type:      resource.ResourceType.ResourceString,
+				Name:      resource.ResourceName,
+				State:     resource.ResourceState,
+				Value:     resource.ResourceValue,
+				UpdatedAt: resource.UpdatedAt,
+			})
+		}
+		state.Machines = append(state.Machines, ms)
+	}
+
+	// Round-trip through JSON so viper holds plain maps and lists, with
+	// states and times already in their text form
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode deployment: %w", err)
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(encoded, &plain); err != nil {
+		return fmt.Errorf("failed to encode deployment: %w", err)
+	}
+
+	v.Set(DeploymentConfigKey(d.ResourceGroupName), plain)
+	return nil
+}
+
+// SaveStateFile saves the deployment to the state file at path, keeping the
+// deployments of other resource groups already saved there
+func (d *Deployment) SaveStateFile(path string) error {
+	v, err := readStateFile(path)
+	if err != nil {
+		return err
+	}
+	if err := d.SaveToViper(v); err != nil {
+		return err
+	}
+	return v.WriteConfigAs(path)
+}
+
+// LoadDeploymentFromStateFile reads the deployment saved for
+// resourceGroupName in the state file at path
+func LoadDeploymentFromStateFile(path, resourceGroupName string) (*Deployment, error) {
+	v, err := readStateFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDeploymentFromViper(v, resourceGroupName)
+}
+
+// readStateFile reads the state file at path into a viper instance of its
+// own, so the settings never share it. A missing file reads as empty.
+func readStateFile(path string) (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if _, err := os.Stat(path); err != nil {
+		return v, nil
+	}
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+	return v, nil
+}
+
+// LoadDeploymentFromViper reads a deployment saved by SaveToViper
+func LoadDeploymentFromViper(v *viper.Viper, resourceGroupName string) (*Deployment, error) {
+	key := DeploymentConfigKey(resourceGroupName)
+	if !v.IsSet(key) {
+		return nil, fmt.Errorf("no saved deployment for resource group %q", resourceGroupName)
+	}
+
+	encoded, err := json.Marshal(v.Get(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved deployment: %w", err)
+	}
+	var state deploymentState
+	if err := json.Unmarshal(encoded, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse saved deployment: %w", err)
+	}
+
+	d := NewDeployment()
+	d.Name = state.Name
+	d.ResourceGroupName = state.ResourceGroupName
+	d.ResourceGroupLocation = state.ResourceGroupLocation
+	d.SubscriptionID = state.SubscriptionID
+	d.ProjectID = state.ProjectID
+	d.UniqueID = state.UniqueID
+	d.Locations = state.Locations
+	d.DefaultVMSize = state.DefaultVMSize
+	d.DefaultDiskSizeGB = state.DefaultDiskSizeGB
+	d.DefaultLocation = state.DefaultLocation
+	d.AllowedPorts = state.AllowedPorts
+	d.StartTime = state.StartTime
+	d.EndTime = state.EndTime
+	if d.ResourceGroupName == "" {
+		d.ResourceGroupName = resourceGroupName
+	}
+	for _, tag := range state.Tags {
+		value := tag.Value
+		d.Tags[tag.Key] = &value
+	}
+
+	for _, ms := range state.Machines {
+		elapsed, err := time.ParseDuration(ms.ElapsedTime)
+		if err != nil && ms.ElapsedTime != "" {
+			return nil, fmt.Errorf("machine %s: invalid elapsed time %q: %w", ms.Name, ms.ElapsedTime, err)
+		}
+		provider, err := ParseProvider(string(ms.Provider))
+		if err != nil {
+			return nil, fmt.Errorf("machine %s: %w", ms.Name, err)
+		}
+		machine := Machine{
+			ID:            ms.ID,
+			Name:          ms.Name,
+			Type:          MachineResourceType(provider),
+			Provider:      provider,
+			Location:      ms.Location,
+			StatusMessage: ms.StatusMessage,
+			Parameters:    ms.Parameters,
+			PublicIP:      ms.PublicIP,
+			PrivateIP:     ms.PrivateIP,
+			VMSize:        ms.VMSize,
+			DiskSizeGB:    ms.DiskSizeGB,
+			ComputerName:  ms.ComputerName,
+			Orchestrator:  ms.Orchestrator,
+			StartTime:     ms.StartTime,
+			EndTime:       ms.EndTime,
+			ElapsedTime:   elapsed,
+			SSH:           ms.SSH,
+			Docker:        ms.Docker,
+			CorePackages:  ms.CorePackages,
+			Bacalhau:      ms.Bacalhau,
+		}
+		for _, rs := range ms.Resources {
+			machine.PutResource(MachineResource{
+				ResourceName:  rs.Name,
+				ResourceType:  machine.lookupResourceType(rs.Type),
+				ResourceState: rs.State,
+				ResourceValue: rs.Value,
+				UpdatedAt:     rs.UpdatedAt,
+			})
+		}
+		d.Machines = append(d.Machines, machine)
+	}
+	return d, nil
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func savedDeployment() *Deployment {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	owner := "Platform Team"
+
+	d := NewDeployment()
+	d.Name = "demo"
+	d.ResourceGroupName = "demo-rg"
+	d.ResourceGroupLocation = "eastus"
+	d.SubscriptionID = "sub-1"
+	d.UniqueID = "abc"
+	d.Locations = []string{"eastus", "westus"}
+	d.DefaultVMSize = "Standard_B2s"
+	d.DefaultDiskSizeGB = 30
+	d.DefaultLocation = "eastus"
+	d.AllowedPorts = []int{22, 1234}
+	d.StartTime = start
+	d.Tags["CostCenter"] = &owner
+
+	orchestrator := Machine{
+		ID:            "abc01-vm",
+		Name:          "abc01-vm",
+		Type:          AzureResourceTypeVM,
+		Provider:      ProviderAzure,
+		Location:      "eastus",
+		StatusMessage: "ready",
+		Parameters:    Parameters{Count: 1, Orchestrator: true},
+		PublicIP:      "1.2.3.4",
+		PrivateIP:     "10.0.0.4",
+		VMSize:        "Standard_B2s",
+		DiskSizeGB:    30,
+		ComputerName:  "abc01-vm",
+		Orchestrator:  true,
+		StartTime:     start,
+		EndTime:       start.Add(3 * time.Minute),
+		ElapsedTime:   3 * time.Minute,
+		SSH:           ServiceStateSucceeded,
+		Docker:        ServiceStateSucceeded,
+		CorePackages:  ServiceStateSucceeded,
+		Bacalhau:      ServiceStateSucceeded,
+	}
+	orchestrator.PutResource(MachineResource{
+		ResourceName:  AzureResourceTypeNIC.ResourceString,
+		ResourceType:  AzureResourceTypeNIC,
+		ResourceState: AzureResourceStateSucceeded,
+		ResourceValue: "10.0.0.4",
+		UpdatedAt:     start.Add(time.Minute),
+	})
+
+	worker := Machine{
+		ID:        "abc02-vm",
+		Name:      "abc02-vm",
+		Type:      AzureResourceTypeVM,
+		Provider:  ProviderAzure,
+		Location:  "westus",
+		StartTime: start,
+		SSH:       ServiceStateFailed,
+		Docker:    ServiceStateNotStarted,
+	}
+	d.Machines = []Machine{orchestrator, worker}
+	return d
+}
+
+func TestDeploymentViperRoundTrip(t *testing.T) {
+	want := savedDeployment()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	// Save and write the file the way --resume finds it
+	v := viper.New()
+	if err := want.SaveToViper(v); err != nil {
+		t.Fatalf("SaveToViper: %v", err)
+	}
+	if err := v.WriteConfigAs(path); err != nil {
+		t.Fatalf("WriteConfigAs: %v", err)
+	}
+	reread := viper.New()
+	reread.SetConfigFile(path)
+	if err := reread.ReadInConfig(); err != nil {
+		t.Fatalf("ReadInConfig: %v", err)
+	}
+	if !reread.IsSet("deployments.azure.demo-rg.machines") {
+		t.Fatal("deployment not saved under deployments.azure.demo-rg")
+	}
+
+	got, err := LoadDeploymentFromViper(reread, "demo-rg")
+	if err != nil {
+		t.Fatalf("LoadDeploymentFromViper: %v", err)
+	}
+
+	if got.Name != want.Name || got.ResourceGroupName != want.ResourceGroupName ||
+		got.ResourceGroupLocation != want.ResourceGroupLocation || got.SubscriptionID != want.SubscriptionID ||
+		got.UniqueID != want.UniqueID || got.DefaultVMSize != want.DefaultVMSize ||
+		got.DefaultDiskSizeGB != want.DefaultDiskSizeGB || got.DefaultLocation != want.DefaultLocation ||
+		!got.StartTime.Equal(want.StartTime) || !got.EndTime.IsZero() {
+		t.Errorf("deployment fields changed:\n got %+v\nwant %+v", got, want)
+	}
+	if len(got.Locations) != 2 || got.Locations[1] != "westus" || len(got.AllowedPorts) != 2 || got.AllowedPorts[1] != 1234 {
+		t.Errorf("locations %v, ports %v", got.Locations, got.AllowedPorts)
+	}
+	if tag := got.Tags["CostCenter"]; tag == nil || *tag != "Platform Team" {
+		t.Errorf("tags = %v, want the CostCenter tag with its case kept", got.Tags)
+	}
+
+	if len(got.Machines) != 2 {
+		t.Fatalf("loaded %d machines, want 2", len(got.Machines))
+	}
+	for i := range want.Machines {
+		w, g := &want.Machines[i], &got.Machines[i]
+		if g.Name != w.Name || g.ID != w.ID || g.Location != w.Location || g.Type != w.Type ||
+			g.Provider != w.Provider || g.StatusMessage != w.StatusMessage || g.Parameters != w.Parameters ||
+			g.PublicIP != w.PublicIP || g.PrivateIP != w.PrivateIP || g.VMSize != w.VMSize ||
+			g.DiskSizeGB != w.DiskSizeGB || g.ComputerName != w.ComputerName || g.Orchestrator != w.Orchestrator ||
+			!g.StartTime.Equal(w.StartTime) || !g.EndTime.Equal(w.EndTime) || g.ElapsedTime != w.ElapsedTime ||
+			g.SSH != w.SSH || g.Docker != w.Docker || g.CorePackages != w.CorePackages || g.Bacalhau != w.Bacalhau {
+			t.Errorf("machine %d changed:\n got %+v\nwant %+v", i, *g, *w)
+		}
+	}
+
+	resources := got.Machines[0].Resources()
+	if len(resources) != 1 {
+		t.Fatalf("loaded resources %+v, want the NIC", resources)
+	}
+	nic := resources[0]
+	if nic.ResourceName != AzureResourceTypeNIC.ResourceString || nic.ResourceType != AzureResourceTypeNIC ||
+		nic.ResourceState != AzureResourceStateSucceeded || nic.ResourceValue != "10.0.0.4" ||
+		!nic.UpdatedAt.Equal(want.StartTime.Add(time.Minute)) {
+		t.Errorf("NIC = %+v", nic)
+	}
+
+	if got.OrchestratorNode() != &got.Machines[0] {
+		t.Errorf("orchestrator node = %v, want abc01-vm", got.OrchestratorNode())
+	}
+}
+
+func TestUnknownResourceTypesRoundTrip(t *testing.T) {
+	d := savedDeployment()
+	machine := &d.Machines[1]
+	machine.SetResource("Microsoft.Example/widgets", AzureResourceStateSucceeded, "w1")
+	machine.SetResource("Microsoft.Example/gadgets", AzureResourceStateFailed, "")
+
+	v := viper.New()
+	if err := d.SaveToViper(v); err != nil {
+		t.Fatalf("SaveToViper: %v", err)
+	}
+	got, err := LoadDeploymentFromViper(v, "demo-rg")
+	if err != nil {
+		t.Fatalf("LoadDeploymentFromViper: %v", err)
+	}
+
+	loaded := &got.Machines[1]
+	if n := len(loaded.Resources()); n != 2 {
+		t.Fatalf("loaded %d resources, want both unknown types: %+v", n, loaded.Resources())
+	}
+	widgets := loaded.GetResource("Microsoft.Example/widgets")
+	gadgets := loaded.GetResource("Microsoft.Example/gadgets")
+	if widgets.ResourceState != AzureResourceStateSucceeded || widgets.ResourceValue != "w1" ||
+		gadgets.ResourceState != AzureResourceStateFailed {
+		t.Errorf("widgets %+v, gadgets %+v", widgets, gadgets)
+	}
+}
+
+func TestLoadDeploymentFromViperMissing(t *testing.T) {
+	if _, err := LoadDeploymentFromViper(viper.New(), "nowhere-rg"); err == nil {
+		t.Error("loaded a deployment that was never saved")
+	}
+}
+
+func TestSaveToViperNeedsResourceGroup(t *testing.T) {
+	d := savedDeployment()
+	d.ResourceGroupName = ""
+	if err := d.SaveToViper(viper.New()); err == nil {
+		t.Error("saved a deployment without a resource group")
+	}
+}
+
+func TestStateFileKeepsOtherDeployments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+	first := savedDeployment()
+	if err := first.SaveStateFile(path); err != nil {
+		t.Fatalf("SaveStateFile: %v", err)
+	}
+	second := savedDeployment()
+	second.ResourceGroupName = "other-rg"
+	second.Name = "other"
+	if err := second.SaveStateFile(path); err != nil {
+		t.Fatalf("SaveStateFile: %v", err)
+	}
+
+	for rg, name := range map[string]string{"demo-rg": "demo", "other-rg": "other"} {
+		got, err := LoadDeploymentFromStateFile(path, rg)
+		if err != nil {
+			t.Fatalf("LoadDeploymentFromStateFile(%s): %v", rg, err)
+		}
+		if got.Name != name || len(got.Machines) != 2 {
+			t.Errorf("%s: loaded %s with %d machines", rg, got.Name, len(got.Machines))
+		}
+	}
+}
+
+func TestLoadDeploymentFromMissingStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+	if _, err := LoadDeploymentFromStateFile(path, "demo-rg"); err == nil {
+		t.Error("loaded a deployment from a state file that doesn't exist")
+	}
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultVMSize     = "Standard_B2s"
+	DefaultDiskSizeGB = 30
+	DefaultLocation   = "eastus"
+
+	uniqueIDLength = 4
+)
+
+var uniqueIDPattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// DeploymentPlan is the on-disk description of a deployment. It is read
+// through viper, so YAML, JSON and TOML all work:
+//
+//	name: demo
+//	resource_group_name: demo-rg
+//	provider: Azure
+//	default_vm_size: Standard_B2s
+//	allowed_ports: [22, 1234]
+//	tags:
+//	  owner: me
+//	locations:
+//	  - location: eastus
+//	    machines:
+//	      - count: 1
+//	        orchestrator: true
+//	      - count: 3
+//	        type: Standard_D2s_v3
+//	  - location: westus
+//	    machines:
+//	      - count: 2
+//	  - location: useast1
+//	    provider: AWS
+//	    machines:
+//	      - count: 2
+//
+// provider defaults to Azure and can be overridden per location. unique_id
+// prefixes the machine names; without it one is derived from
+// resource_group_name, or else name, so re-running a plan names its machines
+// the same way and finds their existing resources and saved state.
+type DeploymentPlan struct {
+	Name              string            `mapstructure:"name"`
+	ResourceGroupName string            `mapstructure:"resource_group_name"`
+	SubscriptionID    string            `mapstructure:"subscription_id"`
+	Provider          string            `mapstructure:"provider"`
+	UniqueID          string            `mapstructure:"unique_id"`
+	DefaultVMSize     string            `mapstructure:"default_vm_size"`
+	DefaultDiskSizeGB int32             `mapstructure:"default_disk_size_gb"`
+	DefaultLocation   string            `mapstructure:"default_location"`
+	AllowedPorts      []int             `mapstructure:"allowed_ports"`
+	Tags              map[string]string `mapstructure:"tags"`
+	Locations         []LocationPlan    `mapstructure:"locations"`
+}
+
+// LocationPlan lists the machine groups to create in one location
+type LocationPlan struct {
+	Location string       `mapstructure:"location"`
+	Provider string       `mapstructure:"provider"`
+	Machines []Parameters `mapstructure:"machines"`
+}
+
+// provider returns the location's provider, falling back to the plan's
+func (p *DeploymentPlan) provider(location LocationPlan) (Provider, error) {
+	if location.Provider != "" {
+		return ParseProvider(location.Provider)
+	}
+	return ParseProvider(p.Provider)
+}
+
+// LoadDeploymentPlan reads, validates and expands the plan file at path
+func LoadDeploymentPlan(path string) (*Deployment, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read deployment plan: %w", err)
+	}
+
+	var plan DeploymentPlan
+	if err := v.Unmarshal(&plan); err != nil {
+		return nil, fmt.Errorf("failed to parse deployment plan: %w", err)
+	}
+	if err := plan.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid deployment plan %s: %w", path, err)
+	}
+	return plan.Expand()
+}
+
+// Validate checks the plan for mistakes that would otherwise only show up
+// half way through a rollout
+func (p *DeploymentPlan) Validate() error {
+	var errs []string
+
+	if len(p.Locations) == 0 {
+		errs = append(errs, "at least one location is required")
+	}
+	if p.UniqueID == "" && p.ResourceGroupName == "" && p.Name == "" {
+		errs = append(errs, "one of unique_id, resource_group_name or name is required to name the machines")
+	}
+	if p.UniqueID != "" && !uniqueIDPattern.MatchString(p.UniqueID) {
+		errs = append(errs, fmt.Sprintf("unique_id %q must be lowercase letters and digits only", p.UniqueID))
+	}
+	if _, err := ParseProvider(p.Provider); err != nil {
+		errs = append(errs, err.Error())
+	}
+	for _, port := range p.AllowedPorts {
+		if port < 1 || port > 65535 {
+			errs = append(errs, fmt.Sprintf("allowed port %d is out of range", port))
+		}
+	}
+
+	seen := make(map[string]bool)
+	orchestrators := 0
+	for i, location := range p.Locations {
+		switch {
+		case location.Location == "":
+			errs = append(errs, fmt.Sprintf("locations[%d]: location is required", i))
+		case strings.Contains(location.Location, "-"):
+			// Location-scoped resources are named <location>-vnet, so the
+			// location itself cannot contain a dash
+			errs = append(errs, fmt.Sprintf("locations[%d]: location %q must not contain '-'", i, location.Location))
+		case seen[location.Location]:
+			errs = append(errs, fmt.Sprintf("locations[%d]: location %q is listed more than once", i, location.Location))
+		}
+		seen[location.Location] = true
+		if location.Provider != "" {
+			if _, err := ParseProvider(location.Provider); err != nil {
+				errs = append(errs, fmt.Sprintf("locations[%d]: %v", i, err))
+			}
+		}
+
+		if len(location.Machines) == 0 {
+			errs = append(errs, fmt.Sprintf("locations[%d]: at least one machine group is required", i))
+		}
+		for j, machine := range location.Machines {
+			if machine.Count < 1 {
+				errs = append(errs, fmt.Sprintf("locations[%d].machines[%d]: count must be at least 1", i, j))
+			}
+			if machine.Orchestrator {
+				orchestrators += machine.Count
+			}
+		}
+	}
+	if orchestrators != 1 {
+		errs = append(errs, fmt.Sprintf("exactly one orchestrator is required, found %d", orchestrators))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Expand turns the plan into a Deployment with one Machine per planned VM.
+// Machines are named <prefix>-vm, where the prefix is the plan's unique ID
+// followed by a sequence number, so GetMachineNameFromResourceName can map
+// their resources back to them.
+func (p *DeploymentPlan) Expand() (*Deployment, error) {
+	uniqueID := p.UniqueID
+	if uniqueID == "" {
+		uniqueID = deriveUniqueID(valueOrDefault(p.ResourceGroupName, p.Name))
+	}
+	if uniqueID == "" {
+		return nil, fmt.Errorf("plan has no unique_id, resource_group_name or name to name its machines")
+	}
+
+	d := NewDeployment()
+	d.Name = p.Name
+	d.ResourceGroupName = p.ResourceGroupName
+	d.SubscriptionID = p.SubscriptionID
+	d.UniqueID = uniqueID
+	d.AllowedPorts = p.AllowedPorts
+	d.DefaultVMSize = valueOrDefault(p.DefaultVMSize, DefaultVMSize)
+	d.DefaultLocation = valueOrDefault(p.DefaultLocation, DefaultLocation)
+	d.DefaultDiskSizeGB = p.DefaultDiskSizeGB
+	if d.DefaultDiskSizeGB == 0 {
+		d.DefaultDiskSizeGB = DefaultDiskSizeGB
+	}
+	d.ResourceGroupLocation = d.DefaultLocation
+	for key, value := range p.Tags {
+		value := value
+		d.Tags[key] = &value
+	}
+
+	for _, location := range p.Locations {
+		d.Locations = append(d.Locations, location.Location)
+		provider, err := p.provider(location)
+		if err != nil {
+			return nil, err
+		}
+		machineType := MachineResourceType(provider)
+		for _, group := range location.Machines {
+			for i := 0; i < group.Count; i++ {
+				name := fmt.Sprintf("%s%02d-vm", uniqueID, len(d.Machines)+1)
+				d.Machines = append(d.Machines, Machine{
+					ID:       name,
+					Name:     name,
+					Type:     machineType,
+					Provider: provider,
+					Location: location.Location,
+					StatusMessage: CreateStateMessage(
+						machineType,
+						AzureResourceStateNotStarted,
+						name,
+					),
+					Parameters: Parameters{
+						Count:        1,
+						Type:         group.Type,
+						Orchestrator: group.Orchestrator,
+					},
+					VMSize:       valueOrDefault(group.Type, d.DefaultVMSize),
+					DiskSizeGB:   d.DefaultDiskSizeGB,
+					ComputerName: name,
+					Orchestrator: group.Orchestrator,
+				})
+			}
+		}
+	}
+	return d, nil
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// deriveUniqueID hashes seed into a unique ID, so the same plan always gets
+// the same one. An empty seed gives an empty ID.
+func deriveUniqueID(seed string) string {
+	if seed == "" {
+		return ""
+	}
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(seed))
+	sum := h.Sum32()
+	b := make([]byte, uniqueIDLength)
+	for i := range b {
+		b[i] = alphabet[sum%uint32(len(alphabet))]
+		sum /= uint32(len(alphabet))
+	}
+	return string(b)
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validPlan() DeploymentPlan {
+	return DeploymentPlan{
+		Name:              "demo",
+		ResourceGroupName: "demo-rg",
+		Locations: []LocationPlan{
+			{Location: "eastus", Machines: []Parameters{{Count: 1, Orchestrator: true}, {Count: 2}}},
+			{Location: "westus", Machines: []Parameters{{Count: 1}}},
+		},
+	}
+}
+
+func TestDeploymentPlanValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(p *DeploymentPlan)
+		wantErr string
+	}{
+		{"valid", func(*DeploymentPlan) {}, ""},
+		{"explicit unique_id", func(p *DeploymentPlan) { p.UniqueID = "abc1" }, ""},
+		{"no orchestrator", func(p *DeploymentPlan) {
+			p.Locations[0].Machines[0].Orchestrator = false
+		}, "exactly one orchestrator is required, found 0"},
+		{"orchestrator group of two", func(p *DeploymentPlan) {
+			p.Locations[0].Machines[0].Count = 2
+		}, "exactly one orchestrator is required, found 2"},
+		{"orchestrators in two locations", func(p *DeploymentPlan) {
+			p.Locations[1].Machines[0].Orchestrator = true
+		}, "exactly one orchestrator is required, found 2"},
+		{"uppercase unique_id", func(p *DeploymentPlan) { p.UniqueID = "ABC" }, `unique_id "ABC" must be lowercase`},
+		{"unique_id with a dash", func(p *DeploymentPlan) { p.UniqueID = "ab-c" }, `unique_id "ab-c" must be lowercase`},
+		{"nothing to name machines after", func(p *DeploymentPlan) {
+			p.Name, p.ResourceGroupName = "", ""
+		}, "one of unique_id, resource_group_name or name is required"},
+		{"location with a dash", func(p *DeploymentPlan) { p.Locations[1].Location = "us-west" }, "must not contain '-'"},
+		{"duplicate location", func(p *DeploymentPlan) { p.Locations[1].Location = "eastus" }, "listed more than once"},
+		{"no locations", func(p *DeploymentPlan) { p.Locations = nil }, "at least one location is required"},
+		{"unknown provider", func(p *DeploymentPlan) { p.Provider = "Oracle" }, "Oracle"},
+		{"port out of range", func(p *DeploymentPlan) { p.AllowedPorts = []int{22, 70000} }, "allowed port 70000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := validPlan()
+			tt.change(&plan)
+			err := plan.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Validate: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("Validate passed, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func machineNames(t *testing.T, plan DeploymentPlan) []string {
+	t.Helper()
+	d, err := plan.Expand()
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	names := make([]string, len(d.Machines))
+	for i, machine := range d.Machines {
+		names[i] = machine.Name
+	}
+	return names
+}
+
+func TestDeploymentPlanExpandNaming(t *testing.T) {
+	plan := validPlan()
+	plan.UniqueID = "abc"
+	d, err := plan.Expand()
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	want := []string{"abc01-vm", "abc02-vm", "abc03-vm", "abc04-vm"}
+	if len(d.Machines) != len(want) {
+		t.Fatalf("expanded %d machines, want %d", len(d.Machines), len(want))
+	}
+	for i, machine := range d.Machines {
+		if machine.Name != want[i] {
+			t.Errorf("machine %d is %s, want %s", i, machine.Name, want[i])
+		}
+		if got := GetMachineNameFromResourceName(machine.Name + "-nic"); got != machine.Name {
+			t.Errorf("%s-nic maps back to %q", machine.Name, got)
+		}
+	}
+	if d.Machines[3].Location != "westus" {
+		t.Errorf("abc04-vm is in %s, want westus", d.Machines[3].Location)
+	}
+	if d.OrchestratorNode() == nil || d.OrchestratorNode().Name != "abc01-vm" {
+		t.Errorf("orchestrator = %v, want abc01-vm", d.OrchestratorNode())
+	}
+
+	// Machines added later, as the display does for unknown names, move the
+	// slice; the orchestrator is still the machine in it
+	for i := 0; i < 100; i++ {
+		d.Machines = append(d.Machines, Machine{Name: fmt.Sprintf("new%02d-vm", i)})
+	}
+	d.Machines[0].StatusMessage = "after the move"
+	if node := d.OrchestratorNode(); node != &d.Machines[0] || node.StatusMessage != "after the move" {
+		t.Errorf("orchestrator = %v, want the moved abc01-vm", node)
+	}
+}
+
+func TestDeploymentPlanExpandIsStable(t *testing.T) {
+	first, second := machineNames(t, validPlan()), machineNames(t, validPlan())
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expanding the same plan named machines %v then %v", first, second)
+		}
+	}
+	if !uniqueIDPattern.MatchString(strings.TrimSuffix(first[0], "01-vm")) {
+		t.Errorf("derived name %s is not a lowercase unique ID", first[0])
+	}
+
+	other := validPlan()
+	other.ResourceGroupName = "other-rg"
+	if machineNames(t, other)[0] == first[0] {
+		t.Errorf("resource groups demo-rg and other-rg both named their first machine %s", first[0])
+	}
+
+	byName := validPlan()
+	byName.ResourceGroupName = ""
+	if a, b := machineNames(t, byName), machineNames(t, byName); a[0] != b[0] {
+		t.Errorf("plan without a resource group named its machine %s then %s", a[0], b[0])
+	}
+}
+
+func TestLoadDeploymentPlan(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	plan := `
+name: demo
+resource_group_name: demo-rg
+unique_id: xyz
+locations:
+  - location: eastus
+    machines:
+      - count: 1
+        orchestrator: true
+      - count: 1
+        type: Standard_D2s_v3
+`
+	if err := os.WriteFile(path, []byte(plan), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDeploymentPlan(path)
+	if err != nil {
+		t.Fatalf("LoadDeploymentPlan: %v", err)
+	}
+	if len(d.Machines) != 2 || d.Machines[1].Name != "xyz02-vm" || d.Machines[1].VMSize != "Standard_D2s_v3" {
+		t.Errorf("machines = %+v", d.Machines)
+	}
+
+	if err := os.WriteFile(path, []byte("name: demo\nlocations: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadDeploymentPlan(path); err == nil {
+		t.Error("loaded a plan without locations")
+	}
+}
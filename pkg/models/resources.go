@@ -0,0 +1,362 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider is the cloud a machine and its resources live in
+type Provider string
+
+const (
+	ProviderAzure Provider = "Azure"
+	ProviderAWS   Provider = "AWS"
+	ProviderGCP   Provider = "GCP"
+
+	// DefaultProvider is assumed for machines and records that do not name one
+	DefaultProvider = ProviderAzure
+)
+
+// Abbreviation returns the short name shown in the table for the provider
+func (p Provider) Abbreviation() ProviderAbbreviation {
+	switch p {
+	case ProviderAzure:
+		return ProviderAbbreviationAzure
+	case ProviderAWS:
+		return ProviderAbbreviationAWS
+	case ProviderGCP:
+		return ProviderAbbreviationGCP
+	default:
+		return ProviderAbbreviationUnknown
+	}
+}
+
+// ParseProvider looks up a registered provider by name, case-insensitively.
+// An empty name is the DefaultProvider.
+func ParseProvider(name string) (Provider, error) {
+	if name == "" {
+		return DefaultProvider, nil
+	}
+	for _, provider := range Providers() {
+		if strings.EqualFold(string(provider), name) {
+			return provider, nil
+		}
+	}
+	return "", fmt.Errorf("unknown provider %q (known: %s)", name, joinProviders(Providers()))
+}
+
+// ResourceType is one kind of cloud resource, e.g. an Azure NIC or an AWS
+// EBS volume
+type ResourceType struct {
+	Provider          Provider
+	ResourceString    string
+	ShortResourceName string
+}
+
+func (r *ResourceType) GetResourceString() string {
+	return r.ResourceString
+}
+
+func (r *ResourceType) GetShortResourceName() string {
+	return r.ShortResourceName
+}
+
+// IsMachine reports whether r is the resource type that represents a machine
+// (a row in the table) for its provider
+func (r ResourceType) IsMachine() bool {
+	catalog, ok := lookupCatalog(r.Provider)
+	return ok && r.ResourceString != "" && catalog.Machine.ResourceString == r.ResourceString
+}
+
+// ProviderCatalog lists the resource types a provider knows about
+type ProviderCatalog struct {
+	// Machine is the resource type a machine itself is tracked as
+	Machine ResourceType
+	// Required are the resources every machine needs, in display order
+	Required []ResourceType
+	// Other are resource types that are recognised but not required
+	Other []ResourceType
+}
+
+// All returns every resource type in the catalog
+func (c ProviderCatalog) All() []ResourceType {
+	all := make([]ResourceType, 0, len(c.Required)+len(c.Other))
+	all = append(all, c.Required...)
+	return append(all, c.Other...)
+}
+
+var (
+	catalogMu sync.RWMutex
+	catalogs  = make(map[Provider]ProviderCatalog)
+)
+
+// RegisterProvider adds or replaces the resource catalog for a provider. The
+// Provider field of every resource type is set to provider.
+func RegisterProvider(provider Provider, catalog ProviderCatalog) {
+	catalog.Machine.Provider = provider
+	catalog.Required = withProvider(provider, catalog.Required)
+	catalog.Other = withProvider(provider, catalog.Other)
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+	catalogs[provider] = catalog
+}
+
+func withProvider(provider Provider, types []ResourceType) []ResourceType {
+	out := make([]ResourceType, len(types))
+	for i, t := range types {
+		t.Provider = provider
+		out[i] = t
+	}
+	return out
+}
+
+func lookupCatalog(provider Provider) (ProviderCatalog, bool) {
+	if provider == "" {
+		provider = DefaultProvider
+	}
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	catalog, ok := catalogs[provider]
+	return catalog, ok
+}
+
+// Providers returns the registered providers in name order
+func Providers() []Provider {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	providers := make([]Provider, 0, len(catalogs))
+	for provider := range catalogs {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
+
+func joinProviders(providers []Provider) string {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = string(provider)
+	}
+	return strings.Join(names, ", ")
+}
+
+// MachineResourceType returns the resource type machines of provider are
+// tracked as
+func MachineResourceType(provider Provider) ResourceType {
+	catalog, _ := lookupCatalog(provider)
+	return catalog.Machine
+}
+
+// RequiredResources lists the resources a machine of provider needs, in the
+// order they are displayed
+func RequiredResources(provider Provider) []ResourceType {
+	catalog, _ := lookupCatalog(provider)
+	return catalog.Required
+}
+
+// ResourceTypes returns every resource type known for provider
+func ResourceTypes(provider Provider) []ResourceType {
+	catalog, _ := lookupCatalog(provider)
+	return catalog.All()
+}
+
+// LookupResourceType finds a resource type of provider by either its full
+// resource string (e.g. Microsoft.Compute/virtualMachines) or its short
+// name (e.g. VM)
+func LookupResourceType(provider Provider, name string) ResourceType {
+	for _, r := range ResourceTypes(provider) {
+		if strings.EqualFold(r.ResourceString, name) || strings.EqualFold(r.ShortResourceName, name) {
+			return r
+		}
+	}
+	return ResourceType{}
+}
+
+// FindResourceType finds a resource type by its full resource string in any
+// provider's catalog. Resource strings are unique across providers; short
+// names are not, so they need LookupResourceType.
+func FindResourceType(resource string) ResourceType {
+	for _, provider := range Providers() {
+		for _, r := range ResourceTypes(provider) {
+			if strings.EqualFold(r.ResourceString, resource) {
+				return r
+			}
+		}
+	}
+	return ResourceType{}
+}
+
+func IsValidResource(resource string) bool {
+	return FindResourceType(resource).ResourceString != ""
+}
+
+// Azure
+
+var AzureResourceTypeNIC = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Network/networkInterfaces",
+	ShortResourceName: "NIC",
+}
+
+var AzureResourceTypeVNET = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Network/virtualNetworks",
+	ShortResourceName: "VNET",
+}
+
+var AzureResourceTypeSNET = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Network/subnets",
+	ShortResourceName: "SNET",
+}
+
+var AzureResourceTypeNSG = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Network/networkSecurityGroups",
+	ShortResourceName: "NSG",
+}
+
+var AzureResourceTypeVM = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Compute/virtualMachines",
+	ShortResourceName: "VM",
+}
+
+var AzureResourceTypeDISK = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Compute/disks",
+	ShortResourceName: "DISK",
+}
+
+var AzureResourceTypeIP = ResourceType{
+	Provider:          ProviderAzure,
+	ResourceString:    "Microsoft.Network/publicIPAddresses",
+	ShortResourceName: "IP",
+}
+
+// AWS
+
+var AWSResourceTypeEC2 = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::Instance",
+	ShortResourceName: "EC2",
+}
+
+var AWSResourceTypeVPC = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::VPC",
+	ShortResourceName: "VPC",
+}
+
+var AWSResourceTypeSubnet = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::Subnet",
+	ShortResourceName: "SNET",
+}
+
+var AWSResourceTypeSG = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::SecurityGroup",
+	ShortResourceName: "SG",
+}
+
+var AWSResourceTypeENI = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::NetworkInterface",
+	ShortResourceName: "ENI",
+}
+
+var AWSResourceTypeEBS = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::Volume",
+	ShortResourceName: "EBS",
+}
+
+var AWSResourceTypeEIP = ResourceType{
+	Provider:          ProviderAWS,
+	ResourceString:    "AWS::EC2::EIP",
+	ShortResourceName: "EIP",
+}
+
+// GCP
+
+var GCPResourceTypeInstance = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Instance",
+	ShortResourceName: "GCE",
+}
+
+var GCPResourceTypeNetwork = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Network",
+	ShortResourceName: "VPC",
+}
+
+var GCPResourceTypeSubnetwork = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Subnetwork",
+	ShortResourceName: "SNET",
+}
+
+var GCPResourceTypeFirewall = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Firewall",
+	ShortResourceName: "FW",
+}
+
+var GCPResourceTypeDisk = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Disk",
+	ShortResourceName: "DISK",
+}
+
+var GCPResourceTypeAddress = ResourceType{
+	Provider:          ProviderGCP,
+	ResourceString:    "compute.googleapis.com/Address",
+	ShortResourceName: "IP",
+}
+
+func init() {
+	RegisterProvider(ProviderAzure, ProviderCatalog{
+		Machine: AzureResourceTypeVM,
+		Required: []ResourceType{
+			AzureResourceTypeVNET,
+			AzureResourceTypeNIC,
+			AzureResourceTypeNSG,
+			AzureResourceTypeIP,
+			AzureResourceTypeDISK,
+			AzureResourceTypeSNET,
+			AzureResourceTypeVM,
+		},
+	})
+	RegisterProvider(ProviderAWS, ProviderCatalog{
+		Machine: AWSResourceTypeEC2,
+		Required: []ResourceType{
+			AWSResourceTypeVPC,
+			AWSResourceTypeSubnet,
+			AWSResourceTypeSG,
+			AWSResourceTypeENI,
+			AWSResourceTypeEBS,
+			AWSResourceTypeEC2,
+		},
+		Other: []ResourceType{
+			AWSResourceTypeEIP,
+		},
+	})
+	RegisterProvider(ProviderGCP, ProviderCatalog{
+		Machine: GCPResourceTypeInstance,
+		Required: []ResourceType{
+			GCPResourceTypeNetwork,
+			GCPResourceTypeSubnetwork,
+			GCPResourceTypeFirewall,
+			GCPResourceTypeDisk,
+			GCPResourceTypeInstance,
+		},
+		Other: []ResourceType{
+			GCPResourceTypeAddress,
+		},
+	})
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+var serviceStateNames = map[ServiceState]string{
+	ServiceStateNotStarted: "NotStarted",
+	ServiceStateCreated:    "Created",
+	ServiceStateUpdating:   "Updating",
+	ServiceStateSucceeded:  "Succeeded",
+	ServiceStateFailed:     "Failed",
+	ServiceStateUnknown:    "Unknown",
+}
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "DEBUG",
+	LogLevelInfo:  "INFO",
+	LogLevelWarn:  "WARN",
+	LogLevelError: "ERROR",
+}
+
+var azureResourceStateNames = map[AzureResourceState]string{
+	AzureResourceStateUnknown:    "Unknown",
+	AzureResourceStateNotStarted: "NotStarted",
+	AzureResourceStatePending:    "Pending",
+	AzureResourceStateRunning:    "Running",
+	AzureResourceStateFailed:     "Failed",
+	AzureResourceStateSucceeded:  "Succeeded",
+}
+
+// normalizeStateName lowercases a state name and strips separators so that
+// "NotStarted", "not_started" and "Not Started" all compare equal
+func normalizeStateName(s string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(s))
+}
+
+func (s ServiceState) String() string {
+	if name, ok := serviceStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("ServiceState(%d)", int(s))
+}
+
+// MarshalText encodes the state as its stable string name
+func (s ServiceState) MarshalText() ([]byte, error) {
+	if _, ok := serviceStateNames[s]; !ok {
+		return nil, fmt.Errorf("invalid service state: %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its string name
+func (s *ServiceState) UnmarshalText(text []byte) error {
+	state, err := ParseServiceState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// ParseServiceState converts a string name into a ServiceState
+func ParseServiceState(name string) (ServiceState, error) {
+	normalized := normalizeStateName(name)
+	for state, stateName := range serviceStateNames {
+		if normalizeStateName(stateName) == normalized {
+			return state, nil
+		}
+	}
+	return ServiceStateUnknown, fmt.Errorf("unknown service state: %q", name)
+}
+
+func (s AzureResourceState) String() string {
+	if name, ok := azureResourceStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("AzureResourceState(%d)", int(s))
+}
+
+// MarshalText encodes the state as its stable string name
+func (s AzureResourceState) MarshalText() ([]byte, error) {
+	if _, ok := azureResourceStateNames[s]; !ok {
+		return nil, fmt.Errorf("invalid azure resource state: %d", int(s))
+	}
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its string name
+func (s *AzureResourceState) UnmarshalText(text []byte) error {
+	state, err := ParseAzureResourceState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// ParseAzureResourceState converts a string name into an AzureResourceState
+func ParseAzureResourceState(name string) (AzureResourceState, error) {
+	normalized := normalizeStateName(name)
+	for state, stateName := range azureResourceStateNames {
+		if normalizeStateName(stateName) == normalized {
+			return state, nil
+		}
+	}
+	return AzureResourceStateUnknown, fmt.Errorf("unknown azure resource state: %q", name)
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
+// MarshalText encodes the level as its string name
+func (l LogLevel) MarshalText() ([]byte, error) {
+	if _, ok := logLevelNames[l]; !ok {
+		return nil, fmt.Errorf("invalid log level: %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes a level from its string name
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// ParseLogLevel converts a string name such as "warn" into a LogLevel.
+// "warning" is accepted as an alias for WARN.
+func ParseLogLevel(name string) (LogLevel, error) {
+	normalized := normalizeStateName(name)
+	if normalized == "warning" {
+		return LogLevelWarn, nil
+	}
+	for level, levelName := range logLevelNames {
+		if normalizeStateName(levelName) == normalized {
+			return level, nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level: %q", name)
+}
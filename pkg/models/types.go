@@ -17,16 +17,20 @@ const (
 )
 
 type DisplayStatus struct {
-	ID              string
-	Type            AzureResourceTypes
-	Location        string
-	StatusMessage   string
-	DetailedStatus  string
-	ElapsedTime     time.Duration
-	StartTime       time.Time
-	InstanceID      string
-	PublicIP        string
-	PrivateIP       string
+	ID             string
+	Type           ResourceType
+	ResourceState  AzureResourceState
+	Location       string
+	StatusMessage  string
+	DetailedStatus string
+	ElapsedTime    time.Duration
+	StartTime      time.Time
+	InstanceID     string
+	PublicIP       string
+	PrivateIP      string
+	// ResourceValue is what the resource holds, such as an IP's address, if
+	// the source knows it
+	ResourceValue   string
 	HighlightCycles int
 	Name            string
 	Progress        int
@@ -39,23 +43,25 @@ type DisplayStatus struct {
 
 func NewDisplayStatusWithText(
 	resourceID string,
-	resourceType AzureResourceTypes,
+	resourceType ResourceType,
 	state AzureResourceState,
 	text string,
 ) *DisplayStatus {
 	return &DisplayStatus{
-		ID:   resourceID,
-		Name: resourceID,
-		Type: resourceType,
+		ID:            resourceID,
+		Name:          resourceID,
+		Type:          resourceType,
+		ResourceState: state,
 		StatusMessage: CreateStateMessageWithText(
 			resourceType,
 			state,
 			resourceID,
 			text,
 		),
-		SSH:      ServiceStateUnknown,
-		Docker:   ServiceStateUnknown,
-		Bacalhau: ServiceStateUnknown,
+		SSH:          ServiceStateUnknown,
+		Docker:       ServiceStateUnknown,
+		CorePackages: ServiceStateUnknown,
+		Bacalhau:     ServiceStateUnknown,
 	}
 }
 
@@ -80,21 +86,29 @@ func NewDisplayVMStatus(
 func NewDisplayStatus(
 	machineName string,
 	resourceID string,
-	resourceType AzureResourceTypes,
+	resourceType ResourceType,
 	state AzureResourceState,
 ) *DisplayStatus {
 	return &DisplayStatus{
-		ID:   machineName,
-		Name: machineName,
-		Type: resourceType,
+		ID:            machineName,
+		Name:          machineName,
+		Type:          resourceType,
+		ResourceState: state,
 		StatusMessage: CreateStateMessage(
 			resourceType,
 			state,
 			resourceID,
 		),
+		SSH:          ServiceStateUnknown,
+		Docker:       ServiceStateUnknown,
+		CorePackages: ServiceStateUnknown,
+		Bacalhau:     ServiceStateUnknown,
 	}
 }
 
+// StatusCode represents the possible status codes
+type StatusCode string
+
 const (
 	StatusCodeNotStarted StatusCode = "NotStarted"
 	StatusCodeSucceeded  StatusCode = "Succeeded"
@@ -105,47 +119,35 @@ const (
 
 type TimeUpdateMsg struct{}
 
+// LogLevel is the severity of a log line. Levels are ordered from least to
+// most severe; the zero value is LogLevelInfo, so lines without a level are
+// info.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota - 1
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+// LogLineMsg carries a single line for the log pane. Machine is the name of
+// the machine the line is about, if any.
+type LogLineMsg struct {
+	Text    string
+	Machine string
+	Level   LogLevel
+	Time    time.Time
+}
+
 type AzureEvent struct {
 	Type       string
 	ResourceID string
 	Message    string
 }
 
-const (
-	DisplayTextSuccess    = "✔"
-	DisplayTextFailed     = "✘"
-	DisplayTextInProgress = "↻"
-	DisplayTextWaiting    = "↻"
-	DisplayTextCreating   = "⌃"
-	DisplayTextUnknown    = "?"
-	DisplayTextNotStarted = "┅"
-
-	DisplayEmojiSuccess    = "✅"
-	DisplayEmojiWaiting    = "⏳"
-	DisplayEmojiCreating   = "⬆️"
-	DisplayEmojiFailed     = "❌"
-	DisplayEmojiQuestion   = "❓"
-	DisplayEmojiNotStarted = "⬛️"
-
-	DisplayEmojiOrchestratorNode = "🌕"
-	DisplayEmojiWorkerNode       = "⚫️"
-
-	DisplayTextOrchestratorNode = "⏼"
-	DisplayTextWorkerNode       = " "
-
-	DisplayEmojiOrchestrator = "🤖"
-	DisplayEmojiSSH          = "🔑"
-	DisplayEmojiDocker       = "🐳"
-	DisplayEmojiBacalhau     = "🐟"
-
-	DisplayTextOrchestrator = "O"
-	DisplayTextSSH          = "S"
-	DisplayTextDocker       = "D"
-	DisplayTextBacalhau     = "B"
-)
-
 func CreateStateMessageWithText(
-	resource AzureResourceTypes,
+	resource ResourceType,
 	resourceState AzureResourceState,
 	resourceName string,
 	text string,
@@ -154,30 +156,14 @@ func CreateStateMessageWithText(
 }
 
 func CreateStateMessage(
-	resource AzureResourceTypes,
+	resource ResourceType,
 	resourceState AzureResourceState,
 	resourceName string,
 ) string {
-	stateEmoji := ""
-	switch resourceState {
-	case AzureResourceStateNotStarted:
-		stateEmoji = DisplayEmojiNotStarted
-	case AzureResourceStatePending:
-		stateEmoji = DisplayEmojiWaiting
-	case AzureResourceStateRunning:
-		stateEmoji = DisplayEmojiSuccess
-	case AzureResourceStateFailed:
-		stateEmoji = DisplayEmojiFailed
-	case AzureResourceStateSucceeded:
-		stateEmoji = DisplayEmojiSuccess
-	case AzureResourceStateUnknown:
-
-		stateEmoji = DisplayEmojiQuestion
-	}
 	return fmt.Sprintf(
 		"%s %s - %s",
 		resource.ShortResourceName,
-		stateEmoji,
+		Glyphs().Symbol(ResourceStateGlyph(resourceState)),
 		resourceName,
 	)
 }
@@ -186,9 +172,12 @@ func ConvertFromRawResourceToStatus(
 	resourceMap map[string]interface{},
 	deployment *Deployment,
 ) ([]DisplayStatus, error) {
-	resourceName := resourceMap["name"].(string)
-	resourceType := resourceMap["type"].(string)
-	resourceState := resourceMap["provisioningState"].(string)
+	resourceName, _ := resourceMap["name"].(string)
+	resourceType, _ := resourceMap["type"].(string)
+	resourceState, _ := resourceMap["provisioningState"].(string)
+	if resourceName == "" || resourceType == "" {
+		return nil, fmt.Errorf("resource is missing name or type: %v", resourceMap)
+	}
 
 	var statuses []DisplayStatus
 
@@ -223,7 +212,7 @@ func ConvertFromRawResourceToStatus(
 			resourceType,
 			resourceState,
 		) {
-			status := createStatus(resourceName, resourceName, resourceType, resourceState)
+			status := createStatus(machineName, resourceName, resourceType, resourceState)
 			statuses = append(statuses, status)
 		}
 	} else {
@@ -248,20 +237,22 @@ func GetMachineNameFromResourceName(id string) string {
 	return ""
 }
 
+// machineNeedsUpdating records the resource's state on the machine and
+// reports whether it changed. Any change counts, including a move back such
+// as Succeeded to Failed; a state ARM didn't report is not a change.
 func machineNeedsUpdating(
 	deployment *Deployment,
 	machineIndex int,
 	resourceType string,
 	resourceState string,
 ) bool {
-	currentState := ConvertFromStringToAzureResourceState(resourceState)
-
-	needsUpdate := 0
-	if deployment.Machines[machineIndex].GetResource(resourceType).ResourceState < currentState {
-		deployment.Machines[machineIndex].SetResource(resourceType, currentState)
-		needsUpdate++
+	newState := ConvertFromStringToAzureResourceState(resourceState)
+	machine := &deployment.Machines[machineIndex]
+	if newState == AzureResourceStateUnknown || machine.GetResource(resourceType).ResourceState == newState {
+		return false
 	}
-	return needsUpdate > 0
+	machine.SetResource(resourceType, newState, "")
+	return true
 }
 
 func GetMachinesInLocation(resourceName string, machines []Machine) ([]string, error) {
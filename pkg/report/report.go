@@ -0,0 +1,306 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// SchemaVersion is bumped whenever a field is renamed or removed
+const SchemaVersion = 1
+
+// Machine outcomes
+const (
+	OutcomeComplete   = "complete"
+	OutcomeFailed     = "failed"
+	OutcomeInProgress = "in_progress"
+)
+
+// Report is the machine-readable summary of a deployment
+type Report struct {
+	SchemaVersion  int             `json:"schema_version"`
+	Name           string          `json:"name,omitempty"`
+	ResourceGroup  string          `json:"resource_group,omitempty"`
+	StartTime      time.Time       `json:"start_time"`
+	EndTime        *time.Time      `json:"end_time,omitempty"`
+	ElapsedSeconds float64         `json:"elapsed_seconds"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+	Machines       []MachineReport `json:"machines"`
+}
+
+// MachineReport is the final state of one machine
+type MachineReport struct {
+	Name           string           `json:"name"`
+	Provider       string           `json:"provider"`
+	Location       string           `json:"location"`
+	PublicIP       string           `json:"public_ip"`
+	PrivateIP      string           `json:"private_ip"`
+	Role           string           `json:"role"`
+	SSH            string           `json:"ssh"`
+	Docker         string           `json:"docker"`
+	CorePackages   string           `json:"core_packages"`
+	Bacalhau       string           `json:"bacalhau"`
+	Resources      []ResourceReport `json:"resources"`
+	ElapsedSeconds float64          `json:"elapsed_seconds"`
+	Outcome        string           `json:"outcome"`
+	StatusMessage  string           `json:"status_message"`
+}
+
+// ResourceReport is the final state of one of a machine's resources
+type ResourceReport struct {
+	Type  string `json:"type"`
+	State string `json:"state"`
+}
+
+// New builds a report from d. Elapsed times run to the deployment's EndTime,
+// or to now if it has not ended.
+func New(d *models.Deployment, now time.Time) *Report {
+	end := d.EndTime
+	if end.IsZero() {
+		end = now
+	}
+
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		Name:          d.Name,
+		ResourceGroup: d.ResourceGroupName,
+		StartTime:     d.StartTime,
+		GeneratedAt:   now,
+	}
+	if !d.EndTime.IsZero() {
+		r.EndTime = &d.EndTime
+	}
+	if !d.StartTime.IsZero() {
+		r.ElapsedSeconds = end.Sub(d.StartTime).Seconds()
+	}
+
+	for i := range d.Machines {
+		r.Machines = append(r.Machines, NewMachineReport(&d.Machines[i], end))
+	}
+	return r
+}
+
+// NewMachineReport reports the state of one machine. Its elapsed time runs
+// to its own end time, or to end if it has not finished.
+func NewMachineReport(machine *models.Machine, end time.Time) MachineReport {
+	mr := MachineReport{
+		Name:          machine.Name,
+		Provider:      string(machine.GetProvider()),
+		Location:      machine.Location,
+		PublicIP:      machine.PublicIP,
+		PrivateIP:     machine.PrivateIP,
+		Role:          "worker",
+		SSH:           machine.SSH.String(),
+		Docker:        machine.Docker.String(),
+		CorePackages:  machine.CorePackages.String(),
+		Bacalhau:      machine.Bacalhau.String(),
+		Outcome:       outcome(machine),
+		StatusMessage: strings.TrimSpace(machine.StatusMessage),
+	}
+	if machine.Orchestrator {
+		mr.Role = "orchestrator"
+	}
+	if !machine.StartTime.IsZero() {
+		machineEnd := machine.EndTime
+		if machineEnd.IsZero() {
+			machineEnd = end
+		}
+		mr.ElapsedSeconds = machineEnd.Sub(machine.StartTime).Seconds()
+	}
+	for _, resourceType := range machine.RequiredResources() {
+		state := machine.GetResource(resourceType.ResourceString).ResourceState
+		if state == models.AzureResourceStateUnknown {
+			state = models.AzureResourceStateNotStarted
+		}
+		mr.Resources = append(mr.Resources, ResourceReport{
+			Type:  resourceType.ShortResourceName,
+			State: state.String(),
+		})
+	}
+	return mr
+}
+
+func outcome(machine *models.Machine) string {
+	switch {
+	case machine.Failed():
+		return OutcomeFailed
+	case machine.Complete():
+		return OutcomeComplete
+	default:
+		return OutcomeInProgress
+	}
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes one row per machine, with one column per provider and
+// resource type, e.g. azure_vm or aws_ec2. Machines from different providers
+// leave the other providers' columns empty.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(r.columns()); err != nil {
+		return err
+	}
+	for _, row := range r.rows() {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteMarkdown writes the machines as a Markdown table under a short header
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	title := r.Name
+	if title == "" {
+		title = r.ResourceGroup
+	}
+	if title == "" {
+		title = "Deployment"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", markdownEscape(title))
+	if !r.StartTime.IsZero() {
+		fmt.Fprintf(&b, "- Started: %s\n", r.StartTime.Format(time.RFC3339))
+	}
+	if r.EndTime != nil {
+		fmt.Fprintf(&b, "- Ended: %s\n", r.EndTime.Format(time.RFC3339))
+	}
+	fmt.Fprintf(&b, "- Elapsed: %s\n", formatSeconds(r.ElapsedSeconds))
+	fmt.Fprintf(&b, "- Machines: %d\n\n", len(r.Machines))
+
+	columns := r.columns()
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, row := range r.rows() {
+		for i := range row {
+			row[i] = markdownEscape(row[i])
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (r *Report) columns() []string {
+	columns := []string{
+		"name", "provider", "location", "public_ip", "private_ip", "role",
+		"ssh", "docker", "core_packages", "bacalhau",
+	}
+	for _, column := range r.resourceColumns() {
+		columns = append(columns, strings.ToLower(column.Provider+"_"+column.Type))
+	}
+	return append(columns, "elapsed_seconds", "outcome", "status_message")
+}
+
+// resourceColumn is a resource type of one provider. Short names are only
+// unique within a provider: Azure and AWS both have a SNET.
+type resourceColumn struct {
+	Provider string
+	Type     string
+}
+
+// resourceColumns returns every provider's resource types in the report, in
+// the order they first appear
+func (r *Report) resourceColumns() []resourceColumn {
+	var columns []resourceColumn
+	seen := make(map[resourceColumn]bool)
+	for _, m := range r.Machines {
+		for _, resource := range m.Resources {
+			column := resourceColumn{Provider: m.Provider, Type: resource.Type}
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	return columns
+}
+
+func (r *Report) rows() [][]string {
+	resourceColumns := r.resourceColumns()
+	rows := make([][]string, 0, len(r.Machines))
+	for _, m := range r.Machines {
+		row := []string{
+			m.Name, m.Provider, m.Location, m.PublicIP, m.PrivateIP, m.Role,
+			m.SSH, m.Docker, m.CorePackages, m.Bacalhau,
+		}
+		states := make(map[resourceColumn]string, len(m.Resources))
+		for _, resource := range m.Resources {
+			states[resourceColumn{Provider: m.Provider, Type: resource.Type}] = resource.State
+		}
+		for _, column := range resourceColumns {
+			row = append(row, states[column])
+		}
+		row = append(row,
+			strconv.FormatFloat(m.ElapsedSeconds, 'f', 1, 64),
+			m.Outcome,
+			m.StatusMessage,
+		)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Truncate(100 * time.Millisecond).String()
+}
+
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+}
+
+// CheckPath reports whether path has an extension WriteFile can write, so
+// a bad report path fails before the deployment runs rather than after
+func CheckPath(path string) error {
+	_, err := (&Report{}).writer(path)
+	return err
+}
+
+// writer returns the function that writes the report in the format given
+// by the path's extension
+func (r *Report) writer(path string) (func(io.Writer) error, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return r.WriteJSON, nil
+	case ".csv":
+		return r.WriteCSV, nil
+	case ".md", ".markdown":
+		return r.WriteMarkdown, nil
+	}
+	return nil, fmt.Errorf("unsupported report format for %s (use .json, .csv or .md)", path)
+}
+
+// WriteFile writes the report to path in the format given by the path's
+// extension: .json, .csv or .md
+func (r *Report) WriteFile(path string) error {
+	write, err := r.writer(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report %s: %w", path, err)
+	}
+	return f.Close()
+}
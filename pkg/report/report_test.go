@@ -0,0 +1,226 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testReport() *Report {
+	d := models.NewDeployment()
+	d.Name = "demo"
+	d.ResourceGroupName = "demo-rg"
+	d.StartTime = start
+	d.EndTime = start.Add(5 * time.Minute)
+
+	done := models.Machine{
+		Name:          "abc01-vm",
+		Provider:      models.ProviderAzure,
+		Location:      "eastus",
+		PublicIP:      "1.2.3.4",
+		PrivateIP:     "10.0.0.4",
+		Orchestrator:  true,
+		StartTime:     start,
+		EndTime:       start.Add(3 * time.Minute),
+		SSH:           models.ServiceStateSucceeded,
+		Docker:        models.ServiceStateSucceeded,
+		CorePackages:  models.ServiceStateSucceeded,
+		Bacalhau:      models.ServiceStateSucceeded,
+		StatusMessage: "ready | serving",
+	}
+	for _, resourceType := range done.RequiredResources() {
+		done.SetResource(resourceType.ResourceString, models.AzureResourceStateSucceeded, "")
+	}
+
+	failed := models.Machine{
+		Name:      "abc02-vm",
+		Provider:  models.ProviderAWS,
+		Location:  "useast1",
+		StartTime: start,
+		SSH:       models.ServiceStateFailed,
+	}
+	d.Machines = []models.Machine{done, failed}
+	return New(d, start.Add(10*time.Minute))
+}
+
+func TestNew(t *testing.T) {
+	r := testReport()
+	if r.ElapsedSeconds != 300 || r.EndTime == nil {
+		t.Errorf("elapsed %v, end %v; want the deployment's 5 minutes", r.ElapsedSeconds, r.EndTime)
+	}
+	done, failed := r.Machines[0], r.Machines[1]
+	if done.Outcome != OutcomeComplete || done.Role != "orchestrator" || done.ElapsedSeconds != 180 {
+		t.Errorf("finished machine = %+v", done)
+	}
+	if failed.Outcome != OutcomeFailed || failed.Role != "worker" || failed.ElapsedSeconds != 300 {
+		t.Errorf("failed machine = %+v, want it to run to the deployment's end", failed)
+	}
+	for _, resource := range failed.Resources {
+		if resource.State != models.AzureResourceStateNotStarted.String() {
+			t.Errorf("untouched resource %s is %s", resource.Type, resource.State)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	r := testReport()
+	var first bytes.Buffer
+	if err := r.WriteJSON(&first); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(first.Bytes(), &decoded); err != nil {
+		t.Fatalf("decoding the report: %v", err)
+	}
+	var second bytes.Buffer
+	if err := decoded.WriteJSON(&second); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	if first.String() != second.String() {
+		t.Errorf("report changed on a round trip:\n%s\n%s", first.String(), second.String())
+	}
+
+	if decoded.SchemaVersion != SchemaVersion || decoded.Name != "demo" || len(decoded.Machines) != 2 {
+		t.Errorf("decoded report = %+v", decoded)
+	}
+	if got := decoded.Machines[1].Resources; len(got) != len(r.Machines[1].Resources) {
+		t.Errorf("decoded resources %+v", got)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	r := testReport()
+	var b bytes.Buffer
+	if err := r.WriteCSV(&b); err != nil {
+		t.Fatalf("WriteCSV: %v", err)
+	}
+
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("reading the CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("read %d records, want a header and 2 machines", len(records))
+	}
+	header := records[0]
+	if !slices.Equal(header, r.columns()) {
+		t.Errorf("header = %v", header)
+	}
+	for i, record := range records[1:] {
+		if len(record) != len(header) {
+			t.Fatalf("row %d has %d fields for %d columns", i, len(record), len(header))
+		}
+		m := r.Machines[i]
+		field := func(column string) string { return record[slices.Index(header, column)] }
+		if field("name") != m.Name || field("provider") != m.Provider || field("outcome") != m.Outcome ||
+			field("status_message") != m.StatusMessage {
+			t.Errorf("row %d = %v, want %+v", i, record, m)
+		}
+	}
+	if got := records[1][slices.Index(header, "elapsed_seconds")]; got != "180.0" {
+		t.Errorf("elapsed_seconds = %s, want 180.0", got)
+	}
+}
+
+func TestResourceColumnsPerProvider(t *testing.T) {
+	r := testReport()
+	header := r.columns()
+	rows := r.rows()
+	for _, column := range []string{"azure_snet", "aws_snet", "azure_vm", "aws_ec2"} {
+		if !slices.Contains(header, column) {
+			t.Errorf("no %s column in %v", column, header)
+		}
+	}
+	if slices.Contains(header, "snet") {
+		t.Errorf("SNET column not split by provider: %v", header)
+	}
+
+	azureSNET, awsSNET := slices.Index(header, "azure_snet"), slices.Index(header, "aws_snet")
+	if rows[0][azureSNET] != "Succeeded" || rows[0][awsSNET] != "" {
+		t.Errorf("Azure machine's SNET columns: azure %q, aws %q", rows[0][azureSNET], rows[0][awsSNET])
+	}
+	if rows[1][awsSNET] != "NotStarted" || rows[1][azureSNET] != "" {
+		t.Errorf("AWS machine's SNET columns: aws %q, azure %q", rows[1][awsSNET], rows[1][azureSNET])
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	r := testReport()
+	var b bytes.Buffer
+	if err := r.WriteMarkdown(&b); err != nil {
+		t.Fatalf("WriteMarkdown: %v", err)
+	}
+	text := b.String()
+	if !strings.HasPrefix(text, "# demo\n") || !strings.Contains(text, "- Machines: 2\n") {
+		t.Errorf("missing header:\n%s", text)
+	}
+
+	// Split each table row on the unescaped pipes
+	var table [][]string
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "| ") || strings.HasPrefix(line, "| ---") {
+			continue
+		}
+		line = strings.TrimSuffix(strings.TrimPrefix(line, "| "), " |")
+		cells := strings.Split(strings.ReplaceAll(line, `\|`, "\x00"), " | ")
+		for i := range cells {
+			cells[i] = strings.ReplaceAll(cells[i], "\x00", "|")
+		}
+		table = append(table, cells)
+	}
+	if len(table) != 3 {
+		t.Fatalf("table has %d rows, want a header and 2 machines:\n%s", len(table), text)
+	}
+	if !slices.Equal(table[0], r.columns()) {
+		t.Errorf("header = %v", table[0])
+	}
+	if rows := r.rows(); !slices.Equal(table[1], rows[0]) || !slices.Equal(table[2], rows[1]) {
+		t.Errorf("rows = %v, want %v", table[1:], rows)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	for _, path := range []string{"out.json", "out.CSV", "dir/out.md", "out.markdown"} {
+		if err := CheckPath(path); err != nil {
+			t.Errorf("CheckPath(%q): %v", path, err)
+		}
+	}
+	for _, path := range []string{"out.txt", "out", "out.json.bak"} {
+		if err := CheckPath(path); err == nil {
+			t.Errorf("CheckPath(%q) passed", path)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	r := testReport()
+	dir := t.TempDir()
+	for _, name := range []string{"report.json", "report.csv", "report.md"} {
+		path := filepath.Join(dir, name)
+		if err := r.WriteFile(path); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+
+	path := filepath.Join(dir, "report.txt")
+	if err := r.WriteFile(path); err == nil {
+		t.Error("wrote an unsupported format")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("created %s for an unsupported format", path)
+	}
+}
@@ -0,0 +1,126 @@
+package testutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeARMResource is a resource served by FakeARMServer
+type FakeARMResource struct {
+	Name              string
+	Type              string
+	Location          string
+	ProvisioningState string
+}
+
+// FakeARMServer is a local stand-in for the Azure Resource Manager resource
+// list API, for exercising the azure poller without live Azure
+type FakeARMServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	resources  map[string][]FakeARMResource
+	throttle   int
+	retryAfter int
+	pageSize   int
+	requests   int
+}
+
+// NewFakeARMServer starts a fake ARM server. Close it when done.
+func NewFakeARMServer() *FakeARMServer {
+	f := &FakeARMServer{resources: make(map[string][]FakeARMResource)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+// SetResource adds or replaces a resource in resourceGroup
+func (f *FakeARMServer) SetResource(resourceGroup string, resource FakeARMResource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, r := range f.resources[resourceGroup] {
+		if r.Name == resource.Name {
+			f.resources[resourceGroup][i] = resource
+			return
+		}
+	}
+	f.resources[resourceGroup] = append(f.resources[resourceGroup], resource)
+}
+
+// ThrottleNext makes the next n requests fail with 429 and the given
+// Retry-After seconds
+func (f *FakeARMServer) ThrottleNext(n, retryAfterSeconds int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.throttle = n
+	f.retryAfter = retryAfterSeconds
+}
+
+// SetPageSize splits list responses into pages of size n linked by nextLink
+func (f *FakeARMServer) SetPageSize(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pageSize = n
+}
+
+// Requests returns the number of requests served so far
+func (f *FakeARMServer) Requests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests
+}
+
+func (f *FakeARMServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests++
+
+	if f.throttle > 0 {
+		f.throttle--
+		w.Header().Set("Retry-After", strconv.Itoa(f.retryAfter))
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	// /subscriptions/{sub}/resourceGroups/{rg}/resources
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 5 || parts[0] != "subscriptions" || parts[2] != "resourceGroups" || parts[4] != "resources" {
+		http.NotFound(w, r)
+		return
+	}
+	resources := f.resources[parts[3]]
+
+	start, _ := strconv.Atoi(r.URL.Query().Get("skip"))
+	end := len(resources)
+	if f.pageSize > 0 && start+f.pageSize < end {
+		end = start + f.pageSize
+	}
+	if start > end {
+		start = end
+	}
+
+	value := make([]map[string]interface{}, 0, end-start)
+	for _, res := range resources[start:end] {
+		value = append(value, map[string]interface{}{
+			"id":                fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/%s/%s", parts[1], parts[3], res.Type, res.Name),
+			"name":              res.Name,
+			"type":              res.Type,
+			"location":          res.Location,
+			"provisioningState": res.ProvisioningState,
+		})
+	}
+
+	body := map[string]interface{}{"value": value}
+	if end < len(resources) {
+		query := r.URL.Query()
+		query.Set("skip", strconv.Itoa(end))
+		body["nextLink"] = fmt.Sprintf("%s%s?%s", f.URL, r.URL.Path, query.Encode())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,215 @@
+package testutils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/spf13/viper"
+)
+
+// Latency distributions
+const (
+	DistributionFixed       = "fixed"
+	DistributionUniform     = "uniform"
+	DistributionNormal      = "normal"
+	DistributionExponential = "exponential"
+)
+
+// Failure roles
+const (
+	RoleAll          = "all"
+	RoleWorker       = "worker"
+	RoleOrchestrator = "orchestrator"
+)
+
+// Simulated service steps, run in this order once a machine's VM is up
+var serviceSteps = []string{"SSH", "Docker", "CorePackages", "Bacalhau"}
+
+// Scenario describes a simulated rollout. It is read through viper, so YAML,
+// JSON and TOML all work:
+//
+//	name: docker-flaky
+//	seed: 42
+//	provider: Azure
+//	orchestrator_first: true
+//	regions:
+//	  - region: eastus
+//	    machines: 4
+//	  - region: westus
+//	    machines: 3
+//	latencies:
+//	  default: {distribution: uniform, min: 2s, max: 6s}
+//	  vm: {distribution: normal, mean: 20s, stddev: 5s, min: 5s}
+//	  docker: {distribution: exponential, mean: 8s, max: 40s}
+//	failures:
+//	  docker: {probability: 0.1, role: worker}
+//
+// Latency and failure keys are resource short names (vnet, nic, vm, ...) or
+// service names (ssh, docker, core_packages, bacalhau). Steps without a
+// latency use "default"; "start" delays each machine's first resource.
+type Scenario struct {
+	Name              string                   `mapstructure:"name"`
+	Seed              uint64                   `mapstructure:"seed"`
+	Provider          string                   `mapstructure:"provider"`
+	UniqueID          string                   `mapstructure:"unique_id"`
+	OrchestratorFirst bool                     `mapstructure:"orchestrator_first"`
+	Regions           []RegionScenario         `mapstructure:"regions"`
+	Latencies         map[string]Latency       `mapstructure:"latencies"`
+	Failures          map[string]FailureChance `mapstructure:"failures"`
+}
+
+// RegionScenario is the number of machines to simulate in one region. The
+// first machine of the first region is the orchestrator.
+type RegionScenario struct {
+	Region   string `mapstructure:"region"`
+	Machines int    `mapstructure:"machines"`
+}
+
+// Latency is the distribution a step's duration is drawn from. Min and Max
+// clamp the drawn value when they are set.
+type Latency struct {
+	Distribution string        `mapstructure:"distribution"`
+	Mean         time.Duration `mapstructure:"mean"`
+	StdDev       time.Duration `mapstructure:"stddev"`
+	Min          time.Duration `mapstructure:"min"`
+	Max          time.Duration `mapstructure:"max"`
+}
+
+// FailureChance is the probability that a step fails, for the machines of
+// the given role (default all)
+type FailureChance struct {
+	Probability float64 `mapstructure:"probability"`
+	Role        string  `mapstructure:"role"`
+}
+
+// DefaultLatency is used for steps the scenario gives no latency for
+var DefaultLatency = Latency{Distribution: DistributionUniform, Min: 2 * time.Second, Max: 6 * time.Second}
+
+// LoadScenario reads and validates the scenario file at path
+func LoadScenario(path string) (*Scenario, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %w", err)
+	}
+
+	var scenario Scenario
+	if err := v.Unmarshal(&scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %w", err)
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+// Validate checks the scenario for values the simulator cannot run
+func (s *Scenario) Validate() error {
+	var errs []string
+
+	if _, err := models.ParseProvider(s.Provider); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(s.Regions) == 0 {
+		errs = append(errs, "at least one region is required")
+	}
+	seen := make(map[string]bool)
+	for i, region := range s.Regions {
+		switch {
+		case region.Region == "":
+			errs = append(errs, fmt.Sprintf("regions[%d]: region is required", i))
+		case strings.Contains(region.Region, "-"):
+			// Location-scoped resources are named <region>-vnet
+			errs = append(errs, fmt.Sprintf("regions[%d]: region %q must not contain '-'", i, region.Region))
+		case seen[region.Region]:
+			errs = append(errs, fmt.Sprintf("regions[%d]: region %q is listed more than once", i, region.Region))
+		}
+		seen[region.Region] = true
+		if region.Machines < 1 {
+			errs = append(errs, fmt.Sprintf("regions[%d]: machines must be at least 1", i))
+		}
+	}
+
+	for _, step := range sortedKeys(s.Latencies) {
+		if err := s.Latencies[step].validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("latencies.%s: %v", step, err))
+		}
+	}
+	for _, step := range sortedKeys(s.Failures) {
+		failure := s.Failures[step]
+		if failure.Probability < 0 || failure.Probability > 1 {
+			errs = append(errs, fmt.Sprintf("failures.%s: probability must be between 0 and 1", step))
+		}
+		switch failure.Role {
+		case "", RoleAll, RoleWorker, RoleOrchestrator:
+		default:
+			errs = append(errs, fmt.Sprintf("failures.%s: unknown role %q", step, failure.Role))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (l Latency) validate() error {
+	switch l.Distribution {
+	case DistributionFixed, DistributionNormal, DistributionExponential:
+		if l.Mean <= 0 {
+			return fmt.Errorf("%s distribution needs a positive mean", l.Distribution)
+		}
+	case DistributionUniform:
+		if l.Max <= 0 || l.Max < l.Min {
+			return fmt.Errorf("uniform distribution needs max >= min and max > 0")
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", l.Distribution)
+	}
+	if l.Min < 0 || (l.Max > 0 && l.Max < l.Min) {
+		return fmt.Errorf("min and max must be positive with max >= min")
+	}
+	return nil
+}
+
+// stepKey normalises a step name for lookups in Latencies and Failures.
+// Viper lowercases map keys, so "CorePackages", "core_packages" and
+// "corepackages" all match.
+func stepKey(step string) string {
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(step))
+}
+
+func (s *Scenario) latency(step string) Latency {
+	for key, latency := range s.Latencies {
+		if stepKey(key) == stepKey(step) {
+			return latency
+		}
+	}
+	for key, latency := range s.Latencies {
+		if stepKey(key) == "default" {
+			return latency
+		}
+	}
+	return DefaultLatency
+}
+
+func (s *Scenario) failure(step string) (FailureChance, bool) {
+	for key, failure := range s.Failures {
+		if stepKey(key) == stepKey(step) {
+			return failure, true
+		}
+	}
+	return FailureChance{}, false
+}
@@ -4,10 +4,11 @@ import (
 	"sync"
 )
 
-const logBufferSize = 10
+const logBufferSize = 100
 
 var logBuffer = make([]string, logBufferSize)
 var logBufferIndex = 0
+var logBufferTotal = 0
 var logBufferMutex sync.Mutex
 
 // GetLastLogLines returns the last logBufferSize log lines from the circular buffer
@@ -26,10 +27,29 @@ func GetLastLogLines() []string {
 	return logLines
 }
 
+// GetLogLinesSince returns the lines appended after the first seen lines, as
+// far back as the buffer still holds, along with the new total to pass on
+// the next call
+func GetLogLinesSince(seen int) ([]string, int) {
+	logBufferMutex.Lock()
+	defer logBufferMutex.Unlock()
+
+	if seen < logBufferTotal-logBufferSize {
+		seen = logBufferTotal - logBufferSize
+	}
+
+	var logLines []string
+	for seq := seen; seq < logBufferTotal; seq++ {
+		logLines = append(logLines, logBuffer[seq%logBufferSize])
+	}
+	return logLines, logBufferTotal
+}
+
 func AppendToLogBuffer(logLine string) {
 	logBufferMutex.Lock()
 	defer logBufferMutex.Unlock()
 
 	logBuffer[logBufferIndex] = logLine
 	logBufferIndex = (logBufferIndex + 1) % logBufferSize
+	logBufferTotal++
 }
@@ -0,0 +1,478 @@
+package testutils
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// SimEvent is one message of a simulated rollout, due At after the start
+type SimEvent struct {
+	At  time.Duration
+	Msg tea.Msg
+}
+
+// Simulator turns a Scenario into a timeline of status updates and log
+// lines. The same scenario and seed always give the same timeline.
+type Simulator struct {
+	scenario *Scenario
+	seed     uint64
+	rng      *rand.Rand
+	provider models.Provider
+	events   []SimEvent
+	timeline []SimEvent
+
+	machines map[string]*simMachine
+	// blocked are the workers that never started because the orchestrator
+	// failed
+	blocked []*simMachine
+}
+
+// NewSimulator returns a simulator for scenario. A seed of 0 uses the
+// scenario's own seed.
+func NewSimulator(scenario *Scenario, seed uint64) *Simulator {
+	if seed == 0 {
+		seed = scenario.Seed
+	}
+	provider, _ := models.ParseProvider(scenario.Provider)
+	return &Simulator{
+		scenario: scenario,
+		seed:     seed,
+		rng:      rand.New(rand.NewPCG(seed, seed)), //nolint:gosec
+		provider: provider,
+	}
+}
+
+// Seed returns the seed the timeline is generated from
+func (s *Simulator) Seed() uint64 {
+	return s.seed
+}
+
+// simMachine is a machine being simulated
+type simMachine struct {
+	name         string
+	region       string
+	orchestrator bool
+	// ready is when the machine's last step finished; failed is set if it
+	// stopped early
+	ready  time.Duration
+	failed bool
+	// done holds when each of the machine's steps succeeded, keyed by
+	// resource short name or service step
+	done map[string]time.Duration
+}
+
+// stepDone reports whether step had succeeded by at
+func (m *simMachine) stepDone(step string, at time.Duration) bool {
+	end, ok := m.done[step]
+	return ok && end <= at
+}
+
+// Timeline simulates the whole rollout and returns its events in order
+func (s *Simulator) Timeline() []SimEvent {
+	if s.timeline != nil {
+		return s.timeline
+	}
+	s.events = []SimEvent{}
+	s.machines = map[string]*simMachine{}
+	s.timeline = s.run()
+	return s.timeline
+}
+
+func (s *Simulator) run() []SimEvent {
+	prefix := s.scenario.UniqueID
+	if prefix == "" {
+		prefix = "sim"
+	}
+	var machines []*simMachine
+	for _, region := range s.scenario.Regions {
+		for i := 0; i < region.Machines; i++ {
+			machine := &simMachine{
+				name:         fmt.Sprintf("%s%02d-vm", prefix, len(machines)+1),
+				region:       region.Region,
+				orchestrator: len(machines) == 0,
+				done:         map[string]time.Duration{},
+			}
+			machines = append(machines, machine)
+			s.machines[machine.name] = machine
+		}
+	}
+
+	s.log(0, "", models.LogLevelInfo, fmt.Sprintf("sim: scenario %q with %d machines, seed %d",
+		s.scenario.Name, len(machines), s.seed))
+	for _, machine := range machines {
+		status := models.NewDisplayStatus(machine.name, machine.name, models.MachineResourceType(s.provider),
+			models.AzureResourceStateNotStarted)
+		status.Location = machine.region
+		status.Orchestrator = machine.orchestrator
+		s.emit(0, status)
+	}
+
+	// Location-scoped networking comes up once per region
+	networkReady := make(map[string]time.Duration)
+	for _, region := range s.scenario.Regions {
+		networkReady[region.Region] = s.runNetwork(0, region.Region)
+	}
+
+	var workersFrom time.Duration
+	if s.scenario.OrchestratorFirst && len(machines) > 0 {
+		orchestrator := machines[0]
+		s.runMachine(orchestrator, networkReady[orchestrator.region])
+		if orchestrator.failed {
+			s.log(orchestrator.ready, orchestrator.name, models.LogLevelError,
+				"sim: orchestrator failed, workers will not start")
+			s.blocked = machines[1:]
+			return s.sorted()
+		}
+		workersFrom = orchestrator.ready
+		machines = machines[1:]
+	}
+	for _, machine := range machines {
+		s.runMachine(machine, max(workersFrom, networkReady[machine.region]))
+	}
+
+	return s.sorted()
+}
+
+// locationSuffixes names the location-scoped resources, which are shared by
+// every machine in a region, as <region>-<suffix>
+var locationSuffixes = map[string]string{
+	models.AzureResourceTypeVNET.ResourceString: "vnet",
+	models.AzureResourceTypeNSG.ResourceString:  "nsg",
+}
+
+func (s *Simulator) locationScoped() []models.ResourceType {
+	var scoped []models.ResourceType
+	for _, resourceType := range models.RequiredResources(s.provider) {
+		if _, ok := locationSuffixes[resourceType.ResourceString]; ok {
+			scoped = append(scoped, resourceType)
+		}
+	}
+	return scoped
+}
+
+// runNetwork simulates a region's location-scoped resources from start and
+// returns when they are all ready, or -1 if one failed
+func (s *Simulator) runNetwork(start time.Duration, region string) time.Duration {
+	ready := start
+	for _, resourceType := range s.locationScoped() {
+		name := fmt.Sprintf("%s-%s", region, locationSuffixes[resourceType.ResourceString])
+		end, ok := s.runResource(start, nil, name, resourceType)
+		if !ok {
+			return -1
+		}
+		ready = max(ready, end)
+	}
+	return ready
+}
+
+// Retry reruns a failed or cancelled machine from at, skipping the steps
+// it had already finished by then, and returns the new events in order.
+// Retrying an orchestrator that held back the workers also starts them.
+func (s *Simulator) Retry(name string, at time.Duration) ([]SimEvent, error) {
+	s.Timeline()
+	machine, ok := s.machines[name]
+	if !ok {
+		return nil, fmt.Errorf("no simulated machine named %q", name)
+	}
+	if !machine.failed {
+		return nil, fmt.Errorf("%s has not failed", name)
+	}
+
+	saved := s.events
+	s.events = []SimEvent{}
+	defer func() { s.events = saved }()
+
+	machine.failed = false
+	s.blocked = slices.DeleteFunc(s.blocked, func(other *simMachine) bool { return other == machine })
+	s.log(at, name, models.LogLevelInfo, "sim: retrying")
+	from := at
+	if !s.networkDone(machine, at) {
+		from = s.runNetwork(at, machine.region)
+	}
+	s.runMachine(machine, from)
+	if machine.orchestrator && !machine.failed {
+		for _, worker := range s.blocked {
+			s.runMachine(worker, max(machine.ready, at))
+		}
+		s.blocked = nil
+	}
+	return s.sorted(), nil
+}
+
+// networkDone reports whether a machine's location-scoped resources had
+// succeeded by at
+func (s *Simulator) networkDone(machine *simMachine, at time.Duration) bool {
+	for _, resourceType := range s.locationScoped() {
+		if !machine.stepDone(resourceType.ShortResourceName, at) {
+			return false
+		}
+	}
+	return true
+}
+
+// Cancel stops a machine at at, forgetting the steps that would have
+// finished later, and returns the status that marks it failed
+func (s *Simulator) Cancel(name string, at time.Duration) ([]SimEvent, error) {
+	s.Timeline()
+	machine, ok := s.machines[name]
+	if !ok {
+		return nil, fmt.Errorf("no simulated machine named %q", name)
+	}
+	for step, end := range machine.done {
+		if end > at {
+			delete(machine.done, step)
+		}
+	}
+	machine.failed = true
+	machine.ready = at
+
+	saved := s.events
+	s.events = []SimEvent{}
+	defer func() { s.events = saved }()
+
+	// Fail the step that was running, so a retry picks up from there
+	vmType := models.MachineResourceType(s.provider)
+	status := models.NewDisplayStatus(name, name, vmType, models.AzureResourceStateFailed)
+	if machine.stepDone(vmType.ShortResourceName, at) {
+		status = s.serviceStatus(machine)
+		for _, step := range serviceSteps {
+			if !machine.stepDone(step, at) {
+				setService(status, step, models.ServiceStateFailed)
+				break
+			}
+		}
+	}
+	status.StatusMessage = "Cancelled"
+	s.emit(at, status)
+	s.log(at, name, models.LogLevelWarn, "sim: cancelled")
+	return s.sorted(), nil
+}
+
+// runMachine simulates one machine's resources and then its services,
+// starting no earlier than from. A negative from means its region's
+// networking failed. Steps the machine has already finished are skipped.
+func (s *Simulator) runMachine(machine *simMachine, from time.Duration) {
+	if from < 0 {
+		machine.failed = true
+		s.log(0, machine.name, models.LogLevelWarn, "sim: region networking failed, machine will not start")
+		return
+	}
+	start := from
+	if _, ok := s.scenario.Latencies["start"]; ok {
+		start += s.draw("start")
+	}
+
+	// Everything but the VM is created in parallel; the VM waits for them
+	vmType := models.MachineResourceType(s.provider)
+	vmStart := start
+	for _, resourceType := range models.RequiredResources(s.provider) {
+		if _, scoped := locationSuffixes[resourceType.ResourceString]; scoped || resourceType.IsMachine() {
+			continue
+		}
+		if machine.stepDone(resourceType.ShortResourceName, start) {
+			continue
+		}
+		name := fmt.Sprintf("%s-%s", machine.name, strings.ToLower(resourceType.ShortResourceName))
+		end, ok := s.runResource(start, machine, name, resourceType)
+		if !ok {
+			machine.ready, machine.failed = end, true
+			return
+		}
+		vmStart = max(vmStart, end)
+	}
+	if !machine.stepDone(vmType.ShortResourceName, vmStart) {
+		end, ok := s.runResource(vmStart, machine, machine.name, vmType)
+		if !ok {
+			machine.ready, machine.failed = end, true
+			return
+		}
+		vmStart = end
+	}
+	machine.ready = vmStart
+
+	s.runServices(machine)
+}
+
+// runResource simulates one resource from Pending to Succeeded or Failed and
+// returns when it finished. machine is nil for location-scoped resources.
+func (s *Simulator) runResource(
+	start time.Duration,
+	machine *simMachine,
+	resourceName string,
+	resourceType models.ResourceType,
+) (time.Duration, bool) {
+	// Location-scoped statuses are named after the resource; the display
+	// fans them out to the region's machines
+	machineName, logMachine := resourceName, ""
+	if machine != nil {
+		machineName, logMachine = machine.name, machine.name
+	}
+	step := resourceType.ShortResourceName
+
+	pending := models.NewDisplayStatus(machineName, resourceName, resourceType, models.AzureResourceStatePending)
+	s.emit(start, pending)
+
+	end := start + s.draw(step)
+	state := models.AzureResourceStateSucceeded
+	level := models.LogLevelInfo
+	if s.fails(step, machine) {
+		state = models.AzureResourceStateFailed
+		level = models.LogLevelError
+	}
+	done := models.NewDisplayStatus(machineName, resourceName, resourceType, state)
+	if machine != nil && state == models.AzureResourceStateSucceeded {
+		switch resourceType.ShortResourceName {
+		case models.AzureResourceTypeIP.ShortResourceName, models.AWSResourceTypeEIP.ShortResourceName:
+			done.PublicIP = s.ip()
+			done.ResourceValue = done.PublicIP
+		case models.AzureResourceTypeNIC.ShortResourceName, models.AWSResourceTypeENI.ShortResourceName:
+			done.PrivateIP = s.ip()
+			done.ResourceValue = done.PrivateIP
+		}
+	}
+	s.emit(end, done)
+	if state == models.AzureResourceStateSucceeded {
+		s.markDone(machine, resourceName, step, end)
+	}
+	s.log(end, logMachine, level, fmt.Sprintf("%s %s: %s after %s", step, resourceName, state, (end-start).Round(time.Millisecond)))
+	return end, state == models.AzureResourceStateSucceeded
+}
+
+// runServices runs the service steps in order. Each step starts the moment
+// the previous one succeeds, in the same status update.
+func (s *Simulator) runServices(machine *simMachine) {
+	now := machine.ready
+	first := 0
+	for first < len(serviceSteps) && machine.stepDone(serviceSteps[first], now) {
+		first++
+	}
+	if first == len(serviceSteps) {
+		return
+	}
+	status := s.serviceStatus(machine)
+	setService(status, serviceSteps[first], models.ServiceStateUpdating)
+	s.emit(now, status)
+
+	for i := first; i < len(serviceSteps); i++ {
+		step := serviceSteps[i]
+		started := now
+		now += s.draw(step)
+		status := s.serviceStatus(machine)
+		if s.fails(step, machine) {
+			setService(status, step, models.ServiceStateFailed)
+			s.emit(now, status)
+			s.log(now, machine.name, models.LogLevelError, fmt.Sprintf("%s failed after %s", step, (now-started).Round(time.Millisecond)))
+			machine.ready, machine.failed = now, true
+			return
+		}
+		setService(status, step, models.ServiceStateSucceeded)
+		machine.done[step] = now
+		if i+1 < len(serviceSteps) {
+			setService(status, serviceSteps[i+1], models.ServiceStateUpdating)
+		}
+		s.emit(now, status)
+		s.log(now, machine.name, models.LogLevelInfo, fmt.Sprintf("%s ready after %s", step, (now-started).Round(time.Millisecond)))
+	}
+	machine.ready = now
+}
+
+// markDone records that a resource succeeded at end. Location-scoped
+// resources count for every machine in their region.
+func (s *Simulator) markDone(machine *simMachine, resourceName, step string, end time.Duration) {
+	if machine != nil {
+		machine.done[step] = end
+		return
+	}
+	for _, other := range s.machines {
+		if strings.HasPrefix(resourceName, other.region+"-") {
+			if _, ok := other.done[step]; !ok {
+				other.done[step] = end
+			}
+		}
+	}
+}
+
+func (s *Simulator) serviceStatus(machine *simMachine) *models.DisplayStatus {
+	return models.NewDisplayStatus(machine.name, machine.name, models.MachineResourceType(s.provider),
+		models.AzureResourceStateSucceeded)
+}
+
+func setService(status *models.DisplayStatus, step string, state models.ServiceState) {
+	switch step {
+	case "SSH":
+		status.SSH = state
+	case "Docker":
+		status.Docker = state
+	case "CorePackages":
+		status.CorePackages = state
+	case "Bacalhau":
+		status.Bacalhau = state
+	}
+	status.StatusMessage = fmt.Sprintf("%s %s", step, state)
+}
+
+// fails rolls for a failure of step on machine
+func (s *Simulator) fails(step string, machine *simMachine) bool {
+	failure, ok := s.scenario.failure(step)
+	if !ok || failure.Probability == 0 {
+		return false
+	}
+	switch failure.Role {
+	case RoleWorker:
+		if machine == nil || machine.orchestrator {
+			return false
+		}
+	case RoleOrchestrator:
+		if machine == nil || !machine.orchestrator {
+			return false
+		}
+	}
+	return s.rng.Float64() < failure.Probability
+}
+
+// draw samples the duration of step from its latency distribution
+func (s *Simulator) draw(step string) time.Duration {
+	l := s.scenario.latency(step)
+	var d time.Duration
+	switch l.Distribution {
+	case DistributionFixed:
+		d = l.Mean
+	case DistributionNormal:
+		d = l.Mean + time.Duration(s.rng.NormFloat64()*float64(l.StdDev))
+	case DistributionExponential:
+		d = time.Duration(s.rng.ExpFloat64() * float64(l.Mean))
+	default:
+		d = l.Min + time.Duration(s.rng.Float64()*float64(l.Max-l.Min))
+	}
+	d = max(d, l.Min)
+	if l.Max > 0 {
+		d = min(d, l.Max)
+	}
+	return max(d, 0).Round(time.Millisecond)
+}
+
+func (s *Simulator) ip() string {
+	return fmt.Sprintf("%d.%d.%d.%d", s.rng.IntN(256), s.rng.IntN(256), s.rng.IntN(256), s.rng.IntN(256)) //nolint:gomnd
+}
+
+func (s *Simulator) emit(at time.Duration, status *models.DisplayStatus) {
+	s.events = append(s.events, SimEvent{At: at, Msg: models.StatusUpdateMsg{Status: status}})
+}
+
+func (s *Simulator) log(at time.Duration, machine string, level models.LogLevel, text string) {
+	s.events = append(s.events, SimEvent{At: at, Msg: models.LogLineMsg{Text: text, Machine: machine, Level: level}})
+}
+
+// sorted orders the events by time, keeping generation order for ties so
+// a machine's Pending always comes before its result
+func (s *Simulator) sorted() []SimEvent {
+	sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].At < s.events[j].At })
+	return s.events
+}
@@ -0,0 +1,299 @@
+package testutils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+// testScenario draws from every distribution and fails some steps, so the
+// seed decides durations, IPs and which machines fail
+func testScenario() *Scenario {
+	return &Scenario{
+		Name:              "determinism",
+		Seed:              42,
+		OrchestratorFirst: true,
+		Regions: []RegionScenario{
+			{Region: "eastus", Machines: 3},
+			{Region: "westus", Machines: 2},
+		},
+		Latencies: map[string]Latency{
+			"default": {Distribution: DistributionUniform, Min: time.Second, Max: 5 * time.Second},
+			"vm":      {Distribution: DistributionNormal, Mean: 20 * time.Second, StdDev: 5 * time.Second, Min: 5 * time.Second},
+			"docker":  {Distribution: DistributionExponential, Mean: 8 * time.Second, Max: 40 * time.Second},
+		},
+		Failures: map[string]FailureChance{
+			"docker": {Probability: 0.3, Role: RoleWorker},
+		},
+	}
+}
+
+// fixedScenario takes a second for every step, so the timeline is decided
+// by the scenario's structure alone
+func fixedScenario(failures map[string]FailureChance) *Scenario {
+	return &Scenario{
+		Name:              "fixed",
+		OrchestratorFirst: true,
+		Regions:           []RegionScenario{{Region: "eastus", Machines: 2}, {Region: "westus", Machines: 1}},
+		Latencies:         map[string]Latency{"default": {Distribution: DistributionFixed, Mean: time.Second}},
+		Failures:          failures,
+	}
+}
+
+func TestSimulatorSeed(t *testing.T) {
+	seven := NewSimulator(testScenario(), 7).Timeline()
+	if len(seven) == 0 {
+		t.Fatal("empty timeline")
+	}
+	tests := []struct {
+		name string
+		seed uint64
+		same bool
+	}{
+		{"same seed", 7, true},
+		{"different seed", 8, false},
+	}
+	for _, tt := range tests {
+		if same := reflect.DeepEqual(seven, NewSimulator(testScenario(), tt.seed).Timeline()); same != tt.same {
+			t.Errorf("%s: seed %d matching seed 7 is %v, want %v", tt.name, tt.seed, same, tt.same)
+		}
+	}
+
+	sim := NewSimulator(testScenario(), 0)
+	if sim.Seed() != 42 {
+		t.Errorf("seed = %d, want the scenario's 42", sim.Seed())
+	}
+}
+
+func TestSimulatorTimelineIsOrdered(t *testing.T) {
+	timeline := NewSimulator(testScenario(), 7).Timeline()
+	for i := 1; i < len(timeline); i++ {
+		if timeline[i].At < timeline[i-1].At {
+			t.Fatalf("event %d at %s comes after one at %s", i, timeline[i].At, timeline[i-1].At)
+		}
+	}
+}
+
+// firstStatus is when the first status for machine matching match was due,
+// or -1 if there was none
+func firstStatus(events []SimEvent, machine string, match func(*models.DisplayStatus) bool) time.Duration {
+	for _, event := range events {
+		update, ok := event.Msg.(models.StatusUpdateMsg)
+		if ok && update.Status.Name == machine && match(update.Status) {
+			return event.At
+		}
+	}
+	return -1
+}
+
+func started(status *models.DisplayStatus) bool {
+	return status.ResourceState == models.AzureResourceStatePending
+}
+
+func bacalhau(state models.ServiceState) func(*models.DisplayStatus) bool {
+	return func(status *models.DisplayStatus) bool { return status.Bacalhau == state }
+}
+
+func docker(state models.ServiceState) func(*models.DisplayStatus) bool {
+	return func(status *models.DisplayStatus) bool { return status.Docker == state }
+}
+
+func TestSimulatorOrchestratorFirst(t *testing.T) {
+	timeline := NewSimulator(fixedScenario(nil), 1).Timeline()
+	ready := firstStatus(timeline, "sim01-vm", bacalhau(models.ServiceStateSucceeded))
+	if ready < 0 {
+		t.Fatal("the orchestrator never finished")
+	}
+	for _, worker := range []string{"sim02-vm", "sim03-vm"} {
+		if start := firstStatus(timeline, worker, started); start < ready {
+			t.Errorf("%s started at %s, before the orchestrator was ready at %s", worker, start, ready)
+		}
+	}
+
+	// Without the flag everyone starts together
+	scenario := fixedScenario(nil)
+	scenario.OrchestratorFirst = false
+	timeline = NewSimulator(scenario, 1).Timeline()
+	if start := firstStatus(timeline, "sim02-vm", started); start < 0 || start >= ready {
+		t.Errorf("sim02-vm started at %s, want it alongside the orchestrator", start)
+	}
+}
+
+func TestSimulatorFailureRoles(t *testing.T) {
+	t.Run("worker", func(t *testing.T) {
+		timeline := NewSimulator(fixedScenario(map[string]FailureChance{
+			"docker": {Probability: 1, Role: RoleWorker},
+		}), 1).Timeline()
+		if firstStatus(timeline, "sim01-vm", docker(models.ServiceStateSucceeded)) < 0 {
+			t.Error("the orchestrator's docker failed")
+		}
+		for _, worker := range []string{"sim02-vm", "sim03-vm"} {
+			if firstStatus(timeline, worker, docker(models.ServiceStateFailed)) < 0 {
+				t.Errorf("%s's docker didn't fail", worker)
+			}
+		}
+	})
+
+	t.Run("orchestrator", func(t *testing.T) {
+		timeline := NewSimulator(fixedScenario(map[string]FailureChance{
+			"docker": {Probability: 1, Role: RoleOrchestrator},
+		}), 1).Timeline()
+		if firstStatus(timeline, "sim01-vm", docker(models.ServiceStateFailed)) < 0 {
+			t.Error("the orchestrator's docker didn't fail")
+		}
+		// The workers wait for an orchestrator that never comes up
+		for _, worker := range []string{"sim02-vm", "sim03-vm"} {
+			if start := firstStatus(timeline, worker, started); start >= 0 {
+				t.Errorf("%s started at %s without an orchestrator", worker, start)
+			}
+		}
+	})
+}
+
+func TestSimulatorCancelAndRetry(t *testing.T) {
+	sim := NewSimulator(fixedScenario(nil), 1)
+	timeline := sim.Timeline()
+	dockerUp := firstStatus(timeline, "sim02-vm", docker(models.ServiceStateUpdating))
+	if dockerUp < 0 {
+		t.Fatal("sim02-vm never installed docker")
+	}
+
+	if _, err := sim.Retry("sim02-vm", dockerUp); err == nil || !strings.Contains(err.Error(), "has not failed") {
+		t.Errorf("retrying a running machine: %v", err)
+	}
+
+	events, err := sim.Cancel("sim02-vm", dockerUp)
+	if err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	cancelled := firstStatus(events, "sim02-vm", docker(models.ServiceStateFailed))
+	if cancelled != dockerUp {
+		t.Errorf("cancel failed docker at %s, want %s", cancelled, dockerUp)
+	}
+
+	// A retry picks up at the step that was cancelled
+	later := dockerUp + time.Minute
+	events, err = sim.Retry("sim02-vm", later)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if start := firstStatus(events, "sim02-vm", started); start >= 0 {
+		t.Errorf("the retry recreated resources at %s", start)
+	}
+	if up := firstStatus(events, "sim02-vm", docker(models.ServiceStateUpdating)); up != later {
+		t.Errorf("the retry started docker at %s, want %s", up, later)
+	}
+	if firstStatus(events, "sim02-vm", bacalhau(models.ServiceStateSucceeded)) < later {
+		t.Error("the retry didn't finish the machine")
+	}
+	for _, event := range events {
+		if update, ok := event.Msg.(models.StatusUpdateMsg); ok && update.Status.Name != "sim02-vm" {
+			t.Errorf("the retry touched %s", update.Status.Name)
+		}
+	}
+
+	for _, act := range []func(string, time.Duration) ([]SimEvent, error){sim.Retry, sim.Cancel} {
+		if _, err := act("nobody", 0); err == nil {
+			t.Error("acted on a machine that doesn't exist")
+		}
+	}
+}
+
+func TestSimulatorRetryOrchestratorStartsWorkers(t *testing.T) {
+	scenario := fixedScenario(map[string]FailureChance{"docker": {Probability: 1, Role: RoleOrchestrator}})
+	sim := NewSimulator(scenario, 1)
+	sim.Timeline()
+	// The retry fails docker again, so let it succeed this time
+	delete(scenario.Failures, "docker")
+
+	events, err := sim.Retry("sim01-vm", time.Hour)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	ready := firstStatus(events, "sim01-vm", bacalhau(models.ServiceStateSucceeded))
+	for _, worker := range []string{"sim02-vm", "sim03-vm"} {
+		if start := firstStatus(events, worker, started); start < ready || ready < 0 {
+			t.Errorf("%s started at %s, want it after the orchestrator at %s", worker, start, ready)
+		}
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(`
+name: docker-flaky
+seed: 42
+orchestrator_first: true
+regions:
+  - region: eastus
+    machines: 2
+latencies:
+  default: {distribution: uniform, min: 2s, max: 6s}
+  core_packages: {distribution: fixed, mean: 3s}
+failures:
+  docker: {probability: 0.1, role: worker}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadScenario(path)
+	if err != nil {
+		t.Fatalf("LoadScenario: %v", err)
+	}
+	if scenario.Seed != 42 || !scenario.OrchestratorFirst || len(scenario.Regions) != 1 || scenario.Regions[0].Machines != 2 {
+		t.Errorf("scenario = %+v", scenario)
+	}
+	if got := scenario.latency("CorePackages"); got.Mean != 3*time.Second {
+		t.Errorf("CorePackages latency %+v, want the core_packages entry", got)
+	}
+	if got := scenario.latency("VM"); got.Max != 6*time.Second {
+		t.Errorf("VM latency %+v, want the default", got)
+	}
+	if failure, ok := scenario.failure("Docker"); !ok || failure.Role != RoleWorker {
+		t.Errorf("Docker failure %+v, want the worker-only entry", failure)
+	}
+
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loaded a scenario that doesn't exist")
+	}
+}
+
+func TestScenarioValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(s *Scenario)
+		wantErr string
+	}{
+		{"valid", func(*Scenario) {}, ""},
+		{"provider", func(s *Scenario) { s.Provider = "oracle" }, `unknown provider "oracle"`},
+		{"no regions", func(s *Scenario) { s.Regions = nil }, "at least one region"},
+		{"unnamed region", func(s *Scenario) { s.Regions[0].Region = "" }, "regions[0]: region is required"},
+		{"dashed region", func(s *Scenario) { s.Regions[0].Region = "us-east" }, "must not contain '-'"},
+		{"repeated region", func(s *Scenario) { s.Regions[1].Region = "eastus" }, "listed more than once"},
+		{"no machines", func(s *Scenario) { s.Regions[1].Machines = 0 }, "regions[1]: machines must be at least 1"},
+		{"distribution", func(s *Scenario) { s.Latencies["vm"] = Latency{Distribution: "zipf"} }, `latencies.vm: unknown distribution "zipf"`},
+		{"no mean", func(s *Scenario) { s.Latencies["vm"] = Latency{Distribution: DistributionNormal} }, "needs a positive mean"},
+		{"uniform range", func(s *Scenario) {
+			s.Latencies["vm"] = Latency{Distribution: DistributionUniform, Min: 5 * time.Second, Max: time.Second}
+		}, "max >= min"},
+		{"probability", func(s *Scenario) { s.Failures["docker"] = FailureChance{Probability: 1.5} }, "between 0 and 1"},
+		{"role", func(s *Scenario) { s.Failures["docker"] = FailureChance{Role: "intern"} }, `unknown role "intern"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario := testScenario()
+			tt.change(scenario)
+			err := scenario.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
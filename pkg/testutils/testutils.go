@@ -4,18 +4,15 @@ import (
 	"context"
 	"fmt"
 	"math/rand/v2"
-	"os"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/aronchick/bubble-tea-experiment/pkg/logger"
 	"github.com/aronchick/bubble-tea-experiment/pkg/models"
 )
 
-var (
-	logMutex sync.Mutex
-	logFile  *os.File
-)
+// demoLog receives the generated log entries as well as the log buffer
+var demoLog = logger.Component("demo")
 
 var words = []string{
 	"Deploying", "Configuring", "Initializing", "Updating", "Processing",
@@ -52,27 +49,8 @@ func GenerateRandomLogEntry() string {
 }
 
 func WriteLogEntry(entry string) {
-	logMutex.Lock()
-	defer logMutex.Unlock()
-
-	if logFile != nil {
-		fmt.Fprintln(logFile, entry)
-	}
-}
-
-func InitLogFile(filePath string) error {
-	var err error
-	logFile, err = os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %v", err)
-	}
-	return nil
-}
-
-func CloseLogFile() {
-	if logFile != nil {
-		logFile.Close()
-	}
+	demoLog.Debug(entry)
+	AppendToLogBuffer(entry)
 }
 
 func CreateRandomStatus() *models.DisplayStatus {
@@ -155,13 +133,7 @@ func RandomIP() string {
 	)
 }
 
-func StartLogGenerator(ctx context.Context, logFilePath string) {
-	if err := InitLogFile(logFilePath); err != nil {
-		fmt.Fprintf(os.Stderr, "Error initializing log file: %v\n", err)
-		return
-	}
-	defer CloseLogFile()
-
+func StartLogGenerator(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Post-SSH setup: once a machine's SSH is up, Docker and then the core
+// packages are installed. Each step runs as a tea.Cmd and reports back with a
+// setupStepMsg, so machines are only ever changed from Update.
+
+type setupStep int
+
+const (
+	setupStepDocker setupStep = iota
+	setupStepCorePackages
+)
+
+// setupStepMsg is the result of one setup step on a machine
+type setupStepMsg struct {
+	machine string
+	step    setupStep
+	state   models.ServiceState
+}
+
+// runSetupStep returns the command that performs step on the named machine
+func runSetupStep(machine string, step setupStep) tea.Cmd {
+	return func() tea.Msg {
+		// The installs are simulated and always succeed
+		return setupStepMsg{machine: machine, step: step, state: models.ServiceStateSucceeded}
+	}
+}
+
+// startSetup begins the setup steps on a machine whose SSH has come up,
+// unless its event source is already reporting Docker itself
+func startSetup(machine *models.Machine) tea.Cmd {
+	if machine.Docker != models.ServiceStateNotStarted {
+		return nil
+	}
+	machine.Docker = models.ServiceStateUpdating
+	return runSetupStep(machine.Name, setupStepDocker)
+}
+
+// handleSetupStep records the result of a setup step and returns the command
+// for the next one. Results for a step the event source has since reported
+// on are dropped.
+func (m *DisplayModel) handleSetupStep(msg setupStepMsg) tea.Cmd {
+	index, err := models.GetMachineIndexByName(msg.machine, m.Deployment.Machines)
+	if err != nil {
+		return nil
+	}
+	machine := &m.Deployment.Machines[index]
+
+	var cmd tea.Cmd
+	switch msg.step {
+	case setupStepDocker:
+		if machine.Docker != models.ServiceStateUpdating {
+			return nil
+		}
+		machine.Docker = msg.state
+		if msg.state == models.ServiceStateSucceeded && machine.CorePackages == models.ServiceStateNotStarted {
+			machine.CorePackages = models.ServiceStateUpdating
+			cmd = runSetupStep(machine.Name, setupStepCorePackages)
+		}
+	case setupStepCorePackages:
+		if machine.CorePackages != models.ServiceStateUpdating {
+			return nil
+		}
+		machine.CorePackages = msg.state
+	}
+	m.markFinished()
+	m.publish(nil, machine)
+	return cmd
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// untilModel runs a DisplayModel until done reports that it has seen
+// everything the test sent, then quits
+type untilModel struct {
+	*DisplayModel
+	done func(m *DisplayModel) bool
+}
+
+func (u untilModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	_, cmd := u.DisplayModel.Update(msg)
+	if u.done(u.DisplayModel) {
+		return u, tea.Quit
+	}
+	return u, cmd
+}
+
+// runProgram starts a headless program around m and returns it with a
+// function that waits for it to end and returns the final model
+func runProgram(t *testing.T, m *DisplayModel, done func(m *DisplayModel) bool) (*tea.Program, func() *DisplayModel) {
+	t.Helper()
+	p := tea.NewProgram(untilModel{DisplayModel: m, done: done},
+		tea.WithInput(nil), tea.WithOutput(io.Discard), tea.WithoutRenderer(), tea.WithoutSignalHandler())
+
+	result := make(chan tea.Model, 1)
+	go func() {
+		final, err := p.Run()
+		if err != nil {
+			t.Errorf("Run: %v", err)
+		}
+		result <- final
+	}()
+
+	return p, func() *DisplayModel {
+		select {
+		case final := <-result:
+			return final.(untilModel).DisplayModel
+		case <-time.After(10 * time.Second):
+			p.Quit()
+			<-result
+			t.Fatal("the program didn't see every message")
+			return nil
+		}
+	}
+}
+
+func setUp(m *DisplayModel) bool {
+	for _, machine := range m.Deployment.Machines {
+		if machine.CorePackages != models.ServiceStateSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+func TestConcurrentSendersReachEveryMachine(t *testing.T) {
+	const producers, machinesEach, logsEach = 8, 3, 20
+	done := func(m *DisplayModel) bool {
+		return len(m.Deployment.Machines) == producers*machinesEach &&
+			m.Logs.Lines() == producers*logsEach && setUp(m)
+	}
+	p, wait := runProgram(t, InitialModel(), done)
+
+	// Every producer creates its own machines, brings their SSH up and logs
+	// about them, all at once
+	var wg sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		wg.Add(1)
+		go func(producer int) {
+			defer wg.Done()
+			for j := 0; j < machinesEach; j++ {
+				name := fmt.Sprintf("p%dm%d-vm", producer, j)
+				p.Send(models.StatusUpdateMsg{Status: models.NewDisplayVMStatus(name, models.AzureResourceStatePending)})
+				p.Send(models.StatusUpdateMsg{Status: models.NewDisplayVMStatus(name, models.AzureResourceStateSucceeded)})
+				ssh := models.NewDisplayVMStatus(name, models.AzureResourceStateSucceeded)
+				ssh.SSH = models.ServiceStateSucceeded
+				p.Send(models.StatusUpdateMsg{Status: ssh})
+			}
+			for j := 0; j < logsEach; j++ {
+				p.Send(models.LogLineMsg{
+					Text:    fmt.Sprintf("line %d", j),
+					Machine: fmt.Sprintf("p%dm%d-vm", producer, j%machinesEach),
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	m := wait()
+	if len(m.Deployment.Machines) != producers*machinesEach {
+		t.Fatalf("%d machines, want %d", len(m.Deployment.Machines), producers*machinesEach)
+	}
+	seen := map[string]bool{}
+	for _, machine := range m.Deployment.Machines {
+		if seen[machine.Name] {
+			t.Errorf("%s added twice", machine.Name)
+		}
+		seen[machine.Name] = true
+		if machine.SSH != models.ServiceStateSucceeded || machine.Docker != models.ServiceStateSucceeded ||
+			machine.CorePackages != models.ServiceStateSucceeded {
+			t.Errorf("%s: SSH %v, Docker %v, core packages %v", machine.Name, machine.SSH, machine.Docker, machine.CorePackages)
+		}
+	}
+	if m.Logs.Lines() != producers*logsEach {
+		t.Errorf("%d log lines, want %d", m.Logs.Lines(), producers*logsEach)
+	}
+}
+
+func TestSetupStepsRunInOrder(t *testing.T) {
+	m := InitialModel()
+	ssh := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	ssh.SSH = models.ServiceStateSucceeded
+
+	// Drive the chain by hand, checking the machine after each step
+	cmd := m.UpdateStatus(ssh)
+	machine := &m.Deployment.Machines[0]
+	if machine.Docker != models.ServiceStateUpdating || machine.CorePackages != models.ServiceStateNotStarted {
+		t.Fatalf("after SSH: Docker %v, core packages %v", machine.Docker, machine.CorePackages)
+	}
+	msg, ok := cmd().(setupStepMsg)
+	if !ok || msg.step != setupStepDocker {
+		t.Fatalf("first step = %+v, want Docker", msg)
+	}
+
+	cmd = m.handleSetupStep(msg)
+	if machine.Docker != models.ServiceStateSucceeded || machine.CorePackages != models.ServiceStateUpdating {
+		t.Fatalf("after Docker: Docker %v, core packages %v", machine.Docker, machine.CorePackages)
+	}
+	msg, ok = cmd().(setupStepMsg)
+	if !ok || msg.step != setupStepCorePackages {
+		t.Fatalf("second step = %+v, want core packages", msg)
+	}
+
+	if cmd = m.handleSetupStep(msg); cmd != nil {
+		t.Error("a step followed core packages")
+	}
+	if machine.CorePackages != models.ServiceStateSucceeded {
+		t.Errorf("core packages %v, want succeeded", machine.CorePackages)
+	}
+
+	// SSH coming up again doesn't restart finished setup
+	if cmd := m.UpdateStatus(ssh); cmd != nil {
+		t.Error("setup restarted on a machine that was already set up")
+	}
+}
+
+func TestSetupStepYieldsToTheEventSource(t *testing.T) {
+	m := InitialModel()
+	ssh := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	ssh.SSH = models.ServiceStateSucceeded
+	cmd := m.UpdateStatus(ssh)
+
+	// The source reports Docker failing before the simulated install returns
+	docker := models.NewDisplayVMStatus("abc01-vm", models.AzureResourceStateSucceeded)
+	docker.Docker = models.ServiceStateFailed
+	m.UpdateStatus(docker)
+
+	if next := m.handleSetupStep(cmd().(setupStepMsg)); next != nil {
+		t.Error("a stale Docker result started core packages")
+	}
+	machine := m.Deployment.Machines[0]
+	if machine.Docker != models.ServiceStateFailed || machine.CorePackages != models.ServiceStateNotStarted {
+		t.Errorf("Docker %v, core packages %v, want the source's failure to stand", machine.Docker, machine.CorePackages)
+	}
+}
+
+func TestSetupChainThroughProgram(t *testing.T) {
+	m := InitialModel()
+	p, wait := runProgram(t, m, func(m *DisplayModel) bool {
+		return len(m.Deployment.Machines) == 3 && setUp(m)
+	})
+	for _, name := range []string{"abc01-vm", "abc02-vm", "abc03-vm"} {
+		ssh := models.NewDisplayVMStatus(name, models.AzureResourceStateSucceeded)
+		ssh.SSH = models.ServiceStateSucceeded
+		p.Send(models.StatusUpdateMsg{Status: ssh})
+	}
+
+	for _, machine := range wait().Deployment.Machines {
+		if machine.Docker != models.ServiceStateSucceeded || machine.CorePackages != models.ServiceStateSucceeded {
+			t.Errorf("%s: Docker %v, core packages %v", machine.Name, machine.Docker, machine.CorePackages)
+		}
+	}
+}
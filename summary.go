@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// deploymentSummary is the fleet-wide progress shown above the table
+type deploymentSummary struct {
+	machines, complete, failed, inProgress int
+	resourcesDone, resourcesTotal          int
+	ssh, docker, bacalhau                  int
+	elapsed                                time.Duration
+	// eta is the estimated time until every machine has finished; valid
+	// is false until a machine has completed to extrapolate from
+	eta      time.Duration
+	etaValid bool
+	finished bool
+}
+
+// summarize counts the deployment's machines, resources and services. The
+// ETA assumes machines run in parallel and each takes as long as the
+// completed machines did on average, so it is the longest time any
+// unfinished machine still has to go.
+func summarize(d *models.Deployment, now time.Time) deploymentSummary {
+	s := deploymentSummary{finished: !d.EndTime.IsZero()}
+	if !d.StartTime.IsZero() {
+		end := d.EndTime
+		if end.IsZero() {
+			end = now
+		}
+		s.elapsed = end.Sub(d.StartTime)
+	}
+
+	var completedTotal time.Duration
+	var unfinished []*models.Machine
+	for i := range d.Machines {
+		machine := &d.Machines[i]
+		if machine.Name == "" {
+			continue
+		}
+		s.machines++
+		switch {
+		case machine.Failed():
+			s.failed++
+		case machine.Complete():
+			s.complete++
+			if !machine.StartTime.IsZero() && !machine.EndTime.IsZero() {
+				completedTotal += machine.EndTime.Sub(machine.StartTime)
+			}
+		default:
+			s.inProgress++
+			unfinished = append(unfinished, machine)
+		}
+
+		done, total := machine.ResourcesComplete()
+		s.resourcesDone += done
+		s.resourcesTotal += total
+		for _, service := range []struct {
+			state models.ServiceState
+			count *int
+		}{
+			{machine.SSH, &s.ssh},
+			{machine.Docker, &s.docker},
+			{machine.Bacalhau, &s.bacalhau},
+		} {
+			if service.state == models.ServiceStateSucceeded {
+				*service.count++
+			}
+		}
+	}
+
+	if s.finished || s.complete == 0 {
+		return s
+	}
+	average := completedTotal / time.Duration(s.complete)
+	s.etaValid = true
+	for _, machine := range unfinished {
+		remaining := average
+		if !machine.StartTime.IsZero() {
+			remaining -= now.Sub(machine.StartTime)
+		}
+		s.eta = max(s.eta, remaining)
+	}
+	return s
+}
+
+// renderSummary is the one-line deployment summary above the table
+func (m *DisplayModel) renderSummary() string {
+	s := summarize(m.Deployment, time.Now())
+
+	eta := "ETA --"
+	switch {
+	case s.finished:
+		eta = "finished " + m.Deployment.EndTime.Format("15:04:05")
+	case s.etaValid:
+		eta = "ETA " + strings.TrimSpace(formatElapsedTime(s.eta))
+	}
+	parts := []string{
+		fmt.Sprintf("Machines %d: %s%d %s%d %s%d",
+			s.machines,
+			symbol(models.GlyphSucceeded), s.complete,
+			symbol(models.GlyphWaiting), s.inProgress,
+			symbol(models.GlyphFailed), s.failed),
+		fmt.Sprintf("Resources %d/%d", s.resourcesDone, s.resourcesTotal),
+		fmt.Sprintf("SSH %d/%d", s.ssh, s.machines),
+		fmt.Sprintf("Docker %d/%d", s.docker, s.machines),
+		fmt.Sprintf("Bacalhau %d/%d", s.bacalhau, s.machines),
+		"Elapsed " + strings.TrimSpace(formatElapsedTime(s.elapsed)),
+		eta,
+	}
+
+	line := strings.Join(parts, " | ")
+	if m.width > 0 {
+		line = ansi.Truncate(line, m.width, "…")
+	}
+	return lipgloss.NewStyle().Bold(true).Foreground(ActiveTheme.Header).Render(line)
+}
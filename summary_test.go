@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aronchick/bubble-tea-experiment/pkg/models"
+)
+
+func TestSummarize(t *testing.T) {
+	m := groupedMachines()
+	d := m.Deployment
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	d.StartTime = start
+	d.Machines[0].StartTime = start.Add(2 * time.Minute)
+	d.Machines[2].StartTime = start
+	d.Machines[2].EndTime = start.Add(10 * time.Minute)
+
+	s := summarize(d, start.Add(5*time.Minute))
+	resources := len(models.RequiredResources(models.DefaultProvider))
+	want := deploymentSummary{
+		machines: 4, complete: 1, failed: 1, inProgress: 2,
+		resourcesDone: 2 * resources, resourcesTotal: 4 * resources,
+		ssh: 2, docker: 1, bacalhau: 1,
+		elapsed: 5 * time.Minute,
+		// abc02-vm hasn't started, so it has the whole 10 minutes abc03-vm
+		// took to go; abc01-vm started 3 minutes ago
+		eta: 10 * time.Minute, etaValid: true,
+	}
+	if s != want {
+		t.Errorf("summary\n%+v\nwant\n%+v", s, want)
+	}
+}
+
+func TestSummarizeETA(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing has completed to go by
+	m := groupedMachines()
+	m.Deployment.Machines = m.Deployment.Machines[:2]
+	if s := summarize(m.Deployment, start); s.etaValid {
+		t.Errorf("ETA %s with nothing complete", s.eta)
+	}
+
+	// A finished deployment has no ETA and stops the clock
+	m = groupedMachines()
+	m.Deployment.StartTime = start
+	m.Deployment.EndTime = start.Add(time.Minute)
+	s := summarize(m.Deployment, start.Add(time.Hour))
+	if s.etaValid || !s.finished || s.elapsed != time.Minute {
+		t.Errorf("finished deployment: ETA valid %v, finished %v, elapsed %s", s.etaValid, s.finished, s.elapsed)
+	}
+}
+
+func TestMarkFinished(t *testing.T) {
+	m := groupedMachines()
+	d := m.Deployment
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	d.MarkFinished(now)
+	if !d.Machines[0].EndTime.IsZero() || d.Machines[2].EndTime != now || d.Machines[3].EndTime != now {
+		t.Errorf("end times %v, want only the complete and failed machines stamped", endTimes(d))
+	}
+	if !d.EndTime.IsZero() {
+		t.Error("the deployment finished with machines in progress")
+	}
+
+	// Finishing the rest ends the deployment; times already stamped stay
+	for _, i := range []int{0, 1} {
+		machine := &d.Machines[i]
+		provisioned(machine)
+		machine.SSH, machine.Docker = models.ServiceStateSucceeded, models.ServiceStateSucceeded
+		machine.CorePackages, machine.Bacalhau = models.ServiceStateSucceeded, models.ServiceStateSucceeded
+	}
+	later := now.Add(time.Minute)
+	d.MarkFinished(later)
+	if d.EndTime != later || d.Machines[2].EndTime != now || d.Machines[0].EndTime != later {
+		t.Errorf("deployment end %v, machines %v", d.EndTime, endTimes(d))
+	}
+
+	// A retried machine is back in progress, and so is the deployment
+	d.Machines[3].SSH = models.ServiceStateUpdating
+	d.MarkFinished(later.Add(time.Minute))
+	if !d.Machines[3].EndTime.IsZero() || !d.EndTime.IsZero() {
+		t.Errorf("deployment end %v, machines %v after a retry", d.EndTime, endTimes(d))
+	}
+}
+
+func endTimes(d *models.Deployment) []time.Time {
+	times := make([]time.Time, len(d.Machines))
+	for i, machine := range d.Machines {
+		times[i] = machine.EndTime
+	}
+	return times
+}
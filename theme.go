@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+)
+
+// DefaultThemeName picks the light or dark palette from the terminal's
+// background
+const DefaultThemeName = "auto"
+
+// Theme holds every colour the display uses. States are never told apart by
+// colour alone: each also has its own glyph, text or fill character.
+type Theme struct {
+	Name string
+
+	Header lipgloss.TerminalColor
+	// Border is the table border; Accent the detail and log pane borders
+	Border lipgloss.TerminalColor
+	Accent lipgloss.TerminalColor
+	// Muted is used for help text, titles and debug log lines
+	Muted lipgloss.TerminalColor
+	// Selected is the background of the selected row. NoColor selects the
+	// row with reverse video instead.
+	Selected lipgloss.TerminalColor
+
+	Success    lipgloss.TerminalColor
+	Failure    lipgloss.TerminalColor
+	Pending    lipgloss.TerminalColor
+	NotStarted lipgloss.TerminalColor
+	Warning    lipgloss.TerminalColor
+
+	ProgressFilled lipgloss.TerminalColor
+	ProgressEmpty  lipgloss.TerminalColor
+}
+
+// ActiveTheme is the theme the display renders with
+var ActiveTheme = themes[DefaultThemeName]()
+
+// palette is a theme's colours as lipgloss colour strings; "" is no colour
+type palette struct {
+	header, border, accent, muted, selected        string
+	success, failure, pending, notStarted, warning string
+	progressFilled, progressEmpty                  string
+}
+
+var (
+	darkPalette = palette{
+		header: "39", border: "240", accent: "63", muted: "245", selected: "236",
+		success: "#00c413", failure: "#ff0000", pending: "#69acdb", notStarted: "244", warning: "214",
+		progressFilled: "42", progressEmpty: "240",
+	}
+	lightPalette = palette{
+		header: "25", border: "250", accent: "62", muted: "243", selected: "254",
+		success: "#007a0c", failure: "#c00000", pending: "#1f6fb2", notStarted: "246", warning: "130",
+		progressFilled: "28", progressEmpty: "252",
+	}
+	highContrastDarkPalette = palette{
+		header: "15", border: "15", accent: "15", muted: "252",
+		success: "10", failure: "9", pending: "14", notStarted: "250", warning: "11",
+		progressFilled: "15", progressEmpty: "245",
+	}
+	highContrastLightPalette = palette{
+		header: "0", border: "0", accent: "0", muted: "236",
+		success: "22", failure: "124", pending: "18", notStarted: "240", warning: "94",
+		progressFilled: "0", progressEmpty: "248",
+	}
+	// The deuteranopia palettes use the Okabe-Ito blue/orange pairs in
+	// place of green/red
+	deuteranopiaDarkPalette = palette{
+		header: "#56B4E9", border: "240", accent: "#56B4E9", muted: "245", selected: "236",
+		success: "#56B4E9", failure: "#E69F00", pending: "#F0E442", notStarted: "244", warning: "#E69F00",
+		progressFilled: "#56B4E9", progressEmpty: "240",
+	}
+	deuteranopiaLightPalette = palette{
+		header: "#0072B2", border: "250", accent: "#0072B2", muted: "243", selected: "254",
+		success: "#0072B2", failure: "#D55E00", pending: "#CC79A7", notStarted: "246", warning: "#D55E00",
+		progressFilled: "#0072B2", progressEmpty: "252",
+	}
+)
+
+var themes = map[string]func() Theme{
+	"auto":          func() Theme { return adaptiveTheme("auto", lightPalette, darkPalette) },
+	"dark":          func() Theme { return fixedTheme("dark", darkPalette) },
+	"light":         func() Theme { return fixedTheme("light", lightPalette) },
+	"high-contrast": func() Theme { return adaptiveTheme("high-contrast", highContrastLightPalette, highContrastDarkPalette) },
+	"deuteranopia":  func() Theme { return adaptiveTheme("deuteranopia", deuteranopiaLightPalette, deuteranopiaDarkPalette) },
+	"none":          func() Theme { return fixedTheme("none", palette{}) },
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func fixedTheme(name string, p palette) Theme {
+	c := func(s string) lipgloss.TerminalColor {
+		if s == "" {
+			return lipgloss.NoColor{}
+		}
+		return lipgloss.Color(s)
+	}
+	return p.theme(name, func(get func(palette) string) lipgloss.TerminalColor { return c(get(p)) })
+}
+
+// adaptiveTheme follows the terminal's background, which lipgloss detects
+func adaptiveTheme(name string, light, dark palette) Theme {
+	return light.theme(name, func(get func(palette) string) lipgloss.TerminalColor {
+		if get(light) == "" && get(dark) == "" {
+			return lipgloss.NoColor{}
+		}
+		return lipgloss.AdaptiveColor{Light: get(light), Dark: get(dark)}
+	})
+}
+
+func (palette) theme(name string, color func(get func(palette) string) lipgloss.TerminalColor) Theme {
+	return Theme{
+		Name:           name,
+		Header:         color(func(p palette) string { return p.header }),
+		Border:         color(func(p palette) string { return p.border }),
+		Accent:         color(func(p palette) string { return p.accent }),
+		Muted:          color(func(p palette) string { return p.muted }),
+		Selected:       color(func(p palette) string { return p.selected }),
+		Success:        color(func(p palette) string { return p.success }),
+		Failure:        color(func(p palette) string { return p.failure }),
+		Pending:        color(func(p palette) string { return p.pending }),
+		NotStarted:     color(func(p palette) string { return p.notStarted }),
+		Warning:        color(func(p palette) string { return p.warning }),
+		ProgressFilled: color(func(p palette) string { return p.progressFilled }),
+		ProgressEmpty:  color(func(p palette) string { return p.progressEmpty }),
+	}
+}
+
+// colorField returns the theme field a config key such as "success" or
+// "progress_filled" overrides
+func (t *Theme) colorField(key string) (*lipgloss.TerminalColor, bool) {
+	fields := map[string]*lipgloss.TerminalColor{
+		"header":          &t.Header,
+		"border":          &t.Border,
+		"accent":          &t.Accent,
+		"muted":           &t.Muted,
+		"selected":        &t.Selected,
+		"success":         &t.Success,
+		"failure":         &t.Failure,
+		"pending":         &t.Pending,
+		"not_started":     &t.NotStarted,
+		"warning":         &t.Warning,
+		"progress_filled": &t.ProgressFilled,
+		"progress_empty":  &t.ProgressEmpty,
+	}
+	field, ok := fields[strings.ToLower(key)]
+	return field, ok
+}
+
+// LoadTheme builds the theme named by name, or by the config's theme key if
+// name is empty. The config takes either a theme name or a name plus colour
+// overrides:
+//
+//	theme:
+//	  name: dark
+//	  colors:
+//	    success: "#00ff00"
+//	    not_started: "250"
+//
+// NO_COLOR, if set, overrides everything and disables colour entirely.
+func LoadTheme(v *viper.Viper, name string) (Theme, error) {
+	if os.Getenv("NO_COLOR") != "" {
+		lipgloss.SetColorProfile(termenv.Ascii)
+		return themes["none"](), nil
+	}
+
+	if name == "" {
+		name = v.GetString("theme.name")
+	}
+	if name == "" && !v.IsSet("theme.colors") {
+		name = v.GetString("theme")
+	}
+	if name == "" {
+		name = DefaultThemeName
+	}
+	build, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return Theme{}, fmt.Errorf("unknown theme %q (available: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	theme := build()
+
+	overrides := v.GetStringMapString("theme.colors")
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := theme.colorField(key)
+		if !ok {
+			return Theme{}, fmt.Errorf("unknown theme colour %q", key)
+		}
+		*field = lipgloss.Color(overrides[key])
+	}
+	return theme, nil
+}
+
+// selectedStyle marks the selected row, with reverse video if the theme has
+// no selection colour
+func (t Theme) selectedStyle(style lipgloss.Style) lipgloss.Style {
+	if _, none := t.Selected.(lipgloss.NoColor); none {
+		return style.Reverse(true)
+	}
+	return style.Background(t.Selected)
+}
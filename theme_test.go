@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+)
+
+func themeConfig(t *testing.T, config string) *viper.Viper {
+	t.Helper()
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestLoadTheme(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		themeName   string
+		wantName    string
+		wantSuccess lipgloss.TerminalColor
+		wantErr     string
+	}{
+		{name: "default", wantName: "auto", wantSuccess: lipgloss.AdaptiveColor{Light: "#007a0c", Dark: "#00c413"}},
+		{name: "named", themeName: "Dark", wantName: "dark", wantSuccess: lipgloss.Color("#00c413")},
+		{name: "config name", config: "theme: light\n", wantName: "light", wantSuccess: lipgloss.Color("#007a0c")},
+		{name: "name over config", config: "theme: light\n", themeName: "dark", wantName: "dark", wantSuccess: lipgloss.Color("#00c413")},
+		{
+			name:        "colour overrides",
+			config:      "theme:\n  name: dark\n  colors:\n    success: \"#00ff00\"\n",
+			wantName:    "dark",
+			wantSuccess: lipgloss.Color("#00ff00"),
+		},
+		{name: "overrides on the default", config: "theme:\n  colors:\n    success: \"2\"\n", wantName: "auto", wantSuccess: lipgloss.Color("2")},
+		{name: "unknown theme", themeName: "sepia", wantErr: `unknown theme "sepia"`},
+		{name: "unknown colour", config: "theme:\n  colors:\n    sparkle: \"1\"\n", wantErr: `unknown theme colour "sparkle"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "NO_COLOR")
+			theme, err := LoadTheme(themeConfig(t, tt.config), tt.themeName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadTheme = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if theme.Name != tt.wantName || theme.Success != tt.wantSuccess {
+				t.Errorf("theme %s with success %v, want %s with %v", theme.Name, theme.Success, tt.wantName, tt.wantSuccess)
+			}
+		})
+	}
+}
+
+func TestNoColor(t *testing.T) {
+	profile := lipgloss.ColorProfile()
+	t.Cleanup(func() { lipgloss.SetColorProfile(profile) })
+	t.Setenv("NO_COLOR", "1")
+
+	// NO_COLOR wins over the theme asked for
+	theme, err := LoadTheme(themeConfig(t, "theme: dark\n"), "light")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if theme.Name != "none" {
+		t.Errorf("theme %s, want none", theme.Name)
+	}
+	if lipgloss.ColorProfile() != termenv.Ascii {
+		t.Error("colour is still on")
+	}
+	if !theme.selectedStyle(lipgloss.NewStyle()).GetReverse() {
+		t.Error("the selected row isn't in reverse video")
+	}
+}
+
+func TestThemesTellSuccessFromFailure(t *testing.T) {
+	for _, name := range ThemeNames() {
+		if name == "none" {
+			continue
+		}
+		theme := themes[name]()
+		if theme.Success == theme.Failure {
+			t.Errorf("%s uses %v for both success and failure", name, theme.Success)
+		}
+	}
+}